@@ -8,6 +8,7 @@ import (
 	"mirror-sync/pkg/client"
 	"mirror-sync/pkg/project"
 	"os"
+	"time"
 
 	"github.com/google/subcommands"
 )
@@ -52,10 +53,35 @@ func (p *ListCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 }
 
 func print(pr project.Project) {
-	fmt.Println(pr.Name)
+	if pr.Paused {
+		fmt.Println(pr.Name, "(paused)")
+	} else {
+		fmt.Println(pr.Name)
+	}
 	fmt.Println("------------------")
 
 	for _, repo := range pr.Repositories {
-		fmt.Printf("%s | %-20s | %s -> %s | %s\n", repo.UUID, repo.Name, repo.Source, repo.Destination, repo.Schedule)
+		schedule := repo.Schedule
+		if repo.Paused {
+			schedule += " (paused)"
+		}
+		fmt.Printf("%s | %-20s | %s | %s\n", repo.UUID, repo.Name, repo.Source, schedule)
+		for _, m := range repo.Mirrors {
+			status := "never synced"
+			if m.Status != nil {
+				if m.Status.Success {
+					status = "synced at " + m.Status.LastSync.Local().Format(time.DateTime)
+				} else if m.Status.Reason == project.FailureTimeout {
+					status = "timed out at " + m.Status.LastSync.Local().Format(time.DateTime) + ": " + m.Status.Error
+				} else {
+					status = "failed at " + m.Status.LastSync.Local().Format(time.DateTime) + ": " + m.Status.Error
+				}
+			}
+			url := m.URL
+			if m.Bundle != nil {
+				url = "bundle:" + m.Bundle.Path
+			}
+			fmt.Printf("    -> %-15s | %s | %s\n", m.Name, url, status)
+		}
 	}
 }
@@ -0,0 +1,94 @@
+package pause
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mirror-sync/cmd/cli/config"
+	"mirror-sync/pkg/client"
+	"mirror-sync/pkg/project"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/subcommands"
+)
+
+type (
+	PauseCmd struct {
+	}
+)
+
+func (*PauseCmd) Name() string { return "pause" }
+func (*PauseCmd) Synopsis() string {
+	return "stop the syncs of the current project or of one repository"
+}
+func (*PauseCmd) Usage() string {
+	return `Usage: mirror-sync pause [repository]
+
+stop the syncs of the current project, or of one of its repositories, until
+'resume' is run. The configuration is kept, unlike with 'down'. The
+repository is its name in the project file or the name shown by 'list'.
+`
+}
+
+func (p *PauseCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (p *PauseCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 {
+		fmt.Fprint(os.Stderr, p.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	pr, repository, err := Target(f.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	cli := client.New(pr.ServerURL)
+	if err := cli.Pause(pr, repository); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(repository) > 0 {
+		fmt.Printf("%s paused\n", repository)
+	} else {
+		fmt.Printf("%s paused\n", pr.Name)
+	}
+	return subcommands.ExitSuccess
+}
+
+// Target loads the current project and finds the repository named by arg,
+// by its name in the project file or its full name. The repository is
+// empty when arg is.
+func Target(arg string) (project.Project, string, error) {
+	clientConfig := config.Load()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return project.Project{}, "", err
+	}
+
+	defaultValues := project.DefaultValues{
+		DaemonURL:   clientConfig.Deamon.URL,
+		ProjectName: filepath.Base(wd),
+	}
+
+	pr, err := project.LoadCurrent(defaultValues)
+	if err != nil {
+		return project.Project{}, "", err
+	}
+	if len(arg) == 0 {
+		return pr, "", nil
+	}
+
+	for _, repo := range pr.Repositories {
+		if repo.Name == arg || repo.Name == fmt.Sprintf("%s-%s", pr.Name, strings.ToLower(arg)) {
+			return pr, repo.Name, nil
+		}
+	}
+	return project.Project{}, "", fmt.Errorf("repository %s is not in the project %s", arg, pr.Name)
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mirror-sync/cmd/cli/config"
+	"mirror-sync/pkg/client"
+	"mirror-sync/pkg/remote/obj"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+)
+
+type (
+	QueueCmd struct{}
+)
+
+func (*QueueCmd) Name() string     { return "queue" }
+func (*QueueCmd) Synopsis() string { return "show the running and queued syncs" }
+func (*QueueCmd) Usage() string {
+	return `Usage: mirror-sync queue
+
+show the syncs running on the daemon, then the ones waiting for a worker
+in their order
+
+Options:
+`
+}
+
+func (p *QueueCmd) SetFlags(f *flag.FlagSet) {}
+
+func (p *QueueCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	clientConfig := config.Load()
+
+	cli := client.New(clientConfig.Deamon.URL)
+
+	jobs, err := cli.Queue()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("no sync running")
+		return subcommands.ExitSuccess
+	}
+	now := time.Now()
+	for _, j := range jobs {
+		since := j.QueuedAt
+		if j.Status == obj.JobRunning && j.StartedAt != nil {
+			since = *j.StartedAt
+		}
+		fmt.Printf("%-7s | %-20s | %-7s | #%d | %8s | %s\n", j.Status, j.Repository, j.Trigger, j.Attempt, now.Sub(since).Round(time.Second), strings.Join(j.Hosts, ", "))
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,72 @@
+package restore
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mirror-sync/cmd/cli/config"
+	"mirror-sync/pkg/client"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+)
+
+type (
+	RestoreCmd struct {
+		mirror string
+	}
+)
+
+func (*RestoreCmd) Name() string     { return "restore" }
+func (*RestoreCmd) Synopsis() string { return "list or restore the backed-up refs of a mirror" }
+func (*RestoreCmd) Usage() string {
+	return `Usage: mirror-sync restore [-mirror name] <repository> [backup ref]
+
+list the backups of a mirror, or put the backed-up ref back on the mirror
+when a backup ref is given. The repository is the name shown by 'list'.
+
+Options:
+`
+}
+
+func (p *RestoreCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.mirror, "mirror", "mirror", "name of the mirror")
+}
+
+func (p *RestoreCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 1 || f.NArg() > 2 {
+		fmt.Fprint(os.Stderr, p.Usage())
+		return subcommands.ExitUsageError
+	}
+	repository := f.Arg(0)
+
+	clientConfig := config.Load()
+
+	cli := client.New(clientConfig.Deamon.URL)
+
+	if f.NArg() == 2 {
+		if err := cli.Restore(repository, p.mirror, f.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return subcommands.ExitFailure
+		}
+		fmt.Printf("%s restored on %s\n", f.Arg(1), p.mirror)
+		return subcommands.ExitSuccess
+	}
+
+	backups, err := cli.Backups(repository, p.mirror)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(backups) == 0 {
+		fmt.Println("no backup")
+		return subcommands.ExitSuccess
+	}
+	for _, b := range backups {
+		fmt.Printf("%s | %-30s | %s | %s\n", b.Time.Local().Format(time.DateTime), b.Original, b.Hash[:8], b.Ref)
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,57 @@
+package resume
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mirror-sync/cmd/cli/commands/pause"
+	"mirror-sync/pkg/client"
+	"os"
+
+	"github.com/google/subcommands"
+)
+
+type (
+	ResumeCmd struct {
+	}
+)
+
+func (*ResumeCmd) Name() string     { return "resume" }
+func (*ResumeCmd) Synopsis() string { return "restart the syncs stopped by pause" }
+func (*ResumeCmd) Usage() string {
+	return `Usage: mirror-sync resume [repository]
+
+restart the syncs of the current project, or of one of its repositories,
+stopped by 'pause'. A repository of a paused project stays paused until the
+project is resumed.
+`
+}
+
+func (p *ResumeCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (p *ResumeCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 {
+		fmt.Fprint(os.Stderr, p.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	pr, repository, err := pause.Target(f.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	cli := client.New(pr.ServerURL)
+	if err := cli.Resume(pr, repository); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(repository) > 0 {
+		fmt.Printf("%s resumed\n", repository)
+	} else {
+		fmt.Printf("%s resumed\n", pr.Name)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,126 @@
+package runs
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mirror-sync/cmd/cli/config"
+	"mirror-sync/pkg/client"
+	"mirror-sync/pkg/project"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/subcommands"
+)
+
+type (
+	RunsCmd struct {
+		limit int
+	}
+)
+
+func (*RunsCmd) Name() string     { return "runs" }
+func (*RunsCmd) Synopsis() string { return "show the sync history of a repository" }
+func (*RunsCmd) Usage() string {
+	return `Usage: mirror-sync runs [-limit n] <repository> [run id]
+
+list the latest syncs of a repository, or show the refs updated by a run
+when a run id is given. The repository is the name shown by 'list'.
+
+Options:
+`
+}
+
+func (p *RunsCmd) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&p.limit, "limit", 20, "number of runs shown, 0 shows all of them")
+}
+
+func (p *RunsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 1 || f.NArg() > 2 {
+		fmt.Fprint(os.Stderr, p.Usage())
+		return subcommands.ExitUsageError
+	}
+	repository := f.Arg(0)
+
+	clientConfig := config.Load()
+
+	cli := client.New(clientConfig.Deamon.URL)
+
+	if f.NArg() == 2 {
+		id, err := strconv.ParseInt(f.Arg(1), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid run id '%s'\n", f.Arg(1))
+			return subcommands.ExitUsageError
+		}
+		run, err := cli.Run(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return subcommands.ExitFailure
+		}
+		show(run)
+		return subcommands.ExitSuccess
+	}
+
+	runs, err := cli.Runs(repository, p.limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("no run")
+		return subcommands.ExitSuccess
+	}
+	for _, r := range runs {
+		fmt.Printf("%6d | %s | %-7s | #%d | %-7s | %8s | %s\n", r.ID, r.StartedAt.Local().Format(time.DateTime), r.Trigger, r.Attempt, r.Status, duration(r), r.Error)
+	}
+
+	return subcommands.ExitSuccess
+}
+
+func show(r project.Run) {
+	fmt.Printf("run:      %d\n", r.ID)
+	fmt.Printf("trigger:  %s\n", r.Trigger)
+	fmt.Printf("attempt:  %d\n", r.Attempt)
+	fmt.Printf("started:  %s\n", r.StartedAt.Local().Format(time.DateTime))
+	if r.EndedAt != nil {
+		fmt.Printf("ended:    %s (%s)\n", r.EndedAt.Local().Format(time.DateTime), duration(r))
+	}
+	fmt.Printf("status:   %s\n", r.Status)
+	if len(r.Error) > 0 {
+		fmt.Printf("error:    %s\n", r.Error)
+	}
+	if len(r.Mismatches) > 0 {
+		fmt.Println("mismatches:")
+		for _, m := range r.Mismatches {
+			fmt.Printf("  %s | %s | expected %s, found %s\n", m.Mirror, m.Ref, short(m.Expected), short(m.Actual))
+		}
+	}
+	if len(r.RefUpdates) == 0 {
+		fmt.Println("no ref updated")
+		return
+	}
+	fmt.Println("updates:")
+	for _, u := range r.RefUpdates {
+		fmt.Printf("  %s | %s | %s -> %s\n", u.Mirror, u.Ref, short(u.Old), short(u.New))
+	}
+}
+
+func duration(r project.Run) string {
+	if r.EndedAt == nil {
+		return "-"
+	}
+	return r.EndedAt.Sub(r.StartedAt).Round(time.Millisecond).String()
+}
+
+// short abbreviates a hash, an empty one is a created or deleted ref
+func short(h string) string {
+	if len(h) == 0 {
+		return "(none)"
+	}
+	if len(h) > 8 {
+		return h[:8]
+	}
+	return h
+}
@@ -6,8 +6,13 @@ import (
 	"fmt"
 	"mirror-sync/cmd/cli/commands/apply"
 	"mirror-sync/cmd/cli/commands/list"
+	"mirror-sync/cmd/cli/commands/pause"
+	"mirror-sync/cmd/cli/commands/queue"
 	"mirror-sync/cmd/cli/commands/remove"
+	"mirror-sync/cmd/cli/commands/restore"
+	"mirror-sync/cmd/cli/commands/resume"
 	"mirror-sync/cmd/cli/commands/run"
+	"mirror-sync/cmd/cli/commands/runs"
 	"mirror-sync/cmd/cli/commands/version"
 	"os"
 
@@ -29,8 +34,13 @@ func main() {
 	subcommands.Register(&apply.ApplyCmd{}, "projects")
 	subcommands.Register(&run.RunCmd{}, "projects")
 	subcommands.Register(&remove.DownCmd{}, "projects")
+	subcommands.Register(&pause.PauseCmd{}, "projects")
+	subcommands.Register(&resume.ResumeCmd{}, "projects")
+	subcommands.Register(&restore.RestoreCmd{}, "projects")
+	subcommands.Register(&runs.RunsCmd{}, "projects")
 
 	subcommands.Register(&list.ListCmd{}, "management")
+	subcommands.Register(&queue.QueueCmd{}, "management")
 
 	flag.Parse()
 	ctx := context.Background()
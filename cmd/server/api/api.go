@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"mirror-sync/cmd/server/core/storage"
@@ -10,7 +11,9 @@ import (
 	"mirror-sync/pkg/remote/obj"
 	"net/http"
 	"runtime"
+	"strconv"
 
+	"mirror-sync/cmd/server/core/git"
 	cronruntime "mirror-sync/cmd/server/core/runtime"
 
 	"github.com/go-chi/chi/v5"
@@ -48,11 +51,23 @@ func NewServer(data *storage.Repository, scheduler *cronruntime.Scheduler, addr
 			// Get information about the server
 			r.Get("/version", s.Information)
 			r.MethodFunc("EXECUTE", "/run", s.RunProjectHandler)
+			r.Get("/queue", s.QueueGetHandler)
 			r.Route("/projects", func(r chi.Router) {
 				r.Get("/all", s.ProjectsGetHandler)
 				r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
 				r.Post("/", s.ProjectPostHandler)
 				r.Delete("/", s.ProjectDeleteHandler)
+				r.MethodFunc("EXECUTE", "/{name}/pause", s.ProjectPauseHandler)
+				r.MethodFunc("EXECUTE", "/{name}/resume", s.ProjectResumeHandler)
+			})
+			r.Get("/repositories/{name}/runs", s.RunsGetHandler)
+			r.MethodFunc("EXECUTE", "/repositories/{name}/pause", s.RepositoryPauseHandler)
+			r.MethodFunc("EXECUTE", "/repositories/{name}/resume", s.RepositoryResumeHandler)
+			r.Get("/runs/{id}", s.RunGetHandler)
+			r.Route("/repositories/{name}/mirrors/{mirror}", func(r chi.Router) {
+				r.Get("/backups", s.BackupsGetHandler)
+				r.Get("/verification", s.VerificationGetHandler)
+				r.MethodFunc("EXECUTE", "/restore", s.RestoreHandler)
 			})
 		})
 	})
@@ -89,6 +104,14 @@ func (s *HTTPServer) ProjectPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// reload the project to get the identifiers of the repositories
+	pr, err := s.data.Project(pr.Name)
+	if err != nil {
+		slog.Error("failed to fetch the project from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
 	s.scheduler.Remove(pr)
 	if err := s.scheduler.Add(pr); err != nil {
 		slog.Error("failed to run project", "err", err)
@@ -126,7 +149,7 @@ func (s *HTTPServer) ProjectsGetHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ok(prs, w, r)
+	ok(redactProjects(prs), w, r)
 }
 
 func (s *HTTPServer) RunProjectHandler(w http.ResponseWriter, r *http.Request) {
@@ -138,7 +161,22 @@ func (s *HTTPServer) RunProjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.scheduler.RunOnce(pr); err != nil {
+	pr, err := s.data.Project(pr.Name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("project not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to fetch the project from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	if err := s.scheduler.RunOnce(r.Context(), pr); err != nil {
+		if errors.Is(err, cronruntime.ErrPaused) {
+			conflict(fmt.Sprintf("%s, resume them to run them", err), w, r)
+			return
+		}
 		slog.Error("failed to run the project", "err", err)
 		internalServerError(err, w, r)
 		return
@@ -146,3 +184,243 @@ func (s *HTTPServer) RunProjectHandler(w http.ResponseWriter, r *http.Request) {
 
 	ok("ok", w, r)
 }
+
+func (s *HTTPServer) BackupsGetHandler(w http.ResponseWriter, r *http.Request) {
+	repo, err := s.data.RepositoryByName(chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("repository not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to fetch the repository from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	backups, err := s.scheduler.Backups(r.Context(), repo, chi.URLParam(r, "mirror"))
+	if err != nil {
+		if errors.Is(err, git.ErrMirrorNotFound) {
+			notFound(err.Error(), w, r)
+			return
+		}
+		slog.Error("failed to list the backups", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	res := make([]obj.Backup, 0, len(backups))
+	for _, b := range backups {
+		res = append(res, obj.Backup{
+			Ref:      b.Ref.String(),
+			Original: b.Original.String(),
+			Hash:     b.Hash.String(),
+			Time:     b.Time,
+		})
+	}
+
+	ok(res, w, r)
+}
+
+func (s *HTTPServer) VerificationGetHandler(w http.ResponseWriter, r *http.Request) {
+	repo, err := s.data.RepositoryByName(chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("repository not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to fetch the repository from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	name := chi.URLParam(r, "mirror")
+	for _, m := range repo.Mirrors {
+		if m.Name != name {
+			continue
+		}
+		res := obj.Verification{
+			Mirror:     m.Name,
+			Mismatches: []project.Mismatch{},
+		}
+		switch {
+		case m.Status == nil:
+			res.Reason = "never synced"
+		case len(m.Status.Mismatches) > 0:
+			res.LastSync = m.Status.LastSync
+			res.Reason = project.FailureMismatch
+			res.Mismatches = m.Status.Mismatches
+		case m.Bundle != nil:
+			res.LastSync = m.Status.LastSync
+			res.Reason = "not checked, the bundles are not verified"
+		case !m.Status.Checked:
+			res.LastSync = m.Status.LastSync
+			res.Reason = "not checked, the last push failed: " + m.Status.Error
+		default:
+			res.LastSync = m.Status.LastSync
+			res.Verified = true
+		}
+		ok(res, w, r)
+		return
+	}
+
+	notFound(fmt.Sprintf("%s: %s", git.ErrMirrorNotFound, name), w, r)
+}
+
+func (s *HTTPServer) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	var req obj.RestoreRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		slog.Error("failed to parse restore request", "err", err)
+		badRequest(err.Error(), w, r)
+		return
+	}
+
+	repo, err := s.data.RepositoryByName(chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("repository not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to fetch the repository from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	if err := s.scheduler.Restore(r.Context(), repo, chi.URLParam(r, "mirror"), req.Ref); err != nil {
+		if errors.Is(err, git.ErrMirrorNotFound) || errors.Is(err, git.ErrBackupNotFound) {
+			notFound(err.Error(), w, r)
+			return
+		}
+		slog.Error("failed to restore the backup", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	ok("ok", w, r)
+}
+
+// defaultRunsLimit is the number of runs returned when no limit is given
+const defaultRunsLimit = 20
+
+func (s *HTTPServer) RunsGetHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRunsLimit
+	if l := r.URL.Query().Get("limit"); len(l) > 0 {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			badRequest(fmt.Sprintf("invalid limit '%s'", l), w, r)
+			return
+		}
+		limit = n
+	}
+
+	repo, err := s.data.RepositoryByName(chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("repository not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to fetch the repository from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	runs, err := s.data.Runs(repo.UUID, limit)
+	if err != nil {
+		slog.Error("failed to fetch the runs from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	ok(runs, w, r)
+}
+
+func (s *HTTPServer) RunGetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(fmt.Sprintf("invalid run id '%s'", chi.URLParam(r, "id")), w, r)
+		return
+	}
+
+	run, err := s.data.Run(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("run not found", w, r)
+			return
+		}
+		slog.Error("failed to fetch the run from the database", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	ok(run, w, r)
+}
+
+func (s *HTTPServer) QueueGetHandler(w http.ResponseWriter, r *http.Request) {
+	jobs := s.scheduler.Queue()
+
+	res := make([]obj.Job, 0, len(jobs))
+	for _, j := range jobs {
+		job := obj.Job{
+			Repository: j.Repository,
+			Trigger:    j.Trigger,
+			Attempt:    j.Attempt,
+			Hosts:      j.Hosts,
+			Status:     obj.JobQueued,
+			QueuedAt:   j.QueuedAt,
+		}
+		if job.Hosts == nil {
+			job.Hosts = []string{}
+		}
+		if !j.StartedAt.IsZero() {
+			job.Status = obj.JobRunning
+			job.StartedAt = &j.StartedAt
+		}
+		res = append(res, job)
+	}
+
+	ok(res, w, r)
+}
+
+func (s *HTTPServer) ProjectPauseHandler(w http.ResponseWriter, r *http.Request) {
+	s.setProjectPaused(true, w, r)
+}
+
+func (s *HTTPServer) ProjectResumeHandler(w http.ResponseWriter, r *http.Request) {
+	s.setProjectPaused(false, w, r)
+}
+
+func (s *HTTPServer) RepositoryPauseHandler(w http.ResponseWriter, r *http.Request) {
+	s.setRepositoryPaused(true, w, r)
+}
+
+func (s *HTTPServer) RepositoryResumeHandler(w http.ResponseWriter, r *http.Request) {
+	s.setRepositoryPaused(false, w, r)
+}
+
+func (s *HTTPServer) setProjectPaused(paused bool, w http.ResponseWriter, r *http.Request) {
+	if err := s.data.SetProjectPaused(chi.URLParam(r, "name"), paused); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("project not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to save the paused state of the project", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	ok("ok", w, r)
+}
+
+func (s *HTTPServer) setRepositoryPaused(paused bool, w http.ResponseWriter, r *http.Request) {
+	if err := s.data.SetRepositoryPaused(chi.URLParam(r, "name"), paused); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			notFound("repository not found, has it been applied?", w, r)
+			return
+		}
+		slog.Error("failed to save the paused state of the repository", "err", err)
+		internalServerError(err, w, r)
+		return
+	}
+
+	ok("ok", w, r)
+}
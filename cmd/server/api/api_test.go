@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mirror-sync/cmd/server/core/storage"
+	"mirror-sync/pkg/project"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cronruntime "mirror-sync/cmd/server/core/runtime"
+)
+
+func TestPauseHandlers(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		// project and repository are the states after the request, both
+		// start paused when resumed
+		project    bool
+		repository bool
+	}{
+		{name: "pause project", path: "/api/v1/projects/p/pause", status: http.StatusOK, project: true},
+		{name: "pause repository", path: "/api/v1/repositories/p-r/pause", status: http.StatusOK, repository: true},
+		{name: "resume project", path: "/api/v1/projects/p/resume", status: http.StatusOK, repository: true},
+		{name: "resume repository", path: "/api/v1/repositories/p-r/resume", status: http.StatusOK, project: true},
+		{name: "missing project", path: "/api/v1/projects/missing/pause", status: http.StatusNotFound},
+		{name: "missing repository", path: "/api/v1/repositories/missing/pause", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, data := newTestServer(t)
+			if strings.HasSuffix(tt.path, "/resume") {
+				if err := data.SetProjectPaused("p", true); err != nil {
+					t.Fatal(err)
+				}
+				if err := data.SetRepositoryPaused("p-r", true); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := serve(s, "EXECUTE", tt.path, nil)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			pr, err := data.Project("p")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pr.Paused != tt.project || pr.Repositories[0].Paused != tt.repository {
+				t.Errorf("project paused is %t and repository paused is %t, want %t and %t", pr.Paused, pr.Repositories[0].Paused, tt.project, tt.repository)
+			}
+		})
+	}
+}
+
+func TestRunProjectHandlerPaused(t *testing.T) {
+	s, data := newTestServer(t)
+	if w := serve(s, "EXECUTE", "/api/v1/projects/p/pause", nil); w.Code != http.StatusOK {
+		t.Fatalf("got status %d pausing the project: %s", w.Code, w.Body)
+	}
+
+	body, err := json.Marshal(project.Project{Name: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(s, "EXECUTE", "/api/v1/run", body)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("p-r")) {
+		t.Errorf("response does not name the paused repository: %s", w.Body)
+	}
+
+	// nothing is synced nor recorded
+	repo, err := data.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := data.Runs(repo.UUID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) > 0 {
+		t.Errorf("got runs %v for a paused project", runs)
+	}
+}
+
+// newTestServer returns a server on a new database with the project "p" and
+// its repository "p-r".
+func newTestServer(t *testing.T) (*HTTPServer, *storage.Repository) {
+	t.Helper()
+	data, err := storage.OpenDB(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	pr := project.Project{Name: "p", Repositories: []project.Repository{{
+		Name:            "p-r",
+		Source:          "https://git.example.com/r",
+		Schedule:        "* * * * *",
+		Authentications: map[string]project.AuthenticationSettings{},
+	}}}
+	if err := data.Save(pr); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler, err := cronruntime.New(nil, nil, data, cronruntime.Options{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(data, scheduler, "127.0.0.1", 0), data
+}
+
+func serve(s *HTTPServer, method, path string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.Server.Handler.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	return w
+}
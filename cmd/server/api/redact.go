@@ -0,0 +1,75 @@
+package api
+
+import (
+	"mirror-sync/pkg/project"
+	"net/url"
+)
+
+// redacted replaces the secrets in the responses, an empty secret stays
+// empty so that the callers can tell which ones are set
+const redacted = "[redacted]"
+
+// redactProjects returns a copy of the projects without the credentials of
+// their repositories.
+func redactProjects(prs []project.Project) []project.Project {
+	res := make([]project.Project, 0, len(prs))
+	for _, pr := range prs {
+		repos := make([]project.Repository, 0, len(pr.Repositories))
+		for _, repo := range pr.Repositories {
+			repos = append(repos, redactRepository(repo))
+		}
+		pr.Repositories = repos
+		res = append(res, pr)
+	}
+	return res
+}
+
+func redactRepository(repo project.Repository) project.Repository {
+	auths := make(map[string]project.AuthenticationSettings, len(repo.Authentications))
+	for name, a := range repo.Authentications {
+		a.Token = redact(a.Token)
+		if a.Basic != nil {
+			basic := *a.Basic
+			basic.Password = redact(basic.Password)
+			a.Basic = &basic
+		}
+		if a.SSH != nil {
+			ssh := *a.SSH
+			ssh.PrivateKey = redact(ssh.PrivateKey)
+			ssh.Passphrase = redact(ssh.Passphrase)
+			a.SSH = &ssh
+		}
+		auths[name] = a
+	}
+	repo.Authentications = auths
+
+	if repo.Connections != nil {
+		conns := make(map[string]project.ConnectionSettings, len(repo.Connections))
+		for name, c := range repo.Connections {
+			c.ClientKey = redact(c.ClientKey)
+			c.Proxy = redactURL(c.Proxy)
+			conns[name] = c
+		}
+		repo.Connections = conns
+	}
+	return repo
+}
+
+func redact(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL hides the password of a url, e.g. of a proxy
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); !ok {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -120,3 +120,22 @@ func badRequest(message string, w http.ResponseWriter, r *http.Request) {
 		slog.Error(err.Error())
 	}
 }
+
+func conflict(message string, w http.ResponseWriter, r *http.Request) {
+	payload := obj.HTTPError{
+		HTTPCore: obj.HTTPCore{
+			Status:    http.StatusConflict,
+			Path:      r.RequestURI,
+			Timestamp: time.Now(),
+		},
+		Error:   "Conflict",
+		Message: message,
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	e := json.NewEncoder(w)
+	if err := e.Encode(payload); err != nil {
+		slog.Error(err.Error())
+	}
+}
@@ -12,6 +12,19 @@ type (
 	DaemonConfiguration struct {
 		Server   ServerConfiguration   `json:"server"`
 		Database DatabaseConfiguration `json:"database"`
+		Cache    CacheConfiguration    `json:"cache"`
+		Sync     SyncConfiguration     `json:"sync"`
+		// Connection are the default TLS and proxy settings of the remotes
+		Connection ConnectionConfiguration `json:"connection"`
+	}
+
+	ConnectionConfiguration struct {
+		CABundlePath       string   `json:"ca_bundle_path"`
+		InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+		ClientCertPath     string   `json:"client_cert_path"`
+		ClientKeyPath      string   `json:"client_key_path"`
+		Proxy              string   `json:"proxy"`
+		NoProxy            []string `json:"no_proxy"`
 	}
 
 	ServerConfiguration struct {
@@ -22,6 +35,39 @@ type (
 	DatabaseConfiguration struct {
 		Path string `json:"path"`
 	}
+
+	SyncConfiguration struct {
+		// Timeout is the default duration after which a sync is stopped
+		// (e.g. "1h"), "0" (default) means no timeout
+		Timeout string `json:"timeout"`
+		// Limits apply to every repository, the limits of a repository can
+		// only be lower
+		Limits LimitsConfiguration `json:"limits"`
+		// Concurrency is the maximum number of syncs running at once, the
+		// others wait in a queue
+		Concurrency int `json:"concurrency"`
+		// HostConcurrency is the maximum number of syncs running at once
+		// against a host (e.g. "github.com"), "*" applies to the hosts
+		// without their own limit. A sync counts for the hosts of its
+		// source and of its mirrors.
+		HostConcurrency map[string]int `json:"host_concurrency"`
+	}
+
+	// LimitsConfiguration aborts the syncs of the repositories that grew too
+	// much, 0 means unlimited
+	LimitsConfiguration struct {
+		MaxPackSizeMB int64 `json:"max_pack_size_mb"`
+		MaxObjects    int64 `json:"max_objects"`
+		MaxRefs       int64 `json:"max_refs"`
+	}
+
+	CacheConfiguration struct {
+		Path string `json:"path"`
+		// MaxSizeMB is the maximum size of the cache of one repository, its LFS
+		// objects excluded, 0 means unlimited. A full entry is not fetched into
+		// anymore.
+		MaxSizeMB int64 `json:"max_size_mb"`
+	}
 )
 
 func Load(path string) (DaemonConfiguration, error) {
@@ -54,6 +100,13 @@ func Default() DaemonConfiguration {
 		Database: DatabaseConfiguration{
 			Path: "/var/lib/mirror-sync/data.db",
 		},
+		Cache: CacheConfiguration{
+			Path: "/var/lib/mirror-sync/cache",
+		},
+		Sync: SyncConfiguration{
+			Timeout:     "0",
+			Concurrency: 8,
+		},
 	}
 }
 
@@ -61,6 +114,15 @@ func fillDefault(c DaemonConfiguration) DaemonConfiguration {
 	if len(c.Database.Path) == 0 {
 		c.Database.Path = Default().Database.Path
 	}
+	if len(c.Cache.Path) == 0 {
+		c.Cache.Path = filepath.Join(filepath.Dir(c.Database.Path), "cache")
+	}
+	if len(c.Sync.Timeout) == 0 {
+		c.Sync.Timeout = Default().Sync.Timeout
+	}
+	if c.Sync.Concurrency <= 0 {
+		c.Sync.Concurrency = Default().Sync.Concurrency
+	}
 	if len(c.Server.Address) == 0 {
 		c.Server.Address = Default().Server.Address
 	}
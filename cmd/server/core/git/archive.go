@@ -0,0 +1,387 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+type (
+	// ArchiveFormat is the file format of the source tree snapshots.
+	ArchiveFormat string
+
+	// Archives writes a snapshot of the source tree of the selected refs
+	// after each successful sync. The zero value archives nothing.
+	Archives struct {
+		// Dir is the directory of the archives, on the host of the daemon
+		Dir string
+		// Branches and Tags are globs of the short names of the archived
+		// refs, none is archived when they are empty
+		Branches []string
+		Tags     []string
+		Format   ArchiveFormat
+		// Retention deletes the branch snapshots older than it, 0 keeps
+		// them. The tag archives are always kept.
+		Retention time.Duration
+		// Interval is the minimum time between two snapshots of a branch,
+		// 0 archives every commit
+		Interval time.Duration
+
+		// branches and tags are the compiled Branches and Tags
+		branches globs
+		tags     globs
+	}
+)
+
+const (
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveZip   ArchiveFormat = "zip"
+)
+
+// archiveHashLength is the length of the commit hash in the names of the
+// branch snapshots
+const archiveHashLength = 12
+
+func (a Archives) enabled() bool {
+	return len(a.Dir) > 0 && len(a.Branches)+len(a.Tags) > 0
+}
+
+// Archive writes the archives of the cached refs selected by the archive
+// settings of the repository, each one with a .sha256 manifest, and returns
+// the paths of the new ones. A tag is only archived once, a branch once per
+// commit and at most once per interval.
+func Archive(ctx context.Context, c *Cache, r Repository, now time.Time) ([]string, error) {
+	a := r.settings.Archives
+	if !a.enabled() {
+		return nil, nil
+	}
+
+	unlock := c.lock(r.name)
+	defer unlock()
+
+	repo, err := c.open(r.name)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := localRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	// the refs that are not mirrored are not archived either
+	refs, _ = verifyRefs(repo, refs, r.settings.Verify)
+
+	var created []string
+	for _, ref := range refs {
+		path, ok := a.path(r.name, ref)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if a.Interval > 0 && ref.Name().IsBranch() {
+			if at, ok := a.lastSnapshot(path); ok && now.Sub(at) < a.Interval {
+				continue
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return created, err
+		}
+
+		if err := a.write(ctx, repo, r.name, ref, path, now); err != nil {
+			return created, fmt.Errorf("failed to archive %s: %w", ref.Name(), err)
+		}
+		created = append(created, path)
+	}
+
+	if err := a.expire(r.name, now); err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+// path returns the path of the archive of a ref, false when the ref is not
+// archived: <dir>/<repository>/tags/<tag>.<format> and
+// <dir>/<repository>/branches/<branch>-<hash>.<format>.
+func (a Archives) path(repository string, ref *plumbing.Reference) (string, bool) {
+	format := a.format()
+	// the settings were not made by NewRepository
+	if a.branches == nil && a.tags == nil {
+		a.branches, a.tags = compileGlobs(a.Branches), compileGlobs(a.Tags)
+	}
+
+	name := ref.Name()
+	switch {
+	case name.IsTag() && a.tags.match(name.Short()):
+		return filepath.Join(a.Dir, repository, "tags", filepath.FromSlash(name.Short())+"."+string(format)), true
+	case name.IsBranch() && a.branches.match(name.Short()):
+		file := fmt.Sprintf("%s-%s.%s", filepath.FromSlash(name.Short()), ref.Hash().String()[:archiveHashLength], format)
+		return filepath.Join(a.Dir, repository, "branches", file), true
+	}
+	return "", false
+}
+
+func (a Archives) format() ArchiveFormat {
+	if len(a.Format) == 0 {
+		return ArchiveTarGz
+	}
+	return a.Format
+}
+
+// lastSnapshot returns the time of the latest snapshot of the branch of the
+// snapshot at path, whatever its commit, false if there is none. Only the
+// files of that exact branch are read, not the ones of the branches that
+// it is a prefix of.
+func (a Archives) lastSnapshot(path string) (time.Time, bool) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// <branch>-<hash>.<format>
+	suffix := "." + string(a.format())
+	branch, _ := splitSnapshot(strings.TrimSuffix(filepath.Base(path), suffix))
+
+	var last time.Time
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), suffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if b, ok := splitSnapshot(name); !ok || b != branch {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// splitSnapshot returns the branch of a snapshot name without its
+// extension, false when it does not end with -<hash>.
+func splitSnapshot(name string) (string, bool) {
+	n := len(name) - archiveHashLength - 1
+	if n < 0 || name[n] != '-' {
+		return "", false
+	}
+	if _, err := hex.DecodeString(name[n+1:]); err != nil {
+		return "", false
+	}
+	return name[:n], true
+}
+
+// write archives the tree of the commit of the ref then its manifest, the
+// files are written next to their final path and renamed once complete.
+// The archive is dated now, the interval and the retention are counted
+// from it.
+func (a Archives) write(ctx context.Context, repo *git.Repository, repository string, ref *plumbing.Reference, path string, now time.Time) error {
+	commit, err := peelCommit(repo, ref.Hash())
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	w := &contextWriter{ctx: ctx, w: io.MultiWriter(f, h)}
+	prefix := strings.ReplaceAll(fmt.Sprintf("%s-%s", repository, ref.Name().Short()), "/", "-") + "/"
+	if a.Format == ArchiveZip {
+		err = writeZip(w, tree, prefix, commit.Committer.When)
+	} else {
+		err = writeTarGz(w, tree, prefix, commit.Committer.When)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// the manifest can be checked with sha256sum -c
+	manifest := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(manifest), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Chtimes(path, now, now); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return os.Chmod(path, 0o644)
+}
+
+func writeTarGz(w io.Writer, tree *object.Tree, prefix string, at time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := tree.Files().ForEach(func(f *object.File) error {
+		header := &tar.Header{
+			Name:    prefix + f.Name,
+			Mode:    0o644,
+			Size:    f.Size,
+			ModTime: at,
+		}
+		if f.Mode == filemode.Executable {
+			header.Mode = 0o755
+		}
+		if f.Mode == filemode.Symlink {
+			target, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = target
+			header.Mode = 0o777
+			header.Size = 0
+			return tw.WriteHeader(header)
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		return copyBlob(tw, f)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, tree *object.Tree, prefix string, at time.Time) error {
+	zw := zip.NewWriter(w)
+	err := tree.Files().ForEach(func(f *object.File) error {
+		header := &zip.FileHeader{
+			Name:     prefix + f.Name,
+			Method:   zip.Deflate,
+			Modified: at,
+		}
+		switch f.Mode {
+		case filemode.Executable:
+			header.SetMode(0o755)
+		case filemode.Symlink:
+			header.SetMode(fs.ModeSymlink | 0o777)
+		default:
+			header.SetMode(0o644)
+		}
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyBlob(dst, f)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+func copyBlob(w io.Writer, f *object.File) error {
+	r, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// peelCommit returns the commit of a ref, following the annotated tags.
+func peelCommit(repo *git.Repository, h plumbing.Hash) (*object.Commit, error) {
+	obj, err := object.GetObject(repo.Storer, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", h, err)
+	}
+	switch o := obj.(type) {
+	case *object.Commit:
+		return o, nil
+	case *object.Tag:
+		c, err := o.Commit()
+		if err != nil {
+			return nil, fmt.Errorf("tag %s does not point to a commit", o.Name)
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("%s is a %s", h, obj.Type())
+	}
+}
+
+// expire removes the branch snapshots older than the retention, with their
+// manifest.
+func (a Archives) expire(repository string, now time.Time) error {
+	if a.Retention <= 0 {
+		return nil
+	}
+
+	dir := filepath.Join(a.Dir, repository, "branches")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") || strings.HasSuffix(path, ".sha256") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if now.Sub(info.ModTime()) <= a.Retention {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if err := os.Remove(path + ".sha256"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to expire archives: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestArchiveInterval(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+	dir := t.TempDir()
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, nil, Settings{
+		Archives: Archives{Dir: dir, Branches: []string{"*"}, Interval: time.Hour},
+	})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		after   time.Duration
+		created int
+	}{
+		{name: "first snapshot", created: 1},
+		{name: "new commit within the interval", after: 30 * time.Minute},
+		{name: "new commit after the interval", after: 90 * time.Minute, created: 1},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if i > 0 {
+				commit(t, src, "a", tt.name)
+			}
+			mustSync(t, c, r)
+			created, err := Archive(t.Context(), c, r, start.Add(tt.after))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(created) != tt.created {
+				t.Errorf("got archives %v, want %d", created, tt.created)
+			}
+		})
+	}
+}
+
+func TestArchiveRetention(t *testing.T) {
+	src, srcPath := newSource(t)
+	first := commit(t, src, "a", "1")
+	if _, err := src.CreateTag("v1", first, nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, nil, Settings{
+		Archives: Archives{Dir: dir, Branches: []string{"*"}, Tags: []string{"*"}, Retention: time.Hour},
+	})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mustSync(t, c, r)
+	if _, err := Archive(t.Context(), c, r, start); err != nil {
+		t.Fatal(err)
+	}
+	second := commit(t, src, "a", "2")
+	mustSync(t, c, r)
+	if _, err := Archive(t.Context(), c, r, start.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := func(h plumbing.Hash) string {
+		return filepath.Join(dir, "r", "branches", "master-"+h.String()[:archiveHashLength]+".tar.gz")
+	}
+	tests := []struct {
+		path string
+		kept bool
+	}{
+		{path: snapshot(first)},
+		{path: snapshot(first) + ".sha256"},
+		{path: snapshot(second), kept: true},
+		{path: snapshot(second) + ".sha256", kept: true},
+		// the tags are never expired
+		{path: filepath.Join(dir, "r", "tags", "v1.tar.gz"), kept: true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(tt.path)
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s kept is %t, want %t", filepath.Base(tt.path), kept, tt.kept)
+		}
+	}
+}
+
+func TestArchiveLastSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"release-1-aaaaaaaaaaaa.tar.gz", "release-bbbbbbbbbbbb.zip", "release-notes.tar.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := Archives{Dir: dir}
+
+	tests := []struct {
+		name  string
+		path  string
+		found bool
+	}{
+		{name: "branch that is a prefix of another", path: "release-cccccccccccc.tar.gz"},
+		{name: "branch with a snapshot", path: "release-1-cccccccccccc.tar.gz", found: true},
+		{name: "branch with a snapshot in another format", path: "release-cccccccccccc.tar.gz"},
+		{name: "branch without snapshot", path: "main-cccccccccccc.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := a.lastSnapshot(filepath.Join(dir, tt.path))
+			if found != tt.found {
+				t.Fatalf("found is %t, want %t", found, tt.found)
+			}
+			if found && !got.Equal(at) {
+				t.Errorf("got %s, want %s", got, at)
+			}
+		})
+	}
+}
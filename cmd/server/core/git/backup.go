@@ -0,0 +1,239 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+type (
+	// BackupPolicy keeps the previous tip of the mirror refs that are
+	// rewritten or deleted, under refs/mirror-sync/backup/<timestamp>/ on
+	// the mirror itself.
+	BackupPolicy struct {
+		Enabled bool
+		// Retention is how long a backup is kept, 0 keeps them forever
+		Retention time.Duration
+	}
+
+	Backup struct {
+		Ref      plumbing.ReferenceName
+		Original plumbing.ReferenceName
+		Hash     plumbing.Hash
+		Time     time.Time
+	}
+)
+
+const (
+	backupNamespace  = "refs/mirror-sync/backup/"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+var (
+	ErrBackupNotFound error = errors.New("backup not found")
+	ErrMirrorNotFound error = errors.New("mirror not found")
+)
+
+// backupRefs pushes the current value of the given mirror refs to the backup
+// namespace of the mirror. The objects must be in the cache, see
+// fetchMirrorRefs.
+func backupRefs(ctx context.Context, dst *git.Remote, auth Authentication, current map[plumbing.ReferenceName]plumbing.Hash, names []plumbing.ReferenceName, at time.Time) error {
+	var specs []config.RefSpec
+	for _, name := range names {
+		h, ok := current[name]
+		if !ok {
+			continue
+		}
+		specs = append(specs, config.RefSpec("+"+h.String()+":"+backupRefName(name, at).String()))
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+
+	err := dst.PushContext(ctx, &git.PushOptions{
+		RemoteName: "anonymous",
+		Auth:       auth.Value(),
+		RefSpecs:   specs,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to backup mirror refs: %w", err)
+	}
+	return nil
+}
+
+// expireBackups deletes the backups of the mirror older than the retention.
+func expireBackups(ctx context.Context, dst *git.Remote, auth Authentication, current map[plumbing.ReferenceName]plumbing.Hash, retention time.Duration, now time.Time) error {
+	if retention <= 0 {
+		return nil
+	}
+
+	var expired []plumbing.ReferenceName
+	for _, b := range backups(current) {
+		if now.Sub(b.Time) > retention {
+			expired = append(expired, b.Ref)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	err := dst.PushContext(ctx, &git.PushOptions{
+		RemoteName: "anonymous",
+		Auth:       auth.Value(),
+		RefSpecs:   deleteRefSpecs(expired),
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to delete expired backups: %w", err)
+	}
+	return nil
+}
+
+func backupRefName(name plumbing.ReferenceName, at time.Time) plumbing.ReferenceName {
+	return plumbing.ReferenceName(backupNamespace + at.UTC().Format(backupTimeFormat) + "/" + name.String())
+}
+
+// backups parses the backup refs, the newest first.
+func backups(refs map[plumbing.ReferenceName]plumbing.Hash) []Backup {
+	var res []Backup
+	for name, h := range refs {
+		rest, ok := strings.CutPrefix(name.String(), backupNamespace)
+		if !ok {
+			continue
+		}
+		ts, original, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		at, err := time.Parse(backupTimeFormat, ts)
+		if err != nil {
+			continue
+		}
+		res = append(res, Backup{
+			Ref:      name,
+			Original: plumbing.ReferenceName(original),
+			Hash:     h,
+			Time:     at,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Time.Equal(res[j].Time) {
+			return res[i].Original < res[j].Original
+		}
+		return res[i].Time.After(res[j].Time)
+	})
+	return res
+}
+
+// Backups lists the backups stored on a mirror of the repository.
+func Backups(ctx context.Context, r Repository, mirror string) ([]Backup, error) {
+	m, err := r.mirror(mirror)
+	if err != nil {
+		return nil, err
+	}
+	// the bundles are snapshots, no ref is ever overwritten
+	if m.bundle != nil {
+		return nil, nil
+	}
+
+	dst := git.NewRemote(nil, &config.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{m.url},
+	})
+
+	current, err := remoteRefs(ctx, dst, m.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return backups(current), nil
+}
+
+// Restore puts a backed-up ref back on the mirror. The value that is
+// overwritten is backed up first.
+func Restore(ctx context.Context, c *Cache, r Repository, mirror string, backup plumbing.ReferenceName) (err error) {
+	m, err := r.mirror(mirror)
+	if err != nil {
+		return err
+	}
+	if m.bundle != nil {
+		return fmt.Errorf("%w: %s", ErrBackupNotFound, backup)
+	}
+
+	unlock := c.lock(r.name)
+	defer unlock()
+
+	repo, err := c.open(r.name)
+	if err != nil {
+		return err
+	}
+
+	dst, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name:  "anonymous",
+		URLs:  []string{m.url},
+		Fetch: []config.RefSpec{noTrackingRefSpec},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create remote: %w", err)
+	}
+
+	current, err := remoteRefs(ctx, dst, m.auth)
+	if err != nil {
+		return err
+	}
+
+	var b *Backup
+	for _, v := range backups(current) {
+		if v.Ref == backup {
+			b = &v
+			break
+		}
+	}
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrBackupNotFound, backup)
+	}
+
+	target := plumbing.NewHashReference(b.Original, b.Hash)
+	if err := fetchMirrorRefs(ctx, repo, dst, m.auth, current, []*plumbing.Reference{
+		plumbing.NewHashReference(b.Original, plumbing.ZeroHash),
+		plumbing.NewHashReference(b.Ref, plumbing.ZeroHash),
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, removeMirrorRefs(repo))
+	}()
+
+	if err := backupRefs(ctx, dst, m.auth, current, []plumbing.ReferenceName{b.Original}, time.Now()); err != nil {
+		return err
+	}
+
+	err = dst.PushContext(ctx, &git.PushOptions{
+		RemoteName: "anonymous",
+		Auth:       m.auth.Value(),
+		RefSpecs:   []config.RefSpec{config.RefSpec("+" + target.Hash().String() + ":" + target.Name().String())},
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to restore %s: %w", b.Original, err)
+	}
+
+	return nil
+}
+
+func (r Repository) mirror(name string) (Mirror, error) {
+	for _, m := range r.mirrors {
+		if m.name == name {
+			return m, nil
+		}
+	}
+	return Mirror{}, fmt.Errorf("%w: %s", ErrMirrorNotFound, name)
+}
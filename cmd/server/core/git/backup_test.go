@@ -0,0 +1,78 @@
+package git
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestBackups(t *testing.T) {
+	h := plumbing.NewHash("1111111111111111111111111111111111111111")
+	refs := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/main": h,
+		"refs/mirror-sync/backup/20250101T000000Z/refs/heads/main": h,
+		"refs/mirror-sync/backup/20250102T000000Z/refs/heads/main": h,
+		"refs/mirror-sync/backup/20250102T000000Z/refs/heads/dev":  h,
+		"refs/mirror-sync/backup/yesterday/refs/heads/main":        h,
+		"refs/mirror-sync/backup/20250101T000000Z":                 h,
+	}
+
+	want := []plumbing.ReferenceName{
+		"refs/mirror-sync/backup/20250102T000000Z/refs/heads/dev",
+		"refs/mirror-sync/backup/20250102T000000Z/refs/heads/main",
+		"refs/mirror-sync/backup/20250101T000000Z/refs/heads/main",
+	}
+	got := backups(refs)
+	if len(got) != len(want) {
+		t.Fatalf("got %d backups, want %d", len(got), len(want))
+	}
+	for i, b := range got {
+		if b.Ref != want[i] {
+			t.Errorf("backup %d is %s, want %s", i, b.Ref, want[i])
+		}
+	}
+	if got[2].Original != "refs/heads/main" || !got[2].Time.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %s at %s, want refs/heads/main at 2025-01-01", got[2].Original, got[2].Time)
+	}
+}
+
+func TestSyncBackupAndRestore(t *testing.T) {
+	branch := plumbing.NewBranchReferenceName("x")
+	src, srcPath := newBare(t)
+	mirror, mirrorPath := newBare(t)
+	h := newHistory(t, src, mirror)
+	setRef(t, src, branch, h.c1)
+	setRef(t, mirror, branch, h.c2)
+
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{
+		Mode:   ModeForce,
+		Backup: BackupPolicy{Enabled: true},
+	})
+	mustSync(t, c, r)
+
+	if got := refsOf(t, mirror)[branch]; got != h.c1 {
+		t.Fatalf("mirror ref is %s, want %s", got, h.c1)
+	}
+	list, err := Backups(t.Context(), r, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Original != branch || list[0].Hash != h.c2 {
+		t.Fatalf("got backups %v, want %s at %s", list, branch, h.c2)
+	}
+
+	if err := Restore(t.Context(), c, r, "m", list[0].Ref); err != nil {
+		t.Fatal(err)
+	}
+	assertNoMirrorRefs(t, c, "r")
+	if got := refsOf(t, mirror)[branch]; got != h.c2 {
+		t.Errorf("restored ref is %s, want %s", got, h.c2)
+	}
+
+	if err := Restore(t.Context(), c, r, "m", "refs/mirror-sync/backup/unknown"); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("got %v, want %s", err, ErrBackupNotFound)
+	}
+}
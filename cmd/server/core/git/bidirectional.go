@@ -0,0 +1,277 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+type (
+	// Direction tells which side of the sync is updated.
+	Direction string
+
+	// ConflictPolicy tells what to do with the refs that received commits
+	// on both the source and the mirror in bidirectional mode.
+	ConflictPolicy string
+
+	ConflictError struct {
+		Refs []Divergence
+	}
+)
+
+const (
+	// DirectionPush only updates the mirrors (default)
+	DirectionPush Direction = "push"
+	// DirectionBidirectional fast-forwards the source with the commits
+	// pushed to the mirrors too
+	DirectionBidirectional Direction = "bidirectional"
+)
+
+const (
+	// ConflictSourceWins overwrites the mirror ref with the source ref
+	ConflictSourceWins ConflictPolicy = "source-wins"
+	// ConflictMirrorWins overwrites the source ref with the mirror ref
+	ConflictMirrorWins ConflictPolicy = "mirror-wins"
+	// ConflictHalt leaves both refs untouched and reports them (default)
+	ConflictHalt ConflictPolicy = "halt-and-report"
+)
+
+var (
+	ErrConflict error = errors.New("source and mirror have both changed")
+)
+
+func (e *ConflictError) Error() string {
+	var refs []string
+	for _, d := range e.Refs {
+		refs = append(refs, d.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrConflict, strings.Join(refs, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// exchange syncs the cache with a mirror in both directions: the commits
+// of the mirror are pushed to the source first, then the cache is pushed to
+// the mirror. The cache is updated with what is pushed to the source so the
+// next mirrors get it. The held refs are left untouched on both sides, and
+// the mirror refs that fail the verification are not pushed to the source.
+func exchange(ctx context.Context, repo *git.Repository, r Repository, m Mirror, refs []*plumbing.Reference, held map[plumbing.ReferenceName]bool) (_ []Divergence, _ []Unverified, err error) {
+	s := r.settings
+
+	if err := m.checkPush(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	dst, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name:  "anonymous",
+		URLs:  []string{m.url},
+		Fetch: []config.RefSpec{noTrackingRefSpec},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create remote: %w", err)
+	}
+	src, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name:  "anonymous",
+		URLs:  []string{r.src},
+		Fetch: []config.RefSpec{noTrackingRefSpec},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create remote: %w", err)
+	}
+
+	current, err := remoteRefs(ctx, dst, m.auth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the refs are compared with their mirror name, origin gives their
+	// source name back
+	wanted, err := mapRefs(refs, s.Mappings)
+	if err != nil {
+		return nil, nil, err
+	}
+	origin := make(map[plumbing.ReferenceName]plumbing.ReferenceName, len(refs))
+	for i, ref := range refs {
+		origin[wanted[i].Name()] = ref.Name()
+	}
+	source := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+	for _, ref := range refs {
+		source[ref.Name()] = ref.Hash()
+	}
+
+	// the refs created on the mirror are created on the source too, the
+	// other refs than branches and tags only when explicitly included
+	for name := range current {
+		if _, ok := origin[name]; ok {
+			continue
+		}
+		if src, ok := unmapName(s.Mappings, name); ok && s.Refs.MatchExplicit(src) && !held[src] {
+			origin[name] = src
+			wanted = append(wanted, plumbing.NewHashReference(name, plumbing.ZeroHash))
+		}
+	}
+
+	defer func() {
+		err = errors.Join(err, removeMirrorRefs(repo))
+	}()
+	if err := fetchMirrorRefs(ctx, repo, dst, m.auth, current, wanted); err != nil {
+		return nil, nil, err
+	}
+
+	var toMirror, toSource []*plumbing.Reference
+	var rewritten, overwritten []plumbing.ReferenceName
+	var conflicts []Divergence
+	var unverified []Unverified
+	// pull adds a mirror ref to push to the source once verified
+	pull := func(src plumbing.ReferenceName, h plumbing.Hash) bool {
+		if s.Verify.enabled() {
+			if err := s.Verify.verify(repo, h); err != nil {
+				unverified = append(unverified, Unverified{Ref: src, Reason: "on mirror: " + err.Error()})
+				return false
+			}
+		}
+		toSource = append(toSource, plumbing.NewHashReference(src, h))
+		return true
+	}
+	for _, ref := range wanted {
+		name := ref.Name()
+		src := origin[name]
+		sh, onSource := source[src]
+		mh, onMirror := current[name]
+		switch {
+		case !onMirror:
+			toMirror = append(toMirror, ref)
+			continue
+		case !onSource:
+			pull(src, mh)
+			continue
+		case sh == mh:
+			continue
+		}
+
+		d, err := divergence(repo, name, mh, sh)
+		if err != nil {
+			return nil, nil, err
+		}
+		if d == nil {
+			toMirror = append(toMirror, ref)
+			continue
+		}
+		if back, err := divergence(repo, name, sh, mh); err != nil {
+			return nil, nil, err
+		} else if back == nil {
+			pull(src, mh)
+			continue
+		}
+
+		switch {
+		case s.Conflicts == ConflictSourceWins && !s.isProtected(name):
+			toMirror = append(toMirror, ref)
+			rewritten = append(rewritten, name)
+		case s.Conflicts == ConflictMirrorWins:
+			if pull(src, mh) {
+				overwritten = append(overwritten, src)
+			}
+		default:
+			conflicts = append(conflicts, *d)
+		}
+	}
+
+	if err := pushSource(ctx, repo, src, r, source, toSource, overwritten); err != nil {
+		return conflicts, unverified, err
+	}
+
+	if s.Backup.Enabled {
+		if err := backupRefs(ctx, dst, m.auth, current, rewritten, time.Now()); err != nil {
+			return conflicts, unverified, err
+		}
+	}
+
+	if len(toMirror) > 0 {
+		err = dst.PushContext(ctx, &git.PushOptions{
+			RemoteName: "anonymous",
+			Auth:       m.auth.Value(),
+			RefSpecs:   hashRefSpecs(toMirror, rewritten),
+			Options:    m.push.Options,
+			Atomic:     m.push.Atomic,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return conflicts, unverified, err
+		}
+	}
+
+	if s.Backup.Enabled {
+		if err := expireBackups(ctx, dst, m.auth, current, s.Backup.Retention, time.Now()); err != nil {
+			return conflicts, unverified, err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return conflicts, unverified, &ConflictError{Refs: conflicts}
+	}
+
+	return nil, unverified, nil
+}
+
+// pushSource updates the source with the mirror refs then records them in
+// the cache. The overwritten source refs are backed up on the source when
+// backups are enabled.
+func pushSource(ctx context.Context, repo *git.Repository, src *git.Remote, r Repository, source map[plumbing.ReferenceName]plumbing.Hash, refs []*plumbing.Reference, overwritten []plumbing.ReferenceName) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	if r.settings.Backup.Enabled {
+		if err := backupRefs(ctx, src, r.srcAuth, source, overwritten, time.Now()); err != nil {
+			return fmt.Errorf("failed to backup source refs: %w", err)
+		}
+	}
+
+	err := src.PushContext(ctx, &git.PushOptions{
+		RemoteName: "anonymous",
+		Auth:       r.srcAuth.Value(),
+		RefSpecs:   hashRefSpecs(refs, overwritten),
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push to source: %w", err)
+	}
+
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return fmt.Errorf("failed to update cached ref %s: %w", ref.Name(), err)
+		}
+	}
+	return nil
+}
+
+// hashRefSpecs pushes the refs by hash, only the forced refs may be
+// rewritten.
+func hashRefSpecs(refs []*plumbing.Reference, forced []plumbing.ReferenceName) []config.RefSpec {
+	force := make(map[plumbing.ReferenceName]bool, len(forced))
+	for _, name := range forced {
+		force[name] = true
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	specs := make([]config.RefSpec, 0, len(refs))
+	for _, ref := range refs {
+		prefix := ""
+		if force[ref.Name()] {
+			prefix = "+"
+		}
+		specs = append(specs, config.RefSpec(prefix+ref.Hash().String()+":"+ref.Name().String()))
+	}
+	return specs
+}
@@ -0,0 +1,202 @@
+package git
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestSyncBidirectional(t *testing.T) {
+	branch := plumbing.NewBranchReferenceName("x")
+
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		source   func(history) plumbing.Hash
+		mirror   func(history) plumbing.Hash
+		want     func(history) plumbing.Hash
+		conflict bool
+	}{
+		{
+			name:   "source ahead",
+			source: func(h history) plumbing.Hash { return h.c2 },
+			mirror: func(h history) plumbing.Hash { return h.c1 },
+			want:   func(h history) plumbing.Hash { return h.c2 },
+		},
+		{
+			name:   "mirror ahead",
+			source: func(h history) plumbing.Hash { return h.c1 },
+			mirror: func(h history) plumbing.Hash { return h.c2 },
+			want:   func(h history) plumbing.Hash { return h.c2 },
+		},
+		{
+			name:   "only on the mirror",
+			mirror: func(h history) plumbing.Hash { return h.c3 },
+			want:   func(h history) plumbing.Hash { return h.c3 },
+		},
+		{
+			name:     "conflict halted",
+			source:   func(h history) plumbing.Hash { return h.c2 },
+			mirror:   func(h history) plumbing.Hash { return h.c3 },
+			conflict: true,
+		},
+		{
+			name:   "conflict won by the source",
+			policy: ConflictSourceWins,
+			source: func(h history) plumbing.Hash { return h.c2 },
+			mirror: func(h history) plumbing.Hash { return h.c3 },
+			want:   func(h history) plumbing.Hash { return h.c2 },
+		},
+		{
+			name:   "conflict won by the mirror",
+			policy: ConflictMirrorWins,
+			source: func(h history) plumbing.Hash { return h.c2 },
+			mirror: func(h history) plumbing.Hash { return h.c3 },
+			want:   func(h history) plumbing.Hash { return h.c3 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcPath := newBare(t)
+			mirror, mirrorPath := newBare(t)
+			h := newHistory(t, src, mirror)
+			// the source needs a ref for the sync to push anything
+			setRef(t, src, plumbing.NewBranchReferenceName("main"), h.c1)
+			if tt.source != nil {
+				setRef(t, src, branch, tt.source(h))
+			}
+			if tt.mirror != nil {
+				setRef(t, mirror, branch, tt.mirror(h))
+			}
+
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{
+				Direction: DirectionBidirectional,
+				Conflicts: tt.policy,
+			})
+			c := newTestCache(t)
+			res, err := Sync(t.Context(), c, r)
+			assertNoMirrorRefs(t, c, "r")
+
+			if tt.conflict {
+				if !errors.Is(err, ErrConflict) {
+					t.Fatalf("got %v, want %s", err, ErrConflict)
+				}
+				if d := res.Mirrors[0].Diverged; len(d) != 1 || d[0].Ref != branch {
+					t.Errorf("got conflicts %v, want %s", d, branch)
+				}
+				if got := refsOf(t, src)[branch]; got != tt.source(h) {
+					t.Errorf("source ref is %s, want it untouched", got)
+				}
+				if got := refsOf(t, mirror)[branch]; got != tt.mirror(h) {
+					t.Errorf("mirror ref is %s, want it untouched", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want(h)
+			if got := refsOf(t, src)[branch]; got != want {
+				t.Errorf("source ref is %s, want %s", got, want)
+			}
+			if got := refsOf(t, mirror)[branch]; got != want {
+				t.Errorf("mirror ref is %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSyncBidirectionalBackups(t *testing.T) {
+	branch := plumbing.NewBranchReferenceName("x")
+
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		onSource bool
+	}{
+		{name: "source wins", policy: ConflictSourceWins},
+		{name: "mirror wins", policy: ConflictMirrorWins, onSource: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcPath := newBare(t)
+			mirror, mirrorPath := newBare(t)
+			h := newHistory(t, src, mirror)
+			setRef(t, src, branch, h.c2)
+			setRef(t, mirror, branch, h.c3)
+
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{
+				Direction: DirectionBidirectional,
+				Conflicts: tt.policy,
+				Backup:    BackupPolicy{Enabled: true},
+			})
+			mustSync(t, newTestCache(t), r)
+
+			// the overwritten ref is saved on its side only
+			overwritten, other, lost := mirror, src, h.c3
+			if tt.onSource {
+				overwritten, other, lost = src, mirror, h.c2
+			}
+			got := backups(refsOf(t, overwritten))
+			if len(got) != 1 || got[0].Original != branch || got[0].Hash != lost {
+				t.Errorf("got backups %v, want %s at %s", got, branch, lost)
+			}
+			if got := backups(refsOf(t, other)); len(got) != 0 {
+				t.Errorf("got backups %v on the side that was not overwritten", got)
+			}
+		})
+	}
+}
+
+func TestSyncBidirectionalForgeRefs(t *testing.T) {
+	pull := plumbing.ReferenceName("refs/pull/1/head")
+	notes := plumbing.ReferenceName("refs/notes/commits")
+	feature := plumbing.NewBranchReferenceName("feature")
+
+	tests := []struct {
+		name   string
+		others Patterns
+		want   []plumbing.ReferenceName
+		absent []plumbing.ReferenceName
+	}{
+		{name: "default filters", want: []plumbing.ReferenceName{feature}, absent: []plumbing.ReferenceName{pull, notes}},
+		{name: "included namespace", others: Patterns{Include: []string{"refs/notes/*"}}, want: []plumbing.ReferenceName{feature, notes}, absent: []plumbing.ReferenceName{pull}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcPath := newBare(t)
+			mirror, mirrorPath := newBare(t)
+			h := newHistory(t, src, mirror)
+			setRef(t, src, plumbing.NewBranchReferenceName("main"), h.c1)
+			for _, name := range []plumbing.ReferenceName{pull, notes, feature} {
+				setRef(t, mirror, name, h.c2)
+			}
+
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{
+				Refs:      NewRefFilter(Patterns{}, Patterns{}, tt.others),
+				Direction: DirectionBidirectional,
+			})
+			mustSync(t, newTestCache(t), r)
+
+			refs := refsOf(t, src)
+			for _, name := range tt.want {
+				if refs[name] != h.c2 {
+					t.Errorf("%s is %s on the source, want %s", name, refs[name], h.c2)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, ok := refs[name]; ok {
+					t.Errorf("%s was created on the source", name)
+				}
+				if refsOf(t, mirror)[name] != h.c2 {
+					t.Errorf("%s changed on the mirror", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
+)
+
+// Bundle writes a git bundle of the synced refs in a directory at every
+// sync, instead of pushing them to a server.
+type Bundle struct {
+	// Dir is the directory of the bundles, on the host of the daemon
+	Dir string
+	// Keep is the number of bundles kept, DefaultBundleKeep if 0 without
+	// retention
+	Keep int
+	// Retention deletes the bundles older than it, 0 keeps them
+	Retention time.Duration
+}
+
+const (
+	bundleHeader = "# v2 git bundle\n"
+	// bundleTimeFormat sorts the bundles of a repository by date
+	bundleTimeFormat = "20060102T150405Z"
+	// bundlePackWindow is the delta window of the packs, the one of git
+	bundlePackWindow = 10
+
+	// DefaultBundleKeep bounds the bundles of a repository when neither a
+	// count nor a retention is set
+	DefaultBundleKeep = 5
+)
+
+// NewBundleMirror makes a destination that writes bundles named
+// <repository>-<date>.bundle in the directory of b.
+func NewBundleMirror(name string, b Bundle) Mirror {
+	return Mirror{
+		name:   name,
+		url:    "bundle:" + b.Dir,
+		auth:   NoAuthentication{},
+		bundle: &b,
+	}
+}
+
+// writeBundle writes every ref in a new bundle, with their name on the
+// mirrors, then removes the bundles that are rotated out or expired. The
+// bundle is complete, it can be cloned without any other one. No bundle is
+// written when the refs are the ones of the latest bundle.
+func writeBundle(ctx context.Context, repo *git.Repository, name string, b Bundle, refs []*plumbing.Reference, s Settings, now time.Time) error {
+	// an empty source does not replace the previous bundles
+	if len(refs) == 0 {
+		return nil
+	}
+
+	refs, err := mapRefs(refs, s.Mappings)
+	if err != nil {
+		return err
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	header := bundleHeader
+	for _, ref := range refs {
+		header += fmt.Sprintf("%s %s\n", ref.Hash(), ref.Name())
+	}
+	header += "\n"
+
+	bundles, err := listBundles(b.Dir, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(bundles) > 0 {
+		latest, err := readBundleHeader(filepath.Join(b.Dir, bundles[0].name))
+		if err != nil {
+			return err
+		}
+		if latest == header {
+			return rotateBundles(b, name, now)
+		}
+	}
+
+	tips := make([]plumbing.Hash, 0, len(refs))
+	for _, ref := range refs {
+		tips = append(tips, ref.Hash())
+	}
+	objects, err := revlist.Objects(repo.Storer, tips, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list bundle objects: %w", err)
+	}
+
+	if err := os.MkdirAll(b.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	// the bundle is written next to its final path, a partial bundle is
+	// never rotated in
+	f, err := os.CreateTemp(b.Dir, ".tmp-*.bundle")
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	w := &contextWriter{ctx: ctx, w: f}
+	if _, err := io.WriteString(w, header); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if _, err := packfile.NewEncoder(w, repo.Storer, false).Encode(objects, bundlePackWindow); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	path := filepath.Join(b.Dir, bundleName(name, now))
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return rotateBundles(b, name, now)
+}
+
+// rotateBundles removes the bundles of the repository beyond the count to
+// keep and the ones older than the retention, the latest one is always kept.
+func rotateBundles(b Bundle, name string, now time.Time) error {
+	bundles, err := listBundles(b.Dir, name)
+	if err != nil {
+		return err
+	}
+
+	keep := b.Keep
+	if keep == 0 && b.Retention == 0 {
+		keep = DefaultBundleKeep
+	}
+	for i, bd := range bundles {
+		if i == 0 {
+			continue
+		}
+		rotated := keep > 0 && i >= keep
+		expired := b.Retention > 0 && now.Sub(bd.at) > b.Retention
+		if !rotated && !expired {
+			continue
+		}
+		if err := os.Remove(filepath.Join(b.Dir, bd.name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove bundle %s: %w", bd.name, err)
+		}
+	}
+	return nil
+}
+
+type bundleFile struct {
+	name string
+	at   time.Time
+}
+
+// listBundles returns the bundles of the repository, the latest first.
+func listBundles(dir, name string) ([]bundleFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundles: %w", err)
+	}
+
+	var bundles []bundleFile
+	for _, e := range entries {
+		if at, ok := bundleTime(name, e.Name()); ok && !e.IsDir() {
+			bundles = append(bundles, bundleFile{name: e.Name(), at: at})
+		}
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].at.After(bundles[j].at)
+	})
+	return bundles, nil
+}
+
+// readBundleHeader returns the header of a bundle, its refs up to the
+// empty line that starts the pack.
+func readBundleHeader(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle: %w", err)
+	}
+	defer f.Close()
+
+	var header strings.Builder
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// a truncated bundle is replaced
+			return "", nil
+		}
+		header.WriteString(line)
+		if line == "\n" {
+			return header.String(), nil
+		}
+	}
+}
+
+func bundleName(repository string, at time.Time) string {
+	return fmt.Sprintf("%s-%s.bundle", repository, at.UTC().Format(bundleTimeFormat))
+}
+
+// bundleTime reads the date of a bundle of the repository, false for the
+// other files of the directory.
+func bundleTime(repository, file string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(file, repository+"-")
+	if !ok {
+		return time.Time{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, ".bundle")
+	if !ok {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(bundleTimeFormat, rest)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// contextWriter stops a long write when the sync is canceled.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
@@ -0,0 +1,120 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestWriteBundleRotation(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		keep      int
+		retention time.Duration
+		// kept are the hours after start of the remaining bundles
+		kept []int
+	}{
+		{name: "default count", kept: []int{6, 5, 4, 3, 2}},
+		{name: "count", keep: 2, kept: []int{6, 5}},
+		{name: "retention", retention: 150 * time.Minute, kept: []int{6, 5, 4}},
+		{name: "count and retention", keep: 2, retention: 150 * time.Minute, kept: []int{6, 5}},
+		{name: "retention shorter than the syncs", retention: time.Minute, kept: []int{6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newBare(t)
+			dir := t.TempDir()
+			// the bundles of another repository are left alone
+			other := filepath.Join(dir, bundleName("r-other", start))
+			if err := os.WriteFile(other, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			b := Bundle{Dir: dir, Keep: tt.keep, Retention: tt.retention}
+			var parent []plumbing.Hash
+			for i := range 7 {
+				h := newCommit(t, repo, "c", parent...)
+				parent = []plumbing.Hash{h}
+				refs := []*plumbing.Reference{plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), h)}
+				at := start.Add(time.Duration(i) * time.Hour)
+				if err := writeBundle(t.Context(), repo, "r", b, refs, Settings{}, at); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want []string
+			for _, h := range tt.kept {
+				want = append(want, bundleName("r", start.Add(time.Duration(h)*time.Hour)))
+			}
+			if got := bundleNames(t, dir, "r"); !slices.Equal(got, want) {
+				t.Errorf("got bundles %v, want %v", got, want)
+			}
+			if _, err := os.Stat(other); err != nil {
+				t.Errorf("bundle of another repository removed: %s", err)
+			}
+		})
+	}
+}
+
+func TestWriteBundleUnchanged(t *testing.T) {
+	repo, _ := newBare(t)
+	dir := t.TempDir()
+	refs := []*plumbing.Reference{plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), newCommit(t, repo, "c1"))}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 3 {
+		if err := writeBundle(t.Context(), repo, "r", Bundle{Dir: dir}, refs, Settings{}, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := bundleNames(t, dir, "r"), []string{bundleName("r", start)}; !slices.Equal(got, want) {
+		t.Errorf("got bundles %v, want %v", got, want)
+	}
+}
+
+func TestSyncBundleMirror(t *testing.T) {
+	src, srcPath := newSource(t)
+	h := commit(t, src, "a", "1")
+	dir := filepath.Join(t.TempDir(), "bundles")
+
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewBundleMirror("b", Bundle{Dir: dir})}, Settings{
+		Mappings: []Mapping{{From: "refs/heads/*", To: "refs/heads/mirror/*"}},
+	})
+	res := mustSync(t, newTestCache(t), r)
+	if m := res.Mirrors[0]; m.Err != nil || m.Checked {
+		t.Errorf("got error %v and checked %t, want no error and no check", m.Err, m.Checked)
+	}
+
+	names := bundleNames(t, dir, "r")
+	if len(names) != 1 {
+		t.Fatalf("got bundles %v, want one", names)
+	}
+	header, err := readBundleHeader(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bundleHeader + h.String() + " refs/heads/mirror/master\n\n"; header != want {
+		t.Errorf("got header %q, want %q", header, want)
+	}
+}
+
+func bundleNames(t *testing.T, dir, name string) []string {
+	t.Helper()
+	bundles, err := listBundles(dir, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range bundles {
+		names = append(names, b.name)
+	}
+	return names
+}
@@ -0,0 +1,195 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+type (
+	// Cache keeps a bare copy of every synced repository on disk, so a sync
+	// only has to fetch the objects that changed since the previous run.
+	Cache struct {
+		path    string
+		maxSize int64
+
+		mu    sync.Mutex
+		locks map[string]*sync.Mutex
+	}
+)
+
+var (
+	ErrCacheCorrupted error = errors.New("repository cache is corrupted")
+)
+
+// NewCache makes sure the cache folder exists. A maxSize of 0 disables the
+// per-repository size limit.
+func NewCache(path string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory (%s): %w", path, err)
+	}
+
+	return &Cache{
+		path:    path,
+		maxSize: maxSize,
+		locks:   make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// lock prevents two syncs from using the same cache entry at the same time.
+// The returned function releases the lock.
+func (c *Cache) lock(name string) func() {
+	c.mu.Lock()
+	l, ok := c.locks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[name] = l
+	}
+	c.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// dir escapes the name of the entry, the names that only differ by their
+// separators ("a/b" and "a_b") get their own entry.
+func (c *Cache) dir(name string) string {
+	return filepath.Join(c.path, url.PathEscape(name)+".git")
+}
+
+// open returns the cached bare repository, creating it when missing. A cache
+// entry that cannot be read anymore is wiped and initialized again, the next
+// fetch will then download the whole repository.
+func (c *Cache) open(name string) (*git.Repository, error) {
+	path := c.dir(name)
+
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.init(path)
+		}
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	repo, err := git.PlainOpen(path)
+	if err == nil {
+		err = check(repo)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("[%s] cache entry is unusable, recreating it: %s", name, err))
+		if err := os.RemoveAll(path); err != nil {
+			return nil, fmt.Errorf("failed to remove corrupted cache entry: %w", err)
+		}
+		return c.init(path)
+	}
+
+	return repo, nil
+}
+
+func (c *Cache) init(path string) (*git.Repository, error) {
+	repo, err := git.PlainInit(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cache entry: %w", err)
+	}
+	return repo, nil
+}
+
+// invalidate removes the cache entry, the next sync starts from scratch.
+func (c *Cache) invalidate(name string) error {
+	if err := os.RemoveAll(c.dir(name)); err != nil {
+		return fmt.Errorf("failed to remove cache entry: %w", err)
+	}
+	return nil
+}
+
+// checkSize refuses to let an entry that exceeds the size limit grow, the
+// entry is kept so it does not have to be fetched again once the limit is
+// raised.
+func (c *Cache) checkSize(name string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	size, err := c.size(name)
+	if err != nil {
+		return err
+	}
+	if size > c.maxSize {
+		return &LimitError{Limit: LimitCacheSize, Value: size, Max: c.maxSize}
+	}
+	return nil
+}
+
+// compact repacks the entry when it exceeds the size limit, the packs of
+// the previous fetches and the objects that are not referenced anymore are
+// merged into a single pack. The entry still exceeding the limit is
+// reported, the next syncs refuse to fetch into it.
+func (c *Cache) compact(name string, repo *git.Repository) error {
+	if err := c.checkSize(name); !errors.Is(err, ErrLimitExceeded) {
+		return err
+	}
+
+	if err := repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		return fmt.Errorf("failed to repack cache entry: %w", err)
+	}
+	if err := c.checkSize(name); err != nil {
+		return fmt.Errorf("cache entry is full, the next syncs will not fetch: %w", err)
+	}
+	return nil
+}
+
+// size is the size of the git objects of the entry. The LFS objects are not
+// counted, a repository with large LFS content would otherwise be dropped
+// and fetched again on every sync.
+func (c *Cache) size(name string) (int64, error) {
+	var size int64
+	lfs := filepath.Join(c.dir(name), "lfs")
+	err := filepath.WalkDir(c.dir(name), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == lfs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute cache entry size: %w", err)
+	}
+	return size, nil
+}
+
+// check makes sure every reference of the cache points to an object that
+// is still in the object database.
+func check(repo *git.Repository) error {
+	refs, err := repo.References()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCacheCorrupted, err)
+	}
+	defer refs.Close()
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if err := repo.Storer.HasEncodedObject(ref.Hash()); err != nil {
+			return fmt.Errorf("%w: %s points to a missing object (%s)", ErrCacheCorrupted, ref.Name(), ref.Hash())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,244 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestSyncFetchesIncrementally(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+	mirror, mirrorPath := newBare(t)
+
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{})
+	mustSync(t, c, r)
+
+	// the entry is reused by the next sync, not created again
+	marker := filepath.Join(c.dir("r"), "marker")
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	packs := packCount(t, c, "r")
+
+	second := commit(t, src, "a", "2")
+	mustSync(t, c, r)
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("cache entry was recreated: %s", err)
+	}
+	if n := packCount(t, c, "r"); n != packs+1 {
+		t.Errorf("got %d packs after the second fetch, want %d", n, packs+1)
+	}
+	if got := refsOf(t, mirror)[plumbing.NewBranchReferenceName("master")]; got != second {
+		t.Errorf("mirror master is %s, want %s", got, second)
+	}
+}
+
+func TestSyncInvalidatesShallowCache(t *testing.T) {
+	src, srcPath := newSource(t)
+	var boundary plumbing.Hash
+	for _, content := range []string{"1", "2", "3"} {
+		boundary = commit(t, src, "a", content)
+	}
+
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, nil, Settings{})
+	mustSync(t, c, r)
+
+	// the local transport ignores the depth, the cache is made shallow
+	// like a fetch with a depth of 1 would
+	if err := openCache(t, c, "r").Storer.SetShallow([]plumbing.Hash{boundary}); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(c.dir("r"), "marker")
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mustSync(t, c, r)
+
+	repo := openCache(t, c, "r")
+	if shallows, _ := repo.Storer.Shallow(); len(shallows) > 0 {
+		t.Errorf("cache is still shallow: %v", shallows)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("shallow cache entry was not recreated")
+	}
+	if n := countCommits(t, repo); n != 3 {
+		t.Errorf("cache has %d commits, want 3", n)
+	}
+}
+
+func TestCacheOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt bool
+		kept    bool
+	}{
+		{name: "valid entry is kept", kept: true},
+		{name: "ref to a missing object recreates the entry", corrupt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t)
+			repo, err := c.open("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.corrupt {
+				setRef(t, repo, plumbing.NewBranchReferenceName("main"), plumbing.NewHash("1111111111111111111111111111111111111111"))
+			} else {
+				src, srcPath := newSource(t)
+				commit(t, src, "a", "1")
+				_, mirrorPath := newBare(t)
+				mustSync(t, c, NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{}))
+			}
+
+			repo, err = c.open("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			refs := refsOf(t, repo)
+			if kept := len(refs) > 0; kept != tt.kept {
+				t.Errorf("entry kept is %t, want %t: %v", kept, tt.kept, refs)
+			}
+		})
+	}
+}
+
+func TestCacheSizeLimit(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		full    bool
+	}{
+		{name: "no limit", maxSize: 0},
+		{name: "under the limit", maxSize: 1 << 30},
+		{name: "over the limit", maxSize: 1, full: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCache(t.TempDir(), tt.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, mirrorPath := newBare(t)
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{})
+			if _, err := Sync(t.Context(), c, r); errors.Is(err, ErrLimitExceeded) != tt.full {
+				t.Fatalf("got %v, want full %t", err, tt.full)
+			}
+			if _, err := os.Stat(c.dir("r")); err != nil {
+				t.Fatalf("entry was dropped: %s", err)
+			}
+
+			// a full entry does not fetch the new commits
+			head := commit(t, src, "a", tt.name)
+			if _, err := Sync(t.Context(), c, r); errors.Is(err, ErrLimitExceeded) != tt.full {
+				t.Fatalf("got %v, want full %t", err, tt.full)
+			}
+			fetched := refsOf(t, openCache(t, c, "r"))[plumbing.NewBranchReferenceName("master")] == head
+			if fetched == tt.full {
+				t.Errorf("new commit fetched is %t, want %t", fetched, !tt.full)
+			}
+		})
+	}
+}
+
+func TestCacheCompact(t *testing.T) {
+	src, srcPath := newSource(t)
+	_, mirrorPath := newBare(t)
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{})
+	for _, content := range []string{"1", "2", "3"} {
+		commit(t, src, "a", content)
+		mustSync(t, c, r)
+	}
+	size, err := c.size("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the packs of the three fetches fit in the limit once merged
+	c.maxSize = size - 1
+	if err := c.compact("r", openCache(t, c, "r")); err != nil {
+		t.Fatal(err)
+	}
+	if n := packCount(t, c, "r"); n != 1 {
+		t.Errorf("got %d packs, want 1", n)
+	}
+	if n := countCommits(t, openCache(t, c, "r")); n != 3 {
+		t.Errorf("cache has %d commits, want 3", n)
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	c := newTestCache(t)
+	names := []string{"a/b", "a_b", `a\\b`, "a%2Fb"}
+	dirs := make(map[string]string)
+	for _, name := range names {
+		dir := c.dir(name)
+		if filepath.Dir(dir) != c.path {
+			t.Errorf("entry of %q is outside of the cache: %s", name, dir)
+		}
+		if other, ok := dirs[dir]; ok {
+			t.Errorf("%q and %q share the entry %s", name, other, dir)
+		}
+		dirs[dir] = name
+	}
+}
+
+func TestCacheSizeIgnoresLFS(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+	c := newTestCache(t)
+	mustSync(t, c, NewRepository("r", srcPath, NoAuthentication{}, nil, Settings{}))
+
+	before, err := c.size("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, 1<<20)
+	p := lfsPointer{oid: sha256Hex(content), size: int64(len(content))}
+	if err := writeLFSObject(bytes.NewReader(content), c.dir("r"), p); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := c.size("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("got %d bytes with the lfs object, want %d", after, before)
+	}
+}
+
+func openCache(t *testing.T, c *Cache, name string) *git.Repository {
+	t.Helper()
+	repo, err := git.PlainOpen(c.dir(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func packCount(t *testing.T, c *Cache, name string) int {
+	t.Helper()
+	packs, err := filepath.Glob(filepath.Join(c.dir(name), "objects", "pack", "*.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(packs)
+}
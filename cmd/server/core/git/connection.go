@@ -0,0 +1,265 @@
+package git
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/storage"
+	"golang.org/x/net/proxy"
+)
+
+type (
+	// Connection are the TLS and proxy settings of a remote.
+	Connection struct {
+		// CABundle are PEM certificates trusted on top of the system ones
+		CABundle []byte
+		// InsecureSkipVerify turns the verification of the server
+		// certificates off or back on, nil keeps the default
+		InsecureSkipVerify *bool
+		// ClientCert and ClientKey are the PEM certificate and key sent to
+		// the servers that require mTLS
+		ClientCert []byte
+		ClientKey  []byte
+		// Proxy is an http://, https:// or socks5:// url, ssh remotes can
+		// only go through socks5
+		Proxy string
+		// NoProxy are the hosts reached directly: names, domains starting
+		// with a '.', IP addresses, CIDR ranges or "*". It only applies to
+		// Proxy, the remotes without it already connect directly.
+		NoProxy []string
+	}
+
+	// ConnectionAuthentication sends the credentials of a remote with its
+	// own connection settings.
+	ConnectionAuthentication struct {
+		Authentication
+		conn   Connection
+		client *http.Client
+	}
+
+	// connectionAuthMethod carries the connection settings down to
+	// connectionTransport, which unwraps the credentials
+	connectionAuthMethod struct {
+		auth   transport.AuthMethod
+		conn   Connection
+		client *http.Client
+	}
+
+	connectionTransport struct {
+		next transport.Transport
+	}
+)
+
+// registerTransports wraps the go-git transports, once and only when a
+// remote has connection settings. The remotes without them go through the
+// wrapped transports as they are.
+var registerTransports = sync.OnceFunc(func() {
+	for _, p := range []string{"http", "https", "ssh", "git", "file"} {
+		if next, err := transport.Get(p); err == nil {
+			transport.Register(p, connectionTransport{next: next})
+		}
+	}
+})
+
+// WithConnection makes the remote of the credentials use the connection
+// settings, auth is returned as is when there are none. The certificates are
+// parsed once.
+func WithConnection(auth Authentication, conn Connection) (Authentication, error) {
+	if conn.empty() {
+		return auth, nil
+	}
+	registerTransports()
+
+	config := &tls.Config{
+		InsecureSkipVerify: conn.insecure(),
+	}
+	if len(conn.CABundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(conn.CABundle) {
+			return nil, fmt.Errorf("no certificate found in ca bundle")
+		}
+		config.RootCAs = pool
+	}
+	if len(conn.ClientCert) > 0 || len(conn.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(conn.ClientCert, conn.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = config
+	if len(conn.Proxy) > 0 {
+		u, err := url.Parse(conn.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		tr.Proxy = func(r *http.Request) (*url.URL, error) {
+			if conn.direct(r.URL.Hostname()) {
+				return nil, nil
+			}
+			return u, nil
+		}
+	}
+
+	return ConnectionAuthentication{
+		Authentication: auth,
+		conn:           conn,
+		client:         &http.Client{Transport: tr},
+	}, nil
+}
+
+// Override returns the settings of c replaced with the ones set in o, the ca
+// bundles of both are trusted.
+func (c Connection) Override(o Connection) Connection {
+	if len(o.CABundle) > 0 {
+		c.CABundle = append(append(slices.Clone(c.CABundle), '\n'), o.CABundle...)
+	}
+	if o.InsecureSkipVerify != nil {
+		c.InsecureSkipVerify = o.InsecureSkipVerify
+	}
+	if len(o.ClientCert) > 0 {
+		c.ClientCert = o.ClientCert
+		c.ClientKey = o.ClientKey
+	}
+	if len(o.Proxy) > 0 {
+		c.Proxy = o.Proxy
+	}
+	if len(o.NoProxy) > 0 {
+		c.NoProxy = o.NoProxy
+	}
+	return c
+}
+
+// empty tells if the settings change nothing, NoProxy is left out as it
+// only applies to Proxy.
+func (c Connection) empty() bool {
+	return len(c.CABundle) == 0 && !c.insecure() && len(c.ClientCert) == 0 && len(c.Proxy) == 0
+}
+
+func (c Connection) insecure() bool {
+	return c.InsecureSkipVerify != nil && *c.InsecureSkipVerify
+}
+
+func (a ConnectionAuthentication) Value() transport.AuthMethod {
+	return &connectionAuthMethod{
+		auth:   a.Authentication.Value(),
+		conn:   a.conn,
+		client: a.client,
+	}
+}
+
+func (m *connectionAuthMethod) Name() string {
+	if m.auth == nil {
+		return "connection"
+	}
+	return m.auth.Name()
+}
+
+func (m *connectionAuthMethod) String() string {
+	if m.auth == nil {
+		return "connection"
+	}
+	return m.auth.String()
+}
+
+func (t connectionTransport) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	m, ok := auth.(*connectionAuthMethod)
+	if !ok {
+		return t.next.NewSession(st, ep, auth)
+	}
+
+	switch ep.Protocol {
+	case "http", "https":
+		return githttp.NewTransport(&githttp.TransportOptions{Client: m.client}).NewSession(st, ep, m.auth)
+	default:
+		e := *ep
+		if p := m.conn.proxy(ep.Host); len(p) > 0 {
+			e.Proxy = transport.ProxyOptions{URL: p}
+		}
+		return t.next.NewSession(st, &e, m.auth)
+	}
+}
+
+func (t connectionTransport) SupportedProtocols() []protocol.Version {
+	return t.next.SupportedProtocols()
+}
+
+// proxy returns the proxy to reach the host, empty to connect directly.
+func (c Connection) proxy(host string) string {
+	if len(c.Proxy) == 0 || c.direct(host) {
+		return ""
+	}
+	return c.Proxy
+}
+
+// direct tells if the host is in the no-proxy list.
+func (c Connection) direct(host string) bool {
+	ip := net.ParseIP(host)
+	for _, entry := range c.NoProxy {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(entry, "."):
+			if h := strings.ToLower(host); strings.HasSuffix(h, strings.ToLower(entry)) || strings.EqualFold(host, entry[1:]) {
+				return true
+			}
+		case strings.EqualFold(entry, host):
+			return true
+		}
+	}
+	return false
+}
+
+// connection returns the credentials, the http client and the dialer of a
+// remote, for the requests that are not made by go-git.
+func connection(auth Authentication) (Authentication, *http.Client, func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	a, ok := auth.(ConnectionAuthentication)
+	if !ok {
+		var d net.Dialer
+		return auth, http.DefaultClient, d.DialContext
+	}
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(addr)
+		p := a.conn.proxy(host)
+		if len(p) == 0 {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+		u, err := url.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		dialer, err := proxy.FromURL(u, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported proxy %s", u.Scheme)
+		}
+		return cd.DialContext(ctx, network, addr)
+	}
+	return a.Authentication, a.client, dial
+}
@@ -0,0 +1,202 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectionDirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		noProxy []string
+		host    string
+		direct  bool
+	}{
+		{name: "empty list", host: "git.example.com"},
+		{name: "wildcard", noProxy: []string{"*"}, host: "git.example.com", direct: true},
+		{name: "same host", noProxy: []string{"git.example.com"}, host: "git.example.com", direct: true},
+		{name: "same host in another case", noProxy: []string{"Git.Example.com"}, host: "git.example.com", direct: true},
+		{name: "subdomain of a host", noProxy: []string{"example.com"}, host: "git.example.com"},
+		{name: "domain suffix", noProxy: []string{".example.com"}, host: "git.example.com", direct: true},
+		{name: "domain suffix in another case", noProxy: []string{".Example.COM"}, host: "git.example.com", direct: true},
+		{name: "domain itself", noProxy: []string{".example.com"}, host: "example.com", direct: true},
+		{name: "partial label", noProxy: []string{".example.com"}, host: "gitexample.com"},
+		{name: "spaces around the entry", noProxy: []string{" git.example.com "}, host: "git.example.com", direct: true},
+		{name: "ip address", noProxy: []string{"192.0.2.1"}, host: "192.0.2.1", direct: true},
+		{name: "ip in a range", noProxy: []string{"10.0.0.0/8"}, host: "10.1.2.3", direct: true},
+		{name: "ip outside a range", noProxy: []string{"10.0.0.0/8"}, host: "192.0.2.1"},
+		{name: "name against a range", noProxy: []string{"10.0.0.0/8"}, host: "git.example.com"},
+		{name: "second entry", noProxy: []string{"other.example.org", ".example.com"}, host: "git.example.com", direct: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Connection{Proxy: "http://proxy.example.com:3128", NoProxy: tt.noProxy}
+			if got := c.direct(tt.host); got != tt.direct {
+				t.Errorf("direct is %t, want %t", got, tt.direct)
+			}
+			want := c.Proxy
+			if tt.direct {
+				want = ""
+			}
+			if got := c.proxy(tt.host); got != want {
+				t.Errorf("proxy is %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+var yes, no = true, false
+
+func TestWithConnection(t *testing.T) {
+	ca, _ := newCertificate(t)
+	cert, key := newCertificate(t)
+	_, otherKey := newCertificate(t)
+
+	tests := []struct {
+		name    string
+		conn    Connection
+		wrapped bool
+		invalid bool
+	}{
+		{name: "no settings"},
+		{name: "ca bundle", conn: Connection{CABundle: ca}, wrapped: true},
+		{name: "ca bundle without certificate", conn: Connection{CABundle: []byte("not a certificate")}, invalid: true},
+		{name: "client certificate", conn: Connection{ClientCert: cert, ClientKey: key}, wrapped: true},
+		{name: "client certificate of another key", conn: Connection{ClientCert: cert, ClientKey: otherKey}, invalid: true},
+		{name: "client certificate without key", conn: Connection{ClientCert: cert}, invalid: true},
+		{name: "proxy", conn: Connection{Proxy: "socks5://proxy.example.com:1080"}, wrapped: true},
+		{name: "invalid proxy", conn: Connection{Proxy: "http://proxy.example.com:port"}, invalid: true},
+		{name: "insecure", conn: Connection{InsecureSkipVerify: &yes}, wrapped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := WithConnection(NoAuthentication{}, tt.conn)
+			if tt.invalid {
+				if err == nil {
+					t.Error("invalid settings accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, wrapped := auth.(ConnectionAuthentication); wrapped != tt.wrapped {
+				t.Errorf("wrapped is %t, want %t", wrapped, tt.wrapped)
+			}
+		})
+	}
+}
+
+func TestWithConnectionTLS(t *testing.T) {
+	clientCert, clientKey := newCertificate(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	tests := []struct {
+		name   string
+		conn   Connection
+		status int
+	}{
+		{name: "unknown authority", conn: Connection{}},
+		{name: "trusted authority", conn: Connection{CABundle: serverCA}, status: http.StatusUnauthorized},
+		// the proxy does not listen, the server is only reached directly
+		{name: "host without proxy", conn: Connection{CABundle: serverCA, Proxy: "http://127.0.0.1:1", NoProxy: []string{"127.0.0.1"}}, status: http.StatusUnauthorized},
+		{name: "client certificate", conn: Connection{CABundle: serverCA, ClientCert: clientCert, ClientKey: clientKey}, status: http.StatusOK},
+		{name: "insecure", conn: Connection{InsecureSkipVerify: &yes}, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := WithConnection(NoAuthentication{}, tt.conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, client, _ := connection(auth)
+			res, err := client.Get(srv.URL)
+			if tt.status == 0 {
+				if err == nil {
+					res.Body.Close()
+					t.Error("server of an unknown authority accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.status {
+				t.Errorf("got %s, want %d", res.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestConnectionOverride(t *testing.T) {
+	defaults := Connection{CABundle: []byte("a"), Proxy: "http://proxy", NoProxy: []string{"*"}}
+	got := defaults.Override(Connection{CABundle: []byte("b"), NoProxy: []string{".example.com"}})
+
+	if string(got.CABundle) != "a\nb" {
+		t.Errorf("ca bundle is %q, want both bundles", got.CABundle)
+	}
+	if got.Proxy != "http://proxy" {
+		t.Errorf("proxy is %q, want the default one", got.Proxy)
+	}
+	if len(got.NoProxy) != 1 || got.NoProxy[0] != ".example.com" {
+		t.Errorf("no proxy is %v, want the one of the remote", got.NoProxy)
+	}
+
+	insecure := defaults.Override(Connection{InsecureSkipVerify: &yes})
+	if !insecure.insecure() {
+		t.Error("remote cannot turn the verification off")
+	}
+	if insecure.Override(Connection{}).insecure() != true {
+		t.Error("unset value of the remote overrides the default")
+	}
+	if insecure.Override(Connection{InsecureSkipVerify: &no}).insecure() {
+		t.Error("remote cannot turn the verification back on")
+	}
+}
+
+// newCertificate returns a self-signed PEM certificate and its key.
+func newCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
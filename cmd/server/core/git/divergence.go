@@ -0,0 +1,303 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+type (
+	// Mode tells what to do with the mirror refs that are not an ancestor
+	// of the source refs.
+	Mode string
+
+	// Divergence is a mirror ref that cannot be fast-forwarded to the
+	// source ref.
+	Divergence struct {
+		Ref plumbing.ReferenceName
+		// Ahead is the number of commits that are only on the mirror
+		Ahead int
+		// Behind is the number of commits that are only on the source
+		Behind int
+	}
+
+	DivergedError struct {
+		Refs []Divergence
+	}
+)
+
+const (
+	// ModeForce overwrites the mirror refs (default)
+	ModeForce Mode = "force"
+	// ModeSafe only creates and fast-forwards the mirror refs
+	ModeSafe Mode = "safe"
+)
+
+// mirrorRefsNamespace is where the refs of a mirror are fetched to compare
+// them with the source, they are removed once the push is done.
+const mirrorRefsNamespace = "refs/mirror-sync/mirror/"
+
+var (
+	ErrDiverged error = errors.New("mirror has diverged from source")
+)
+
+func (e *DivergedError) Error() string {
+	var refs []string
+	for _, d := range e.Refs {
+		refs = append(refs, d.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrDiverged, strings.Join(refs, ", "))
+}
+
+func (e *DivergedError) Unwrap() error {
+	return ErrDiverged
+}
+
+func (d Divergence) String() string {
+	if d.Ahead < 0 {
+		return fmt.Sprintf("%s (not a commit)", d.Ref)
+	}
+	return fmt.Sprintf("%s (mirror is %d commits ahead, %d behind)", d.Ref, d.Ahead, d.Behind)
+}
+
+// remoteRefs lists the refs of the remote, an empty repository has no refs.
+func remoteRefs(ctx context.Context, remote *git.Remote, auth Authentication) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth:          auth.Value(),
+		PeelingOption: git.IgnorePeeled,
+	})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil, fmt.Errorf("failed to list mirror refs: %w", err)
+	}
+
+	res := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			res[ref.Name()] = ref.Hash()
+		}
+	}
+	return res, nil
+}
+
+// mirrorRefs lists the refs of a mirror.
+func mirrorRefs(ctx context.Context, repo *git.Repository, m Mirror) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	dst, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{m.url},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote: %w", err)
+	}
+	return remoteRefs(ctx, dst, m.auth)
+}
+
+// fetchMirrorRefs downloads the mirror refs whose objects are not in the
+// cache yet, so they can be compared with the source.
+func fetchMirrorRefs(ctx context.Context, repo *git.Repository, remote *git.Remote, auth Authentication, current map[plumbing.ReferenceName]plumbing.Hash, refs []*plumbing.Reference) error {
+	var specs []config.RefSpec
+	for _, ref := range refs {
+		h, ok := current[ref.Name()]
+		if !ok || h == ref.Hash() {
+			continue
+		}
+		if err := repo.Storer.HasEncodedObject(h); err == nil {
+			continue
+		}
+		specs = append(specs, config.RefSpec("+"+ref.Name().String()+":"+mirrorRefsNamespace+ref.Name().String()))
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+
+	err := remote.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "anonymous",
+		Auth:       auth.Value(),
+		RefSpecs:   specs,
+		Tags:       git.NoTags,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch mirror refs: %w", err)
+	}
+	return nil
+}
+
+// removeMirrorRefs deletes the refs written by fetchMirrorRefs.
+func removeMirrorRefs(repo *git.Repository) error {
+	refs, err := localRefs(repo)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Name().String(), mirrorRefsNamespace) {
+			continue
+		}
+		if err := repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return fmt.Errorf("failed to remove ref %s: %w", ref.Name(), err)
+		}
+	}
+	return nil
+}
+
+// fastForwards splits the refs between the ones that can be pushed without
+// losing any commit of the mirror and the ones that diverged.
+func fastForwards(repo *git.Repository, current map[plumbing.ReferenceName]plumbing.Hash, refs []*plumbing.Reference) ([]*plumbing.Reference, []Divergence, error) {
+	var ok []*plumbing.Reference
+	var diverged []Divergence
+	for _, ref := range refs {
+		h, exists := current[ref.Name()]
+		if !exists || h == ref.Hash() {
+			ok = append(ok, ref)
+			continue
+		}
+
+		d, err := divergence(repo, ref.Name(), h, ref.Hash())
+		if err != nil {
+			return nil, nil, err
+		}
+		if d == nil {
+			ok = append(ok, ref)
+			continue
+		}
+		diverged = append(diverged, *d)
+	}
+	return ok, diverged, nil
+}
+
+// divergence returns nil when the mirror commit is an ancestor of the
+// source commit.
+func divergence(repo *git.Repository, name plumbing.ReferenceName, mirror, source plumbing.Hash) (*Divergence, error) {
+	mc, err := peel(repo, mirror)
+	if err != nil {
+		return &Divergence{Ref: name, Ahead: -1, Behind: -1}, nil
+	}
+	sc, err := peel(repo, source)
+	if err != nil {
+		return &Divergence{Ref: name, Ahead: -1, Behind: -1}, nil
+	}
+
+	if mc.Hash == sc.Hash {
+		// an annotated tag that has been recreated on the same commit
+		if mirror != source && name.IsTag() {
+			return &Divergence{Ref: name}, nil
+		}
+		return nil, nil
+	}
+
+	ff, err := mc.IsAncestor(sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s with the mirror: %w", name, err)
+	}
+	// like git, a tag is never moved without force, even to a descendant,
+	// and go-git cannot check the fast-forward of an annotated tag
+	if ff && !name.IsTag() {
+		return nil, nil
+	}
+
+	ahead, behind, err := exclusiveCommits(mc, sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the commits of %s: %w", name, err)
+	}
+
+	return &Divergence{
+		Ref:    name,
+		Ahead:  ahead,
+		Behind: behind,
+	}, nil
+}
+
+// peel resolves annotated tags to the commit they point to.
+func peel(repo *git.Repository, h plumbing.Hash) (*object.Commit, error) {
+	obj, err := object.GetObject(repo.Storer, h)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		return o, nil
+	case *object.Tag:
+		return o.Commit()
+	default:
+		return nil, fmt.Errorf("%s is a %s", h, obj.Type())
+	}
+}
+
+// exclusiveCommits counts the commits only reachable from a and the ones
+// only reachable from b. Like git rev-list, both histories are walked
+// together from the most recent commits and the walk stops once the
+// remaining commits are reachable from both: the common history below the
+// merge base is not read. The commits read before being found reachable
+// from the other side are walked again, the dates only change how far the
+// walk goes, not the counts.
+func exclusiveCommits(a, b *object.Commit) (int, int, error) {
+	const (
+		fromA = 1 << iota
+		fromB
+		fromBoth = fromA | fromB
+	)
+
+	flags := map[plumbing.Hash]int{a.Hash: fromA}
+	flags[b.Hash] |= fromB
+	// queue is sorted by commit date, the most recent last
+	var queue []*object.Commit
+	queued := make(map[plumbing.Hash]bool)
+	enqueue := func(c *object.Commit) {
+		if queued[c.Hash] {
+			return
+		}
+		queued[c.Hash] = true
+		i, _ := slices.BinarySearchFunc(queue, c, func(x, y *object.Commit) int {
+			return x.Committer.When.Compare(y.Committer.When)
+		})
+		queue = slices.Insert(queue, i, c)
+	}
+	// walked are the commits read, the ones found reachable from the other
+	// side afterwards are walked again to update their parents
+	walked := make(map[plumbing.Hash]bool)
+	pending := func() bool {
+		return slices.ContainsFunc(queue, func(c *object.Commit) bool {
+			return flags[c.Hash] != fromBoth || walked[c.Hash]
+		})
+	}
+
+	enqueue(a)
+	enqueue(b)
+	for pending() {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		delete(queued, c.Hash)
+		walked[c.Hash] = true
+
+		f := flags[c.Hash]
+		err := c.Parents().ForEach(func(p *object.Commit) error {
+			if flags[p.Hash]|f != flags[p.Hash] {
+				flags[p.Hash] |= f
+				enqueue(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	onlyA, onlyB := 0, 0
+	for h := range walked {
+		switch flags[h] {
+		case fromA:
+			onlyA++
+		case fromB:
+			onlyB++
+		}
+	}
+	return onlyA, onlyB, nil
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// history is the same in the source and the mirror: c1 <- c2 and c1 <- c3
+type history struct {
+	c1, c2, c3 plumbing.Hash
+}
+
+func newHistory(t *testing.T, repos ...*git.Repository) history {
+	t.Helper()
+	var h history
+	for _, repo := range repos {
+		h.c1 = newCommit(t, repo, "c1")
+		h.c2 = newCommit(t, repo, "c2", h.c1)
+		h.c3 = newCommit(t, repo, "c3", h.c1)
+	}
+	return h
+}
+
+func TestSyncSafeMode(t *testing.T) {
+	branch := plumbing.NewBranchReferenceName("x")
+	tag := plumbing.NewTagReferenceName("v1")
+
+	tests := []struct {
+		name     string
+		ref      plumbing.ReferenceName
+		source   func(history) plumbing.Hash
+		mirror   func(history) plumbing.Hash
+		diverged *Divergence
+	}{
+		{
+			name:   "fast-forward",
+			ref:    branch,
+			source: func(h history) plumbing.Hash { return h.c2 },
+			mirror: func(h history) plumbing.Hash { return h.c1 },
+		},
+		{
+			name:   "unchanged",
+			ref:    branch,
+			source: func(h history) plumbing.Hash { return h.c2 },
+			mirror: func(h history) plumbing.Hash { return h.c2 },
+		},
+		{
+			name:   "missing on the mirror",
+			ref:    branch,
+			source: func(h history) plumbing.Hash { return h.c2 },
+		},
+		{
+			name:     "rewound",
+			ref:      branch,
+			source:   func(h history) plumbing.Hash { return h.c1 },
+			mirror:   func(h history) plumbing.Hash { return h.c2 },
+			diverged: &Divergence{Ref: branch, Ahead: 1, Behind: 0},
+		},
+		{
+			name:     "diverged",
+			ref:      branch,
+			source:   func(h history) plumbing.Hash { return h.c3 },
+			mirror:   func(h history) plumbing.Hash { return h.c2 },
+			diverged: &Divergence{Ref: branch, Ahead: 1, Behind: 1},
+		},
+		{
+			name:     "moved tag",
+			ref:      tag,
+			source:   func(h history) plumbing.Hash { return h.c2 },
+			mirror:   func(h history) plumbing.Hash { return h.c1 },
+			diverged: &Divergence{Ref: tag, Ahead: 0, Behind: 1},
+		},
+		{
+			name:   "new tag",
+			ref:    tag,
+			source: func(h history) plumbing.Hash { return h.c2 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcPath := newBare(t)
+			mirror, mirrorPath := newBare(t)
+			h := newHistory(t, src, mirror)
+
+			setRef(t, src, tt.ref, tt.source(h))
+			want := tt.source(h)
+			if tt.mirror != nil {
+				setRef(t, mirror, tt.ref, tt.mirror(h))
+				if tt.diverged != nil {
+					want = tt.mirror(h)
+				}
+			}
+
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{Mode: ModeSafe})
+			c := newTestCache(t)
+			res, err := Sync(t.Context(), c, r)
+			assertNoMirrorRefs(t, c, "r")
+
+			if tt.diverged == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				if !errors.Is(err, ErrDiverged) {
+					t.Fatalf("got %v, want %s", err, ErrDiverged)
+				}
+				if d := res.Mirrors[0].Diverged; len(d) != 1 || d[0] != *tt.diverged {
+					t.Errorf("got %v, want %v", d, *tt.diverged)
+				}
+			}
+			if got := refsOf(t, mirror)[tt.ref]; got != want {
+				t.Errorf("mirror ref is %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDivergenceAnnotatedTag(t *testing.T) {
+	repo, _ := newBare(t)
+	h := newHistory(t, repo)
+	tag := plumbing.NewTagReferenceName("v1")
+
+	first := annotatedTag(t, repo, "v1", "first", h.c1)
+	if err := repo.Storer.RemoveReference(tag); err != nil {
+		t.Fatal(err)
+	}
+	second := annotatedTag(t, repo, "v1", "second", h.c1)
+	if err := repo.Storer.RemoveReference(tag); err != nil {
+		t.Fatal(err)
+	}
+	moved := annotatedTag(t, repo, "v1", "moved", h.c2)
+
+	tests := []struct {
+		name           string
+		mirror, source plumbing.Hash
+		diverged       bool
+	}{
+		{name: "same tag", mirror: first, source: first},
+		{name: "recreated on the same commit", mirror: first, source: second, diverged: true},
+		{name: "moved to a descendant", mirror: first, source: moved, diverged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diverged, err := fastForwards(repo, map[plumbing.ReferenceName]plumbing.Hash{tag: tt.mirror}, []*plumbing.Reference{plumbing.NewHashReference(tag, tt.source)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(diverged) > 0; got != tt.diverged {
+				t.Errorf("diverged is %t, want %t", got, tt.diverged)
+			}
+		})
+	}
+}
+
+func TestExclusiveCommits(t *testing.T) {
+	repo, _ := newBare(t)
+	// the commits have the same date, the walk order does not help
+	root := newCommit(t, repo, "root")
+	base := root
+	for range 20 {
+		base = newCommit(t, repo, "base", base)
+	}
+	x1 := newCommit(t, repo, "x1", base)
+	x2 := newCommit(t, repo, "x2", x1)
+	y1 := newCommit(t, repo, "y1", base)
+	merge := newCommit(t, repo, "merge", y1, x1)
+	y2 := newCommit(t, repo, "y2", merge)
+
+	tests := []struct {
+		name         string
+		a, b         plumbing.Hash
+		onlyA, onlyB int
+	}{
+		{name: "same commit", a: x2, b: x2},
+		{name: "ancestor", a: base, b: x2, onlyB: 2},
+		{name: "descendant", a: x2, b: root, onlyA: 22},
+		{name: "diverged", a: x2, b: y1, onlyA: 2, onlyB: 1},
+		// x1 is reachable from both through the merge
+		{name: "merged", a: x2, b: y2, onlyA: 1, onlyB: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := repo.CommitObject(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := repo.CommitObject(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			onlyA, onlyB, err := exclusiveCommits(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if onlyA != tt.onlyA || onlyB != tt.onlyB {
+				t.Errorf("got %d and %d, want %d and %d", onlyA, onlyB, tt.onlyA, tt.onlyB)
+			}
+		})
+	}
+}
@@ -1,22 +1,71 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
 
 	"github.com/go-git/go-git/v6"
 	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/plumbing/transport/http"
-	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh"
 )
 
 type (
 	Repository struct {
+		name    string
 		src     string
-		dst     string
 		srcAuth Authentication
-		dstAuth Authentication
+		mirrors []Mirror
+
+		settings Settings
+	}
+
+	Mirror struct {
+		name string
+		url  string
+		auth Authentication
+		// bundle is set when the refs are written in bundles instead
+		bundle *Bundle
+		push   PushOptions
+	}
+
+	// Settings changes how a repository is synced, the zero value mirrors
+	// every ref of the source.
+	Settings struct {
+		Refs   RefFilter
+		Mode   Mode
+		Backup BackupPolicy
+		Prune  Prune
+		// Protected are full ref name patterns of the mirror refs that are
+		// never deleted nor rewritten
+		Protected []string
+		// LFS mirrors the Git LFS objects of the pushed refs
+		LFS bool
+		// Submodules lists the submodules of the synced refs in the result
+		Submodules bool
+		Direction  Direction
+		// Conflicts is only used in bidirectional mode, Mode is ignored
+		Conflicts ConflictPolicy
+		// Mappings rename the source refs on the mirrors, the refs are
+		// filtered with their source name
+		Mappings []Mapping
+		// Verify skips the refs that are not signed by a trusted key
+		Verify Verification
+		Limits Limits
+		// Archives are written by Archive, after a successful sync
+		Archives Archives
+		// Shallow limits the fetched history, only in force mode
+		Shallow Shallow
+
+		// protected are the compiled Protected patterns
+		protected globs
 	}
 
 	Authentication interface {
@@ -31,15 +80,78 @@ type (
 		username, password string
 	}
 
+	SSHAuthentication struct {
+		keys *ssh.PublicKeys
+	}
+
 	NoAuthentication struct{}
+
+	// Result is the outcome of a sync, one entry per mirror.
+	Result struct {
+		Mirrors    []MirrorResult
+		Submodules []Submodule
+	}
+
+	MirrorResult struct {
+		Name string
+		Err  error
+		// Diverged lists the refs that were not pushed in safe mode, or
+		// that changed on both sides in bidirectional mode
+		Diverged []Divergence
+		// Mismatches lists the refs that do not have the pushed value on
+		// the mirror once the push is done
+		Mismatches []Mismatch
+		// Checked is false when the mirror could not be compared with the
+		// pushed refs, the push failed or the mirror could not be listed
+		Checked bool
+		// Updates are the refs of the mirror changed by the sync
+		Updates []RefUpdate
+	}
 )
 
-func NewRepository(src, dst string, srcAuth, dstAuth Authentication) Repository {
+// noTrackingRefSpec does not match any ref that is pushed
+const noTrackingRefSpec config.RefSpec = "refs/mirror-sync/none:refs/mirror-sync/none"
+
+func NewRepository(name, src string, srcAuth Authentication, mirrors []Mirror, settings Settings) Repository {
+	settings.protected = compileGlobs(settings.Protected)
+	settings.Archives.branches = compileGlobs(settings.Archives.Branches)
+	settings.Archives.tags = compileGlobs(settings.Archives.Tags)
 	return Repository{
-		src:     src,
-		dst:     dst,
-		srcAuth: srcAuth,
-		dstAuth: dstAuth,
+		name:     name,
+		src:      src,
+		srcAuth:  srcAuth,
+		mirrors:  mirrors,
+		settings: settings,
+	}
+}
+
+// WithMirrors returns the repository with only the mirrors of the given
+// names, to sync them again.
+func (r Repository) WithMirrors(names []string) Repository {
+	mirrors := make([]Mirror, 0, len(names))
+	for _, m := range r.mirrors {
+		if slices.Contains(names, m.name) {
+			mirrors = append(mirrors, m)
+		}
+	}
+	r.mirrors = mirrors
+	return r
+}
+
+// MirrorNames returns the names of the mirrors of the repository.
+func (r Repository) MirrorNames() []string {
+	names := make([]string, 0, len(r.mirrors))
+	for _, m := range r.mirrors {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+func NewMirror(name, url string, auth Authentication) Mirror {
+	return Mirror{
+		name: name,
+		url:  url,
+		auth: auth,
 	}
 }
 
@@ -56,42 +168,432 @@ func NewBasicAuthentication(username, password string) BasicAuthentication {
 	}
 }
 
-func Sync(r Repository) error {
-	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
-		URL:  r.src,
-		Auth: r.srcAuth.Value(),
-	})
+// NewSSHAuthentication parses the private key and prepares the host key
+// verification. The host key is checked against the fingerprint if given,
+// then against knownHosts (content of a known_hosts file), and otherwise
+// against the known_hosts files of the user running the daemon.
+func NewSSHAuthentication(username string, privateKey []byte, passphrase string, knownHosts []byte, fingerprint string) (SSHAuthentication, error) {
+	if len(username) == 0 {
+		username = "git"
+	}
+
+	keys, err := ssh.NewPublicKeys(username, privateKey, passphrase)
 	if err != nil {
-		return fmt.Errorf("failed to clone repository from source: %w", err)
+		return SSHAuthentication{}, fmt.Errorf("failed to read ssh private key: %w", err)
 	}
 
-	m, err := repo.CreateRemote(&config.RemoteConfig{
-		Name:   "mirror",
-		Mirror: true,
+	keys.HostKeyCallback, err = hostKeyCallback(knownHosts, fingerprint)
+	if err != nil {
+		return SSHAuthentication{}, fmt.Errorf("failed to load ssh known hosts: %w", err)
+	}
+
+	return SSHAuthentication{
+		keys: keys,
+	}, nil
+}
+
+// Sync fetches the source once then pushes it to every mirror. A mirror
+// that fails does not prevent the others from being updated, the returned
+// error joins the errors of all the mirrors.
+func Sync(ctx context.Context, c *Cache, r Repository) (Result, error) {
+	unlock := c.lock(r.name)
+	defer unlock()
+
+	repo, err := c.open(r.name)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// a full fetch does not deepen a shallow cache, it starts over
+	if shallows, _ := repo.Storer.Shallow(); len(shallows) > 0 && !r.settings.Shallow.enabled() {
+		if err := c.invalidate(r.name); err != nil {
+			return Result{}, err
+		}
+		if repo, err = c.open(r.name); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if err := c.checkSize(r.name); err != nil {
+		return Result{}, fmt.Errorf("cache entry is full, not fetching: %w", err)
+	}
+
+	if err := fetch(ctx, repo, c.dir(r.name), r); err != nil {
+		// the objects of an oversized fetch are not kept
+		var limit *LimitError
+		if cerr := check(repo); cerr != nil || (errors.As(err, &limit) && limit.Limit != LimitRefs) {
+			if err := c.invalidate(r.name); err != nil {
+				return Result{}, err
+			}
+		}
+		return Result{}, fmt.Errorf("failed to fetch repository from source: %w", err)
+	}
+
+	refs, err := localRefs(repo)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// the unverified refs are left as they are on the mirrors, they are
+	// neither pushed nor pruned
+	refs, unverified := verifyRefs(repo, refs, r.settings.Verify)
+	held := make(map[plumbing.ReferenceName]bool, len(unverified))
+	for _, u := range unverified {
+		held[u.Ref] = true
+	}
+
+	var res Result
+	if r.settings.Submodules {
+		res.Submodules, err = submodules(repo, refs, r.src)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	var errs []error
+	for _, m := range r.mirrors {
+		var diverged []Divergence
+		var rejected []Unverified
+		var missing []LFSMissing
+		var err error
+
+		// a mirror that cannot be listed fails below, its refs are then
+		// all reported as created
+		var before map[plumbing.ReferenceName]plumbing.Hash
+		var berr error
+		if m.bundle == nil {
+			if err = initLocal(m.url); err != nil {
+				err = fmt.Errorf("failed to create local repository: %w", err)
+			}
+			before, berr = mirrorRefs(ctx, repo, m)
+		}
+
+		// the refs with LFS objects missing on the source are held like
+		// the unverified ones
+		pushed, kept := refs, held
+		if err == nil && m.bundle == nil && r.settings.LFS {
+			// the objects are uploaded first, the mirror must not have
+			// pointers to missing objects. Only the objects of the commits
+			// that are not on the mirror yet are looked for.
+			if berr != nil {
+				err = berr
+			} else if missing, err = lfsMirror(ctx, repo, c.dir(r.name), r, m, refs, before); len(missing) > 0 {
+				kept = maps.Clone(held)
+				for _, l := range missing {
+					kept[l.Ref] = true
+				}
+				pushed = withoutRefs(slices.Clone(refs), kept)
+			}
+		}
+
+		switch {
+		case err != nil:
+		case m.bundle != nil:
+			// the bundles only hold the git objects
+			err = writeBundle(ctx, repo, r.name, *m.bundle, refs, r.settings, time.Now())
+		case r.settings.Direction == DirectionBidirectional:
+			diverged, rejected, err = exchange(ctx, repo, r, m, pushed, kept)
+			// the source may have been updated with the mirror refs, the
+			// next mirrors get them
+			if updated, lerr := localRefs(repo); lerr == nil {
+				refs, _ = verifyRefs(repo, withoutRefs(updated, held), r.settings.Verify)
+			}
+		default:
+			diverged, err = push(ctx, repo, m, pushed, kept, r.settings)
+		}
+
+		// the mirror is listed again to record what changed, a push that
+		// succeeded may still have been altered by the server
+		var mismatches []Mismatch
+		var updates []RefUpdate
+		var checked bool
+		if m.bundle == nil {
+			after, lerr := mirrorRefs(ctx, repo, m)
+			if lerr == nil {
+				updates = refUpdates(before, after)
+			}
+
+			if err == nil || errors.Is(err, ErrDiverged) || errors.Is(err, ErrConflict) {
+				skipped := make(map[plumbing.ReferenceName]bool, len(diverged)+len(rejected))
+				for _, d := range diverged {
+					skipped[d.Ref] = true
+				}
+				for _, u := range rejected {
+					skipped[mapName(r.settings.Mappings, u.Ref)] = true
+				}
+				for _, l := range missing {
+					skipped[mapName(r.settings.Mappings, l.Ref)] = true
+				}
+				var cerr error
+				if lerr != nil {
+					cerr = fmt.Errorf("failed to verify pushed refs: %w", lerr)
+				} else if mismatches, cerr = checkMirror(after, refs, skipped, r.settings); cerr != nil {
+					cerr = fmt.Errorf("failed to verify pushed refs: %w", cerr)
+				} else {
+					checked = true
+					if len(mismatches) > 0 {
+						cerr = &MismatchError{Refs: mismatches}
+					}
+				}
+				err = errors.Join(err, cerr)
+			}
+		}
+
+		if err == nil && len(unverified)+len(rejected) > 0 {
+			err = &UnverifiedError{Refs: slices.Concat(unverified, rejected)}
+		}
+		if len(missing) > 0 {
+			err = errors.Join(err, &LFSMissingError{Refs: missing})
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to push to mirror server '%s': %w", m.name, err)
+			errs = append(errs, err)
+		}
+		res.Mirrors = append(res.Mirrors, MirrorResult{
+			Name:       m.name,
+			Err:        err,
+			Diverged:   diverged,
+			Mismatches: mismatches,
+			Checked:    checked,
+			Updates:    updates,
+		})
+	}
+
+	if err := c.compact(r.name, repo); err != nil {
+		errs = append(errs, err)
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// fetch updates the cache with the refs of the source selected by the
+// filters. The refs that are not selected anymore are removed from the
+// cache so they are not pushed. The fetch is stopped when it exceeds the
+// limits.
+func fetch(ctx context.Context, repo *git.Repository, dir string, r Repository) error {
+	src, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name: "anonymous",
 		URLs: []string{
-			r.dst,
+			r.src,
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create remote: %w", err)
 	}
 
-	err = m.Push(&git.PushOptions{
-		RemoteName: "mirror",
-		Auth:       r.dstAuth.Value(),
-		RefSpecs:   []config.RefSpec{"+refs/*:refs/*"},
-		Force:      true,
+	remoteRefs, err := src.ListContext(ctx, &git.ListOptions{
+		Auth:          r.srcAuth.Value(),
+		PeelingOption: git.IgnorePeeled,
 	})
 	if err != nil {
-		if errors.Is(err, git.NoErrAlreadyUpToDate) {
-			return nil
+		return fmt.Errorf("failed to list source refs: %w", err)
+	}
+
+	wanted := filterRefs(remoteRefs, r.settings.Refs)
+	if err := r.settings.Limits.checkRefs(len(wanted)); err != nil {
+		return err
+	}
+	if len(wanted) > 0 {
+		err = r.settings.Limits.watch(ctx, dir, func(ctx context.Context) error {
+			o := git.FetchOptions{
+				RemoteName: "anonymous",
+				Auth:       r.srcAuth.Value(),
+				RefSpecs:   refSpecs(wanted, true),
+				Tags:       git.NoTags,
+				Force:      true,
+			}
+			if r.settings.Shallow.enabled() {
+				return shallowFetch(ctx, repo, src, o, r.settings.Shallow)
+			}
+			err := src.FetchContext(ctx, &o)
+			if errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	keep := make(map[plumbing.ReferenceName]bool, len(wanted))
+	for _, ref := range wanted {
+		keep[ref.Name()] = true
+	}
+
+	localRefs, err := localRefs(repo)
+	if err != nil {
+		return err
+	}
+	for _, ref := range localRefs {
+		if keep[ref.Name()] {
+			continue
+		}
+		if err := repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return fmt.Errorf("failed to remove stale ref %s: %w", ref.Name(), err)
 		}
-		return fmt.Errorf("failed to push to mirror server: %w", err)
 	}
 
 	return nil
 }
 
+// push updates the mirror with the refs of the cache. The mirror refs that
+// cannot be fast-forwarded are left untouched and returned in safe mode, or
+// when they are protected. The held refs are not pushed but never pruned.
+func push(ctx context.Context, repo *git.Repository, m Mirror, refs []*plumbing.Reference, held map[plumbing.ReferenceName]bool, s Settings) (_ []Divergence, err error) {
+	// an empty source never prunes the mirror
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	refs, err = mapRefs(refs, s.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is pushed without the requested options
+	if err := m.checkPush(ctx); err != nil {
+		return nil, err
+	}
+	// nor to a local mirror that would be left with missing objects
+	if err := checkShallow(repo, m.url); err != nil {
+		return nil, err
+	}
+
+	dst, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name:   "anonymous",
+		Mirror: true,
+		URLs: []string{
+			m.url,
+		},
+		// after a push, go-git writes the pushed refs in the namespace of
+		// the fetch refspec, the cache must only contain the source refs
+		Fetch: []config.RefSpec{noTrackingRefSpec},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote: %w", err)
+	}
+
+	force := s.Mode != ModeSafe
+	var diverged []Divergence
+	var deleted, rewritten []plumbing.ReferenceName
+	var current map[plumbing.ReferenceName]plumbing.Hash
+	if !force || s.Backup.Enabled || len(s.Protected) > 0 || (len(s.Prune) > 0 && s.Prune != PruneNever) {
+		current, err = remoteRefs(ctx, dst, m.auth)
+		if err != nil {
+			return nil, err
+		}
+
+		kept := refs
+		for name := range held {
+			kept = append(kept, plumbing.NewHashReference(mapName(s.Mappings, name), plumbing.ZeroHash))
+		}
+		deleted = prunedRefs(current, kept, s)
+
+		// a shallow cache cannot tell a fast-forward from a rewrite, it is
+		// only used in force mode without backups nor protected refs,
+		// where every ref is forced
+		if !s.Shallow.enabled() {
+			wanted := refs
+			for _, name := range deleted {
+				wanted = append(wanted, plumbing.NewHashReference(name, plumbing.ZeroHash))
+			}
+
+			defer func() {
+				err = errors.Join(err, removeMirrorRefs(repo))
+			}()
+			if err := fetchMirrorRefs(ctx, repo, dst, m.auth, current, wanted); err != nil {
+				return nil, err
+			}
+
+			source := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+			for _, ref := range refs {
+				source[ref.Name()] = ref
+			}
+
+			var nonFastForwards []Divergence
+			refs, nonFastForwards, err = fastForwards(repo, current, refs)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, d := range nonFastForwards {
+				if !force || s.isProtected(d.Ref) {
+					diverged = append(diverged, d)
+					continue
+				}
+				refs = append(refs, source[d.Ref])
+				rewritten = append(rewritten, d.Ref)
+			}
+		}
+
+		// the refs that are about to be overwritten or deleted are saved
+		// first, if the backup fails nothing is pushed
+		if s.Backup.Enabled {
+			if err := backupRefs(ctx, dst, m.auth, current, append(rewritten, deleted...), time.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the refs are pushed by hash, their name on the mirror may not be the
+	// one of the cache
+	specs := append(hashRefSpecs(refs, rewritten), deleteRefSpecs(deleted)...)
+	if len(specs) > 0 {
+		err = dst.PushContext(ctx, &git.PushOptions{
+			RemoteName: "anonymous",
+			Auth:       m.auth.Value(),
+			RefSpecs:   specs,
+			Force:      force,
+			Options:    m.push.Options,
+			Atomic:     m.push.Atomic,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return diverged, shallowRejection(repo, err)
+		}
+	}
+
+	if s.Backup.Enabled {
+		if err := expireBackups(ctx, dst, m.auth, current, s.Backup.Retention, time.Now()); err != nil {
+			return diverged, err
+		}
+	}
+
+	if len(diverged) > 0 {
+		return diverged, &DivergedError{Refs: diverged}
+	}
+
+	return nil, nil
+}
+
+// withoutRefs removes the given refs from the list.
+func withoutRefs(refs []*plumbing.Reference, names map[plumbing.ReferenceName]bool) []*plumbing.Reference {
+	return slices.DeleteFunc(refs, func(ref *plumbing.Reference) bool {
+		return names[ref.Name()]
+	})
+}
+
+func localRefs(repo *git.Repository) ([]*plumbing.Reference, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached refs: %w", err)
+	}
+	defer iter.Close()
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && ref.Name() != plumbing.HEAD {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached refs: %w", err)
+	}
+
+	return refs, nil
+}
+
 func (a TokenAuthentication) Value() transport.AuthMethod {
 	return &http.BasicAuth{
 		Username: "git",
@@ -106,6 +608,24 @@ func (a BasicAuthentication) Value() transport.AuthMethod {
 	}
 }
 
+func (a SSHAuthentication) Value() transport.AuthMethod {
+	return a.keys
+}
+
 func (NoAuthentication) Value() transport.AuthMethod {
 	return nil
 }
+
+// initLocal creates the bare repository of a file:// mirror on its first
+// sync, the forges create theirs but a local directory is usually empty.
+func initLocal(url string) error {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil || ep.Protocol != "file" {
+		return nil
+	}
+	if _, err := os.Stat(ep.Path); !os.IsNotExist(err) {
+		return nil
+	}
+	_, err = git.PlainInit(ep.Path, true)
+	return err
+}
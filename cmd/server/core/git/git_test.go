@@ -0,0 +1,216 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+)
+
+func TestSyncMirrors(t *testing.T) {
+	src, srcPath := newSource(t)
+	h := commit(t, src, "a", "1")
+
+	// a file in place of the directory of the mirror
+	broken := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(broken, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	first, firstPath := newBare(t)
+	second, secondPath := newBare(t)
+
+	tests := []struct {
+		name   string
+		url    string
+		failed bool
+	}{
+		{name: "first", url: "file://" + firstPath},
+		{name: "broken", url: "file://" + broken + "/r.git", failed: true},
+		{name: "second", url: "file://" + secondPath},
+	}
+
+	var mirrors []Mirror
+	for _, tt := range tests {
+		mirrors = append(mirrors, NewMirror(tt.name, tt.url, NoAuthentication{}))
+	}
+	res, err := Sync(t.Context(), newTestCache(t), NewRepository("r", srcPath, NoAuthentication{}, mirrors, Settings{}))
+	if err == nil {
+		t.Error("sync succeeded with a broken mirror")
+	}
+
+	if len(res.Mirrors) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(res.Mirrors), len(tests))
+	}
+	for i, tt := range tests {
+		m := res.Mirrors[i]
+		if m.Name != tt.name {
+			t.Errorf("result %d is %s, want %s", i, m.Name, tt.name)
+		}
+		if failed := m.Err != nil; failed != tt.failed {
+			t.Errorf("%s failed is %t, want %t (%v)", tt.name, failed, tt.failed, m.Err)
+		}
+	}
+
+	master := plumbing.NewBranchReferenceName("master")
+	for _, repo := range []struct {
+		name string
+		refs map[plumbing.ReferenceName]plumbing.Hash
+	}{{"first", refsOf(t, first)}, {"second", refsOf(t, second)}} {
+		if repo.refs[master] != h {
+			t.Errorf("%s master is %s, want %s", repo.name, repo.refs[master], h)
+		}
+	}
+}
+
+func TestCheckMirror(t *testing.T) {
+	h1 := plumbing.NewHash("1111111111111111111111111111111111111111")
+	h2 := plumbing.NewHash("2222222222222222222222222222222222222222")
+	master := plumbing.NewBranchReferenceName("master")
+	dev := plumbing.NewBranchReferenceName("dev")
+	v1 := plumbing.NewTagReferenceName("v1")
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(master, h1),
+		plumbing.NewHashReference(dev, h2),
+		plumbing.NewHashReference(v1, h1),
+	}
+
+	tests := []struct {
+		name     string
+		current  map[plumbing.ReferenceName]plumbing.Hash
+		refs     []*plumbing.Reference
+		skipped  map[plumbing.ReferenceName]bool
+		mappings []Mapping
+		want     []Mismatch
+	}{
+		{
+			name:    "matching",
+			current: map[plumbing.ReferenceName]plumbing.Hash{master: h1, dev: h2, v1: h1},
+			refs:    refs,
+		},
+		{
+			name:    "reverted and missing refs",
+			current: map[plumbing.ReferenceName]plumbing.Hash{master: h1, dev: h1},
+			refs:    refs,
+			want: []Mismatch{
+				{Ref: dev, Expected: h2, Actual: h1},
+				{Ref: v1, Expected: h1},
+			},
+		},
+		{
+			name:    "skipped refs",
+			current: map[plumbing.ReferenceName]plumbing.Hash{master: h1},
+			refs:    refs,
+			skipped: map[plumbing.ReferenceName]bool{dev: true, v1: true},
+		},
+		{
+			name:     "mapped refs",
+			current:  map[plumbing.ReferenceName]plumbing.Hash{"refs/heads/mirror/master": h1, "refs/heads/mirror/dev": h1, v1: h1},
+			refs:     refs,
+			mappings: []Mapping{{From: "refs/heads/*", To: "refs/heads/mirror/*"}},
+			want:     []Mismatch{{Ref: "refs/heads/mirror/dev", Expected: h2, Actual: h1}},
+		},
+		{
+			name:    "empty source",
+			current: map[plumbing.ReferenceName]plumbing.Hash{master: h1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkMirror(tt.current, tt.refs, tt.skipped, Settings{Mappings: tt.mappings})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncMismatch(t *testing.T) {
+	src, srcPath := newSource(t)
+	first := commit(t, src, "a", "1")
+	if _, err := src.CreateTag("v1", first, nil); err != nil {
+		t.Fatal(err)
+	}
+	dst, dstPath := newBare(t)
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+dstPath, NoAuthentication{})}, Settings{})
+	mustSync(t, c, r)
+
+	master := plumbing.NewBranchReferenceName("master")
+	v1 := plumbing.NewTagReferenceName("v1")
+	// the hook keeps master on the first commit and drops the tag, the
+	// push itself succeeds
+	hook := &hookTransport{after: func() {
+		setRef(t, dst, master, first)
+		if err := dst.Storer.RemoveReference(v1); err != nil {
+			t.Fatal(err)
+		}
+	}}
+	r = NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", hookURL(t, dstPath, hook), NoAuthentication{})}, Settings{})
+	second := commit(t, src, "a", "2")
+
+	res, err := Sync(t.Context(), c, r)
+	if !errors.Is(err, ErrMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrMismatch)
+	}
+	m := res.Mirrors[0]
+	if !m.Checked {
+		t.Error("mirror was not checked")
+	}
+	want := []Mismatch{
+		{Ref: master, Expected: second, Actual: first},
+		{Ref: v1, Expected: first},
+	}
+	if !slices.Equal(m.Mismatches, want) {
+		t.Errorf("got mismatches %v, want %v", m.Mismatches, want)
+	}
+}
+
+func TestSyncPushOptions(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+
+	tests := []struct {
+		name        string
+		options     PushOptions
+		strip       []capability.Capability
+		unsupported bool
+	}{
+		{name: "push options", options: PushOptions{Options: []string{"ci.skip"}}},
+		{name: "push options not supported", options: PushOptions{Options: []string{"ci.skip"}}, strip: []capability.Capability{capability.PushOptions}, unsupported: true},
+		// the go-git server never supports them
+		{name: "atomic push not supported", options: PushOptions{Atomic: true}, unsupported: true},
+		{name: "no options", strip: []capability.Capability{capability.PushOptions}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, dstPath := newBare(t)
+			m := NewMirror("m", hookURL(t, dstPath, &hookTransport{strip: tt.strip}), NoAuthentication{}).WithPushOptions(tt.options)
+			res, err := Sync(t.Context(), newTestCache(t), NewRepository("r", srcPath, NoAuthentication{}, []Mirror{m}, Settings{}))
+			if unsupported := errors.Is(err, ErrUnsupported); unsupported != tt.unsupported {
+				t.Fatalf("unsupported is %t, want %t (%v)", unsupported, tt.unsupported, err)
+			}
+			if !tt.unsupported && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.unsupported {
+				return
+			}
+			// nothing is pushed without the options
+			if refs := refsOf(t, dst); len(refs) > 0 {
+				t.Errorf("mirror has refs %v", refs)
+			}
+			if !errors.Is(res.Mirrors[0].Err, ErrUnsupported) {
+				t.Errorf("got mirror error %v, want %v", res.Mirrors[0].Err, ErrUnsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+var signature = object.Signature{
+	Name:  "test",
+	Email: "test@example.com",
+	When:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// newSource creates a repository with a worktree to commit to, its path is
+// usable as a source or mirror url.
+func newSource(t *testing.T) (*git.Repository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, dir
+}
+
+// newBare creates an empty bare repository to use as a mirror.
+func newBare(t *testing.T) (*git.Repository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, dir
+}
+
+// commit writes the file and commits it on the current branch.
+func commit(t *testing.T, repo *git.Repository, file, content string) plumbing.Hash {
+	t.Helper()
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(wt.Filesystem.Root(), file)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add(file); err != nil {
+		t.Fatal(err)
+	}
+	sig := signature
+	sig.When = sig.When.Add(time.Duration(countCommits(t, repo)) * time.Minute)
+	h, err := wt.Commit("update "+file, &git.CommitOptions{Author: &sig, Committer: &sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func countCommits(t *testing.T, repo *git.Repository) int {
+	t.Helper()
+	iter, err := repo.CommitObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	_ = iter.ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// newCommit stores a commit with an empty tree, the same message and
+// parents give the same hash in every repository.
+func newCommit(t *testing.T, repo *git.Repository, msg string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	tree := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      msg,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	h, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// setRef points the ref to the hash, creating it if needed.
+func setRef(t *testing.T, repo *git.Repository, name plumbing.ReferenceName, h plumbing.Hash) {
+	t.Helper()
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// annotatedTag creates an annotated tag of the commit.
+func annotatedTag(t *testing.T, repo *git.Repository, name, msg string, h plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	ref, err := repo.CreateTag(name, h, &git.CreateTagOptions{Tagger: &signature, Message: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Hash()
+}
+
+// refsOf returns the hash refs of the repository by name.
+func refsOf(t *testing.T, repo *git.Repository) map[plumbing.ReferenceName]plumbing.Hash {
+	t.Helper()
+	refs, err := repo.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[plumbing.ReferenceName]plumbing.Hash)
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			res[ref.Name()] = ref.Hash()
+		}
+		return nil
+	})
+	return res
+}
+
+func newTestCache(t *testing.T) *Cache {
+	t.Helper()
+	c, err := NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func mustSync(t *testing.T, c *Cache, r Repository) Result {
+	t.Helper()
+	res, err := Sync(t.Context(), c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// hookTransport serves the hook:// urls like the file:// ones, without the
+// capabilities in strip and running after each push like a server-side hook.
+type hookTransport struct {
+	strip []capability.Capability
+	after func()
+}
+
+type hookSession struct {
+	transport.Session
+	hook *hookTransport
+}
+
+type hookConnection struct {
+	transport.Connection
+	hook *hookTransport
+}
+
+// hookURL registers the hook transport for the test and returns the hook://
+// url of the local repository.
+func hookURL(t *testing.T, path string, hook *hookTransport) string {
+	t.Helper()
+	transport.Register("hook", hook)
+	t.Cleanup(func() {
+		transport.Unregister("hook")
+	})
+	return "hook://" + path
+}
+
+func (h *hookTransport) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	next, err := transport.Get("file")
+	if err != nil {
+		return nil, err
+	}
+	e := *ep
+	e.Protocol = "file"
+	s, err := next.NewSession(st, &e, auth)
+	if err != nil {
+		return nil, err
+	}
+	return hookSession{Session: s, hook: h}, nil
+}
+
+func (h *hookTransport) SupportedProtocols() []protocol.Version {
+	next, err := transport.Get("file")
+	if err != nil {
+		return nil
+	}
+	return next.SupportedProtocols()
+}
+
+func (s hookSession) Handshake(ctx context.Context, service transport.Service, params ...string) (transport.Connection, error) {
+	conn, err := s.Session.Handshake(ctx, service, params...)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range s.hook.strip {
+		conn.Capabilities().Delete(c)
+	}
+	return hookConnection{Connection: conn, hook: s.hook}, nil
+}
+
+func (c hookConnection) Push(ctx context.Context, req *transport.PushRequest) error {
+	if err := c.Connection.Push(ctx, req); err != nil {
+		return err
+	}
+	if c.hook.after != nil {
+		c.hook.after()
+	}
+	return nil
+}
+
+// assertNoMirrorRefs checks that the refs fetched from the mirrors were
+// removed from the cache entry.
+func assertNoMirrorRefs(t *testing.T, c *Cache, name string) {
+	t.Helper()
+	for ref := range refsOf(t, openCache(t, c, name)) {
+		if strings.HasPrefix(ref.String(), mirrorRefsNamespace) {
+			t.Errorf("mirror ref %s is left in the cache", ref)
+		}
+	}
+}
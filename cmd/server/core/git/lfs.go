@@ -0,0 +1,812 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type (
+	lfsPointer struct {
+		oid  string
+		size int64
+	}
+
+	// lfsWalker reads the pointers added by the commits, it keeps them by
+	// commit and by blob so the history shared by the refs is read once.
+	lfsWalker struct {
+		repo    *git.Repository
+		commits map[plumbing.Hash][]lfsPointer
+		blobs   map[plumbing.Hash]*lfsPointer
+	}
+
+	// LFSMissing is a ref that has not been pushed because the source does
+	// not have one of its LFS objects.
+	LFSMissing struct {
+		Ref    plumbing.ReferenceName
+		OID    string
+		Reason string
+	}
+
+	LFSMissingError struct {
+		Refs []LFSMissing
+	}
+
+	// lfsEndpoint is where the LFS objects of a repository are stored, either
+	// a batch API or the lfs/objects directory of a local repository.
+	lfsEndpoint struct {
+		href   string
+		header map[string]string
+		dir    string
+		client *http.Client
+	}
+
+	lfsBatchRequest struct {
+		Operation string      `json:"operation"`
+		Transfers []string    `json:"transfers"`
+		Objects   []lfsObject `json:"objects"`
+	}
+
+	lfsBatchResponse struct {
+		Objects []lfsObject `json:"objects"`
+	}
+
+	lfsObject struct {
+		OID     string               `json:"oid"`
+		Size    int64                `json:"size"`
+		Actions map[string]lfsAction `json:"actions,omitempty"`
+		Error   *lfsError            `json:"error,omitempty"`
+	}
+
+	lfsAction struct {
+		Href   string            `json:"href"`
+		Header map[string]string `json:"header,omitempty"`
+	}
+
+	lfsError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+const (
+	lfsMediaType = "application/vnd.git-lfs+json"
+	// lfsPointerMaxSize is the size above which a blob is not read, a
+	// pointer file is much smaller
+	lfsPointerMaxSize = 1024
+	lfsBatchSize      = 100
+)
+
+var (
+	ErrLFSObjectMissing error = errors.New("lfs object is missing")
+)
+
+// lfsPointers finds the LFS pointer files of each ref that were added by
+// the commits the mirror does not have, the ones that are not in the
+// history of its current refs. The history is walked down to the shallow
+// boundary of the cache and the tree of a commit is only read where it
+// differs from its parents, the other objects were added by a parent.
+func lfsPointers(ctx context.Context, repo *git.Repository, refs []*plumbing.Reference, current map[plumbing.ReferenceName]plumbing.Hash) (map[plumbing.ReferenceName][]lfsPointer, error) {
+	tips := make(map[plumbing.Hash]bool, len(current))
+	for _, h := range current {
+		tips[h] = true
+	}
+	var pending []*plumbing.Reference
+	for _, ref := range refs {
+		if !tips[ref.Hash()] {
+			pending = append(pending, ref)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	stops, err := shallowStops(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// the history of the mirror, its refs unknown to the cache are skipped
+	known := make(map[plumbing.Hash]bool)
+	for h := range tips {
+		c, err := peel(repo, h)
+		if err != nil {
+			continue
+		}
+		err = object.NewCommitPreorderIter(c, known, stops).ForEach(func(c *object.Commit) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			known[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk the history of the mirror: %w", err)
+		}
+	}
+
+	w := lfsWalker{
+		repo:    repo,
+		commits: make(map[plumbing.Hash][]lfsPointer),
+		blobs:   make(map[plumbing.Hash]*lfsPointer),
+	}
+	res := make(map[plumbing.ReferenceName][]lfsPointer)
+	for _, ref := range pending {
+		c, err := peel(repo, ref.Hash())
+		if err != nil {
+			// refs pointing to trees or blobs are not walked
+			continue
+		}
+
+		seen := make(map[lfsPointer]bool)
+		err = object.NewCommitPreorderIter(c, known, stops).ForEach(func(c *object.Commit) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pointers, err := w.commit(c)
+			if err != nil {
+				return err
+			}
+			for _, p := range pointers {
+				if !seen[p] {
+					seen[p] = true
+					res[ref.Name()] = append(res[ref.Name()], p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the lfs objects of %s: %w", ref.Name(), err)
+		}
+	}
+
+	return res, nil
+}
+
+// commit returns the pointers added by the commit, the commits shared by
+// several refs are only read once.
+func (w lfsWalker) commit(c *object.Commit) ([]lfsPointer, error) {
+	if pointers, ok := w.commits[c.Hash]; ok {
+		return pointers, nil
+	}
+
+	// a parent below the shallow boundary is missing, the commit is then
+	// read as a root commit
+	var parents []plumbing.Hash
+	for _, h := range c.ParentHashes {
+		if p, err := object.GetCommit(w.repo.Storer, h); err == nil {
+			parents = append(parents, p.TreeHash)
+		}
+	}
+
+	var pointers []lfsPointer
+	if err := w.tree(c.TreeHash, parents, &pointers); err != nil {
+		return nil, err
+	}
+	w.commits[c.Hash] = pointers
+	return pointers, nil
+}
+
+// tree adds the pointers of the tree that are not in the same place in one
+// of the parent trees.
+func (w lfsWalker) tree(h plumbing.Hash, parents []plumbing.Hash, pointers *[]lfsPointer) error {
+	tree, err := object.GetTree(w.repo.Storer, h)
+	if err != nil {
+		return err
+	}
+
+	var previous []map[string]object.TreeEntry
+	for _, ph := range parents {
+		if ph == h {
+			return nil
+		}
+		pt, err := object.GetTree(w.repo.Storer, ph)
+		if err != nil {
+			return err
+		}
+		entries := make(map[string]object.TreeEntry, len(pt.Entries))
+		for _, e := range pt.Entries {
+			entries[e.Name] = e
+		}
+		previous = append(previous, entries)
+	}
+
+entries:
+	for _, e := range tree.Entries {
+		var subtrees []plumbing.Hash
+		for _, entries := range previous {
+			pe, ok := entries[e.Name]
+			if !ok {
+				continue
+			}
+			if pe.Hash == e.Hash {
+				continue entries
+			}
+			if pe.Mode == filemode.Dir {
+				subtrees = append(subtrees, pe.Hash)
+			}
+		}
+
+		switch e.Mode {
+		case filemode.Dir:
+			if err := w.tree(e.Hash, subtrees, pointers); err != nil {
+				return err
+			}
+		case filemode.Regular, filemode.Executable, filemode.Deprecated:
+			p, ok := w.blobs[e.Hash]
+			if !ok {
+				if p, err = readLFSPointer(w.repo, e.Hash); err != nil {
+					return err
+				}
+				w.blobs[e.Hash] = p
+			}
+			if p != nil {
+				*pointers = append(*pointers, *p)
+			}
+		}
+	}
+	return nil
+}
+
+func readLFSPointer(repo *git.Repository, h plumbing.Hash) (*lfsPointer, error) {
+	obj, err := repo.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Size() > lfsPointerMaxSize {
+		return nil, nil
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseLFSPointer(b), nil
+}
+
+// parseLFSPointer reads a pointer file, nil if b is not one:
+//
+//	version https://git-lfs.github.com/spec/v1
+//	oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+//	size 12345
+func parseLFSPointer(b []byte) *lfsPointer {
+	if !bytes.HasPrefix(b, []byte("version https://git-lfs.github.com/spec/v1")) && !bytes.HasPrefix(b, []byte("version https://hawser.github.com/spec/v1")) {
+		return nil
+	}
+
+	var p lfsPointer
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		key, value, _ := strings.Cut(s.Text(), " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || len(oid) != 64 {
+				return nil
+			}
+			if _, err := hex.DecodeString(oid); err != nil {
+				return nil
+			}
+			p.oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil
+			}
+			p.size = size
+		}
+	}
+	if len(p.oid) == 0 {
+		return nil
+	}
+	return &p
+}
+
+// lfsObjectPath is where git-lfs stores an object in a repository, the cache
+// stores them the same way but does not count them in its size limit.
+func lfsObjectPath(dir, oid string) string {
+	return filepath.Join(dir, "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// lfsFetch downloads the objects that are not in the cache yet from the
+// source. The objects that the source does not have are returned with the
+// reason, by oid, the other failures stop the download.
+func lfsFetch(ctx context.Context, dir string, r Repository, pointers []lfsPointer) (map[string]string, error) {
+	var wanted []lfsPointer
+	for _, p := range pointers {
+		if _, err := os.Stat(lfsObjectPath(dir, p.oid)); err != nil {
+			wanted = append(wanted, p)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	e, err := newLFSEndpoint(ctx, r.src, r.srcAuth, "download")
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make(map[string]string)
+	if len(e.dir) > 0 {
+		for _, p := range wanted {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			path := lfsObjectPath(e.dir, p.oid)
+			if _, err := os.Stat(path); err != nil {
+				missing[p.oid] = "not found on the source"
+				continue
+			}
+			if err := copyLFSObject(path, dir, p); err != nil {
+				return nil, err
+			}
+		}
+		return missing, nil
+	}
+
+	for chunk := range slices.Chunk(wanted, lfsBatchSize) {
+		objects, err := e.batch(ctx, "download", chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range chunk {
+			o, ok := objects[p]
+			switch {
+			case !ok:
+				missing[p.oid] = "not returned by the source"
+				continue
+			case o.Error != nil:
+				missing[p.oid] = o.Error.Message
+				continue
+			}
+			action, ok := o.Actions["download"]
+			if !ok {
+				missing[p.oid] = "no download link"
+				continue
+			}
+			if err := e.download(ctx, action, dir, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// lfsMirror uploads the LFS objects of the commits that the mirror does not
+// have yet, they are downloaded from the source first. The refs that have
+// an object the source does not have are returned, they must not be pushed.
+func lfsMirror(ctx context.Context, repo *git.Repository, dir string, r Repository, m Mirror, refs []*plumbing.Reference, current map[plumbing.ReferenceName]plumbing.Hash) ([]LFSMissing, error) {
+	byRef, err := lfsPointers(ctx, repo, refs, current)
+	if err != nil {
+		return nil, err
+	}
+
+	var pointers []lfsPointer
+	seen := make(map[lfsPointer]bool)
+	for _, ref := range refs {
+		for _, p := range byRef[ref.Name()] {
+			if !seen[p] {
+				seen[p] = true
+				pointers = append(pointers, p)
+			}
+		}
+	}
+
+	missing, err := lfsFetch(ctx, dir, r, pointers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch lfs objects from source: %w", err)
+	}
+
+	var held []LFSMissing
+	for _, ref := range refs {
+		for _, p := range byRef[ref.Name()] {
+			if reason, ok := missing[p.oid]; ok {
+				held = append(held, LFSMissing{Ref: ref.Name(), OID: p.oid, Reason: reason})
+				break
+			}
+		}
+	}
+	pointers = slices.DeleteFunc(pointers, func(p lfsPointer) bool {
+		_, ok := missing[p.oid]
+		return ok
+	})
+
+	if err := lfsPush(ctx, dir, m, pointers); err != nil {
+		return held, fmt.Errorf("failed to push lfs objects: %w", err)
+	}
+	return held, nil
+}
+
+func (e *LFSMissingError) Error() string {
+	var refs []string
+	for _, m := range e.Refs {
+		refs = append(refs, m.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrLFSObjectMissing, strings.Join(refs, ", "))
+}
+
+func (e *LFSMissingError) Unwrap() error {
+	return ErrLFSObjectMissing
+}
+
+func (m LFSMissing) String() string {
+	return fmt.Sprintf("%s (%s: %s)", m.Ref, m.OID, m.Reason)
+}
+
+// lfsPush uploads the objects that the mirror does not have.
+func lfsPush(ctx context.Context, dir string, m Mirror, pointers []lfsPointer) error {
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	e, err := newLFSEndpoint(ctx, m.url, m.auth, "upload")
+	if err != nil {
+		return err
+	}
+
+	if len(e.dir) > 0 {
+		for _, p := range pointers {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, err := os.Stat(lfsObjectPath(e.dir, p.oid)); err == nil {
+				continue
+			}
+			if err := copyLFSObject(lfsObjectPath(dir, p.oid), e.dir, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for chunk := range slices.Chunk(pointers, lfsBatchSize) {
+		objects, err := e.batch(ctx, "upload", chunk)
+		if err != nil {
+			return err
+		}
+		for p, o := range objects {
+			if o.Error != nil {
+				return fmt.Errorf("failed to upload lfs object %s: %s", p.oid, o.Error.Message)
+			}
+			// the mirror already has the object
+			action, ok := o.Actions["upload"]
+			if !ok {
+				continue
+			}
+			if err := e.upload(ctx, action, dir, p); err != nil {
+				return err
+			}
+			if verify, ok := o.Actions["verify"]; ok {
+				if err := e.verify(ctx, verify, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// newLFSEndpoint finds the LFS server of a repository like git-lfs does:
+// <url>.git/info/lfs for http, git-lfs-authenticate for ssh and the
+// lfs/objects directory for local repositories.
+func newLFSEndpoint(ctx context.Context, url string, auth Authentication, operation string) (lfsEndpoint, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return lfsEndpoint{}, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	auth, client, dial := connection(auth)
+
+	switch ep.Protocol {
+	case "file":
+		// the objects of a non-bare repository are in .git
+		if _, err := os.Stat(filepath.Join(ep.Path, ".git")); err == nil {
+			return lfsEndpoint{dir: filepath.Join(ep.Path, ".git")}, nil
+		}
+		return lfsEndpoint{dir: ep.Path}, nil
+	case "ssh":
+		if keys, ok := auth.Value().(*ssh.PublicKeys); ok {
+			e, err := sshLFSEndpoint(ctx, ep, keys, dial, operation)
+			e.client = client
+			return e, err
+		}
+		return lfsEndpoint{
+			href:   "https://" + ep.Host + "/" + lfsRepositoryPath(ep.Path) + "/info/lfs",
+			client: client,
+		}, nil
+	default:
+		e := lfsEndpoint{
+			href:   strings.TrimSuffix(url, "/"),
+			header: make(map[string]string),
+			client: client,
+		}
+		if !strings.HasSuffix(e.href, ".git") {
+			e.href += ".git"
+		}
+		e.href += "/info/lfs"
+
+		if basic, ok := auth.Value().(*githttp.BasicAuth); ok {
+			credentials := base64.StdEncoding.EncodeToString([]byte(basic.Username + ":" + basic.Password))
+			e.header["Authorization"] = "Basic " + credentials
+		}
+		return e, nil
+	}
+}
+
+func lfsRepositoryPath(path string) string {
+	path = strings.Trim(path, "/")
+	if !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+	return path
+}
+
+// sshLFSEndpoint asks the server for the LFS url and a temporary token.
+func sshLFSEndpoint(ctx context.Context, ep *transport.Endpoint, keys *ssh.PublicKeys, dial func(ctx context.Context, network, addr string) (net.Conn, error), operation string) (lfsEndpoint, error) {
+	config, err := keys.ClientConfig()
+	if err != nil {
+		return lfsEndpoint{}, err
+	}
+	if len(ep.User) > 0 {
+		config.User = ep.User
+	}
+
+	port := ep.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(ep.Host, strconv.Itoa(port))
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return lfsEndpoint{}, fmt.Errorf("failed to connect to %s: %w", ep.Host, err)
+	}
+	// the ssh handshake and the command do not take a context
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return lfsEndpoint{}, fmt.Errorf("failed to connect to %s: %w", ep.Host, err)
+	}
+	client := gossh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return lfsEndpoint{}, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	defer session.Close()
+
+	out, err := session.Output(fmt.Sprintf("git-lfs-authenticate %s %s", shellQuote(strings.Trim(ep.Path, "/")), operation))
+	if err != nil {
+		return lfsEndpoint{}, fmt.Errorf("git-lfs-authenticate failed: %w", err)
+	}
+
+	var res lfsAction
+	if err := json.Unmarshal(out, &res); err != nil {
+		return lfsEndpoint{}, fmt.Errorf("failed to parse git-lfs-authenticate response: %w", err)
+	}
+
+	return lfsEndpoint{
+		href:   strings.TrimSuffix(res.Href, "/"),
+		header: res.Header,
+	}, nil
+}
+
+// shellQuote quotes s for the shell of the server, a quote inside s closes
+// the quoted string, is escaped, then opens it again.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// batch returns the answer of the server for each of the pointers, the
+// objects the server did not ask for are ignored.
+func (e lfsEndpoint) batch(ctx context.Context, operation string, pointers []lfsPointer) (map[lfsPointer]lfsObject, error) {
+	body := lfsBatchRequest{
+		Operation: operation,
+		Transfers: []string{"basic"},
+	}
+	for _, p := range pointers {
+		body.Objects = append(body.Objects, lfsObject{OID: p.oid, Size: p.size})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.href+"/objects/batch", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the lfs batch api: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to call the lfs batch api: %s", res.Status)
+	}
+
+	var payload lfsBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to parse the lfs batch api response: %w", err)
+	}
+
+	objects := make(map[lfsPointer]lfsObject, len(payload.Objects))
+	for _, o := range payload.Objects {
+		p := lfsPointer{oid: o.OID, size: o.Size}
+		if slices.Contains(pointers, p) {
+			objects[p] = o
+		}
+	}
+	return objects, nil
+}
+
+func (e lfsEndpoint) download(ctx context.Context, action lfsAction, dir string, p lfsPointer) error {
+	req, err := action.request(ctx, "GET", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download lfs object %s: %w", p.oid, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download lfs object %s: %s", p.oid, res.Status)
+	}
+
+	return writeLFSObject(res.Body, dir, p)
+}
+
+func (e lfsEndpoint) upload(ctx context.Context, action lfsAction, dir string, p lfsPointer) error {
+	f, err := os.Open(lfsObjectPath(dir, p.oid))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLFSObjectMissing, p.oid)
+	}
+	defer f.Close()
+
+	req, err := action.request(ctx, "PUT", f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = p.size
+	if len(req.Header.Get("Content-Type")) == 0 {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload lfs object %s: %w", p.oid, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to upload lfs object %s: %s", p.oid, res.Status)
+	}
+	return nil
+}
+
+func (e lfsEndpoint) verify(ctx context.Context, action lfsAction, p lfsPointer) error {
+	data, err := json.Marshal(lfsObject{OID: p.oid, Size: p.size})
+	if err != nil {
+		return err
+	}
+
+	req, err := action.request(ctx, "POST", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify lfs object %s: %w", p.oid, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to verify lfs object %s: %s", p.oid, res.Status)
+	}
+	return nil
+}
+
+func (a lfsAction) request(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.Href, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range a.Header {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func copyLFSObject(path, dir string, p lfsPointer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLFSObjectMissing, p.oid)
+	}
+	defer f.Close()
+
+	return writeLFSObject(f, dir, p)
+}
+
+// writeLFSObject stores the object in the lfs/objects directory of the
+// repository once its content has been checked.
+func writeLFSObject(r io.Reader, dir string, p lfsPointer) error {
+	path := lfsObjectPath(dir, p.oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to store lfs object %s: %w", p.oid, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), p.oid+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to store lfs object %s: %w", p.oid, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return fmt.Errorf("failed to store lfs object %s: %w", p.oid, err)
+	}
+	if n != p.size || hex.EncodeToString(h.Sum(nil)) != p.oid {
+		return fmt.Errorf("lfs object %s is corrupted", p.oid)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store lfs object %s: %w", p.oid, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store lfs object %s: %w", p.oid, err)
+	}
+	return nil
+}
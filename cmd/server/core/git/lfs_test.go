@@ -0,0 +1,180 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name    string
+		content string
+		want    *lfsPointer
+	}{
+		{name: "pointer", content: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n", want: &lfsPointer{oid: oid, size: 12345}},
+		{name: "legacy version", content: "version https://hawser.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\n", want: &lfsPointer{oid: oid, size: 1}},
+		{name: "regular file", content: "hello\n"},
+		{name: "no oid", content: "version https://git-lfs.github.com/spec/v1\nsize 1\n"},
+		{name: "other hash", content: "version https://git-lfs.github.com/spec/v1\noid sha1:" + oid[:40] + "\nsize 1\n"},
+		{name: "short oid", content: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid[:63] + "\nsize 1\n"},
+		{name: "oid not in hex", content: "version https://git-lfs.github.com/spec/v1\noid sha256:" + strings.Repeat("z", 64) + "\nsize 1\n"},
+		{name: "negative size", content: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize -1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLFSPointer([]byte(tt.content))
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("got %v, want no pointer", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("got %v, want %v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "group/repo.git", want: `'group/repo.git'`},
+		{path: "it's/repo.git", want: `'it'\''s/repo.git'`},
+		{path: "a b;rm -rf /", want: `'a b;rm -rf /'`},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.path); got != tt.want {
+			t.Errorf("quoted %q is %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLFSFetchBatch(t *testing.T) {
+	content := []byte("large file")
+	found := lfsPointer{oid: sha256Hex(content), size: int64(len(content))}
+	unknown := lfsPointer{oid: strings.Repeat("b", 64), size: 3}
+	refused := lfsPointer{oid: strings.Repeat("c", 64), size: 3}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r.git/info/lfs/objects/batch":
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var req lfsBatchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Operation != "download" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			res := lfsBatchResponse{Objects: []lfsObject{
+				{OID: found.oid, Size: found.size, Actions: map[string]lfsAction{"download": {Href: srv.URL + "/objects/" + found.oid}}},
+				{OID: refused.oid, Size: refused.size, Error: &lfsError{Code: 404, Message: "object does not exist"}},
+			}}
+			w.Header().Set("Content-Type", lfsMediaType)
+			_ = json.NewEncoder(w).Encode(res)
+		case "/objects/" + found.oid:
+			_, _ = w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	r := NewRepository("r", srv.URL+"/r", NewBasicAuthentication("user", "password"), nil, Settings{})
+	missing, err := lfsFetch(t.Context(), dir, r, []lfsPointer{found, unknown, refused})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		unknown.oid: "not returned by the source",
+		refused.oid: "object does not exist",
+	}
+	if fmt.Sprint(missing) != fmt.Sprint(want) {
+		t.Errorf("got missing %v, want %v", missing, want)
+	}
+	got, err := os.ReadFile(lfsObjectPath(dir, found.oid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("got object %q, want %q", got, content)
+	}
+}
+
+func TestLFSFetchRejectsCorruptedObjects(t *testing.T) {
+	p := lfsPointer{oid: sha256Hex([]byte("expected")), size: 8}
+	err := writeLFSObject(strings.NewReader("tampered"), t.TempDir(), p)
+	if err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("got %v, want a corrupted object", err)
+	}
+}
+
+func TestSyncHoldsRefsWithMissingLFSObjects(t *testing.T) {
+	src, srcPath := newSource(t)
+	plain := commit(t, src, "a", "1")
+	setRef(t, src, plumbing.NewBranchReferenceName("plain"), plain)
+
+	content := []byte("large file")
+	p := lfsPointer{oid: sha256Hex(content), size: int64(len(content))}
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", p.oid, p.size)
+	withLFS := commit(t, src, "large.bin", pointer)
+	mirror, mirrorPath := newBare(t)
+
+	c := newTestCache(t)
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{LFS: true})
+
+	// the object is not on the source, the ref that points to it is held
+	_, err := Sync(t.Context(), c, r)
+	var lerr *LFSMissingError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got %v, want %s", err, ErrLFSObjectMissing)
+	}
+	master := plumbing.NewBranchReferenceName("master")
+	if len(lerr.Refs) != 1 || lerr.Refs[0].Ref != master || lerr.Refs[0].OID != p.oid {
+		t.Errorf("got held refs %v, want %s", lerr.Refs, master)
+	}
+	refs := refsOf(t, mirror)
+	if refs[plumbing.NewBranchReferenceName("plain")] != plain {
+		t.Errorf("plain is %s on the mirror, want %s", refs[plumbing.NewBranchReferenceName("plain")], plain)
+	}
+	if _, ok := refs[master]; ok {
+		t.Errorf("master was pushed without its lfs object")
+	}
+
+	// once on the source, the object is copied then the ref pushed
+	if err := writeLFSObject(bytes.NewReader(content), filepath.Join(srcPath, ".git"), p); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, c, r)
+	if got := refsOf(t, mirror)[master]; got != withLFS {
+		t.Errorf("master is %s on the mirror, want %s", got, withLFS)
+	}
+	if _, err := os.Stat(lfsObjectPath(mirrorPath, p.oid)); err != nil {
+		t.Errorf("lfs object is not on the mirror: %s", err)
+	}
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type (
+	// Limits aborts a sync before a source that grew too much fills the
+	// memory or the disk of the daemon, 0 means unlimited.
+	Limits struct {
+		// MaxPackSize is the maximum size in bytes of a fetched pack
+		MaxPackSize int64
+		// MaxObjects is the maximum number of objects of a fetched pack
+		MaxObjects int64
+		// MaxRefs is the maximum number of source refs selected by the filters
+		MaxRefs int64
+	}
+
+	LimitError struct {
+		Limit string
+		Value int64
+		Max   int64
+	}
+)
+
+const (
+	LimitPackSize = "pack size"
+	LimitObjects  = "object count"
+	LimitRefs     = "ref count"
+	// LimitCacheSize is the size of the cache entry of the repository
+	LimitCacheSize = "cache size"
+)
+
+// limitsPollInterval is how often the packs being downloaded are checked
+const limitsPollInterval = 200 * time.Millisecond
+
+var (
+	ErrLimitExceeded error = errors.New("limit exceeded")
+)
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s is %d, the limit is %d", ErrLimitExceeded, e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Lower keeps the lowest limit of each kind, a limit of 0 does not lower
+// the other one.
+func (l Limits) Lower(o Limits) Limits {
+	lower := func(a, b int64) int64 {
+		if a <= 0 || (b > 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	return Limits{
+		MaxPackSize: lower(l.MaxPackSize, o.MaxPackSize),
+		MaxObjects:  lower(l.MaxObjects, o.MaxObjects),
+		MaxRefs:     lower(l.MaxRefs, o.MaxRefs),
+	}
+}
+
+func (l Limits) checkRefs(n int) error {
+	if l.MaxRefs > 0 && int64(n) > l.MaxRefs {
+		return &LimitError{Limit: LimitRefs, Value: int64(n), Max: l.MaxRefs}
+	}
+	return nil
+}
+
+// watch checks the packs written in the cache while fn fetches, the context
+// given to fn is canceled as soon as a pack exceeds the limits. The packs
+// are checked once more at the end, a small pack can be downloaded between
+// two checks.
+func (l Limits) watch(ctx context.Context, dir string, fn func(ctx context.Context) error) error {
+	if l.MaxPackSize <= 0 && l.MaxObjects <= 0 {
+		return fn(ctx)
+	}
+
+	packDir := filepath.Join(dir, "objects", "pack")
+	before := make(map[string]bool)
+	if entries, err := os.ReadDir(packDir); err == nil {
+		for _, e := range entries {
+			before[e.Name()] = true
+		}
+	}
+
+	watchCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(limitsPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+				if err := l.checkPacks(packDir, before); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(watchCtx)
+	cancel(nil)
+	<-done
+
+	if cause := context.Cause(watchCtx); errors.Is(cause, ErrLimitExceeded) {
+		return cause
+	}
+	if err != nil {
+		return err
+	}
+	return l.checkPacks(packDir, before)
+}
+
+// checkPacks reads the size and the object count of the packs that are not
+// in before, including the temporary packs being downloaded.
+func (l Limits) checkPacks(dir string, before map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if before[name] || e.IsDir() {
+			continue
+		}
+		if !strings.HasPrefix(name, "tmp_pack_") && !strings.HasSuffix(name, ".pack") {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if l.MaxPackSize > 0 && info.Size() > l.MaxPackSize {
+			return &LimitError{Limit: LimitPackSize, Value: info.Size(), Max: l.MaxPackSize}
+		}
+		if l.MaxObjects > 0 {
+			if n, ok := packObjects(filepath.Join(dir, name)); ok && n > l.MaxObjects {
+				return &LimitError{Limit: LimitObjects, Value: n, Max: l.MaxObjects}
+			}
+		}
+	}
+	return nil
+}
+
+// packObjects reads the object count in the header of a pack, false when
+// the header has not been written yet.
+func packObjects(path string) (int64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	// "PACK", the version then the number of objects
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header[:4], []byte("PACK")) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint32(header[8:])), true
+}
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestLimitsLower(t *testing.T) {
+	tests := []struct {
+		name       string
+		daemon     Limits
+		repository Limits
+		want       Limits
+	}{
+		{name: "no limits", want: Limits{}},
+		{name: "daemon only", daemon: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}, want: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}},
+		{name: "repository only", repository: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}, want: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}},
+		{name: "repository under the daemon", daemon: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}, repository: Limits{MaxPackSize: 50, MaxObjects: 5, MaxRefs: 2}, want: Limits{MaxPackSize: 50, MaxObjects: 5, MaxRefs: 2}},
+		{name: "daemon caps the repository", daemon: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}, repository: Limits{MaxPackSize: 200, MaxObjects: 20, MaxRefs: 10}, want: Limits{MaxPackSize: 100, MaxObjects: 10, MaxRefs: 5}},
+		{name: "mixed", daemon: Limits{MaxPackSize: 100}, repository: Limits{MaxPackSize: 200, MaxRefs: 2}, want: Limits{MaxPackSize: 100, MaxRefs: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.daemon.Lower(tt.repository); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncLimits(t *testing.T) {
+	src, srcPath := newSource(t)
+	commit(t, src, "a", "1")
+	h := commit(t, src, "b", "2")
+	setRef(t, src, plumbing.NewBranchReferenceName("dev"), h)
+
+	tests := []struct {
+		name   string
+		limits Limits
+		limit  string
+	}{
+		{name: "refs under the limit", limits: Limits{MaxRefs: 2}},
+		{name: "refs over the limit", limits: Limits{MaxRefs: 1}, limit: LimitRefs},
+		{name: "objects under the limit", limits: Limits{MaxObjects: 1000}},
+		{name: "objects over the limit", limits: Limits{MaxObjects: 2}, limit: LimitObjects},
+		{name: "pack under the limit", limits: Limits{MaxPackSize: 1 << 30}},
+		{name: "pack over the limit", limits: Limits{MaxPackSize: 10}, limit: LimitPackSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirror, mirrorPath := newBare(t)
+			c := newTestCache(t)
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{Limits: tt.limits})
+			_, err := Sync(t.Context(), c, r)
+
+			if len(tt.limit) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := refsOf(t, mirror)[plumbing.NewBranchReferenceName("dev")]; got != h {
+					t.Errorf("mirror dev is %s, want %s", got, h)
+				}
+				return
+			}
+
+			var lerr *LimitError
+			if !errors.As(err, &lerr) || lerr.Limit != tt.limit {
+				t.Fatalf("got %v, want the %s limit", err, tt.limit)
+			}
+			if len(refsOf(t, mirror)) != 0 {
+				t.Error("mirror was updated over the limit")
+			}
+			// the objects of an oversized pack are not kept, nothing is
+			// fetched over the ref limit
+			_, serr := os.Stat(c.dir("r"))
+			if kept := serr == nil; kept != (tt.limit == LimitRefs) {
+				t.Errorf("cache entry kept is %t", kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+type (
+	// localRunner serves the local repositories in process, like the file
+	// transport of go-git. Its command reads the stderr of the server while
+	// the server goroutine writes it, without synchronization, so the
+	// errors of the server are sent through stdout instead.
+	localRunner struct {
+		loader transport.Loader
+	}
+
+	localCommand struct {
+		ctx         context.Context
+		loader      transport.Loader
+		ep          *transport.Endpoint
+		service     transport.Service
+		gitProtocol string
+
+		stdin   *io.PipeReader
+		stdinW  *io.PipeWriter
+		stdout  *io.PipeWriter
+		stdoutR *io.PipeReader
+
+		close sync.Once
+	}
+)
+
+func init() {
+	transport.Register("file", transport.NewPackTransport(localRunner{loader: transport.DefaultLoader}))
+}
+
+func (r localRunner) Command(ctx context.Context, cmd string, ep *transport.Endpoint, auth transport.AuthMethod, params ...string) (transport.Command, error) {
+	switch transport.Service(cmd) {
+	case transport.UploadPackService, transport.ReceivePackService:
+	default:
+		return nil, transport.ErrUnsupportedService
+	}
+
+	return &localCommand{
+		ctx:         ctx,
+		loader:      r.loader,
+		ep:          ep,
+		service:     transport.Service(cmd),
+		gitProtocol: strings.Join(params, ":"),
+	}, nil
+}
+
+// StderrPipe returns no pipe, the session then does not read it.
+func (c *localCommand) StderrPipe() (io.Reader, error) {
+	return nil, nil
+}
+
+func (c *localCommand) StdinPipe() (io.WriteCloser, error) {
+	c.stdin, c.stdinW = io.Pipe()
+	return c.stdinW, nil
+}
+
+func (c *localCommand) StdoutPipe() (io.Reader, error) {
+	c.stdoutR, c.stdout = io.Pipe()
+	return c.stdoutR, nil
+}
+
+func (c *localCommand) Start() error {
+	st, err := c.loader.Load(c.ep)
+	if err != nil {
+		return err
+	}
+
+	var serve func() error
+	switch c.service {
+	case transport.UploadPackService:
+		serve = func() error {
+			return transport.UploadPack(c.ctx, st, io.NopCloser(c.stdin), c.stdout, &transport.UploadPackOptions{GitProtocol: c.gitProtocol})
+		}
+	case transport.ReceivePackService:
+		serve = func() error {
+			return transport.ReceivePack(c.ctx, st, io.NopCloser(c.stdin), c.stdout, &transport.ReceivePackOptions{GitProtocol: c.gitProtocol})
+		}
+	default:
+		return fmt.Errorf("unsupported service: %s", c.service)
+	}
+
+	go func() {
+		if err := serve(); err != nil {
+			// the client reads and writes fail with the error of the server
+			err = transport.NewRemoteError(err.Error())
+			c.stdout.CloseWithError(err)
+			c.stdin.CloseWithError(err)
+		}
+	}()
+	return nil
+}
+
+// Close closes the pipes of both sides, once.
+func (c *localCommand) Close() error {
+	c.close.Do(func() {
+		for _, p := range []io.Closer{c.stdin, c.stdinW, c.stdout, c.stdoutR} {
+			if p != nil {
+				p.Close()
+			}
+		}
+	})
+	return nil
+}
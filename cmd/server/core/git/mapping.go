@@ -0,0 +1,75 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// Mapping renames a source ref on the mirrors. From and To are full ref
+// names, a '*' in From matches any sequence of characters and is replaced
+// with the same sequence in To (e.g. refs/tags/* to refs/tags/upstream/*).
+type Mapping struct {
+	From string
+	To   string
+}
+
+func (m Mapping) apply(name string) (string, bool) {
+	prefix, suffix, wildcard := strings.Cut(m.From, "*")
+	if !wildcard {
+		if name != m.From {
+			return "", false
+		}
+		return m.To, true
+	}
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.Replace(m.To, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
+
+// mapName returns the name of a source ref on the mirrors, the first mapping
+// that matches is used and the refs that match none keep their name.
+func mapName(mappings []Mapping, name plumbing.ReferenceName) plumbing.ReferenceName {
+	for _, m := range mappings {
+		if to, ok := m.apply(name.String()); ok {
+			return plumbing.ReferenceName(to)
+		}
+	}
+	return name
+}
+
+// unmapName returns the name on the source of a mirror ref, false when no
+// source ref is mapped to it (e.g. a ref that only belongs to the mirror).
+func unmapName(mappings []Mapping, name plumbing.ReferenceName) (plumbing.ReferenceName, bool) {
+	for _, m := range mappings {
+		from, ok := Mapping{From: m.To, To: m.From}.apply(name.String())
+		if ok && mapName(mappings, plumbing.ReferenceName(from)) == name {
+			return plumbing.ReferenceName(from), true
+		}
+	}
+	if mapName(mappings, name) == name {
+		return name, true
+	}
+	return "", false
+}
+
+// mapRefs renames the source refs with their name on the mirrors.
+func mapRefs(refs []*plumbing.Reference, mappings []Mapping) ([]*plumbing.Reference, error) {
+	if len(mappings) == 0 {
+		return refs, nil
+	}
+
+	res := make([]*plumbing.Reference, 0, len(refs))
+	seen := make(map[plumbing.ReferenceName]plumbing.ReferenceName, len(refs))
+	for _, ref := range refs {
+		name := mapName(mappings, ref.Name())
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("refs %s and %s are both mapped to %s", other, ref.Name(), name)
+		}
+		seen[name] = ref.Name()
+		res = append(res, plumbing.NewHashReference(name, ref.Hash()))
+	}
+	return res, nil
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestMappingApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		ref     string
+		want    string
+		matched bool
+	}{
+		{name: "exact", mapping: Mapping{From: "refs/heads/main", To: "refs/heads/upstream"}, ref: "refs/heads/main", want: "refs/heads/upstream", matched: true},
+		{name: "exact not matching", mapping: Mapping{From: "refs/heads/main", To: "refs/heads/upstream"}, ref: "refs/heads/main2"},
+		{name: "glob", mapping: Mapping{From: "refs/tags/*", To: "refs/tags/upstream/*"}, ref: "refs/tags/v1.0", want: "refs/tags/upstream/v1.0", matched: true},
+		{name: "glob with suffix", mapping: Mapping{From: "refs/heads/*-rc", To: "refs/heads/rc/*"}, ref: "refs/heads/v2-rc", want: "refs/heads/rc/v2", matched: true},
+		{name: "glob not matching", mapping: Mapping{From: "refs/tags/*", To: "refs/tags/upstream/*"}, ref: "refs/heads/main"},
+		// the prefix and the suffix cannot overlap
+		{name: "glob shorter than its prefix and suffix", mapping: Mapping{From: "refs/heads/a*a", To: "refs/heads/*"}, ref: "refs/heads/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matched := tt.mapping.apply(tt.ref)
+			if matched != tt.matched || got != tt.want {
+				t.Errorf("got %q, %t, want %q, %t", got, matched, tt.want, tt.matched)
+			}
+		})
+	}
+}
+
+func TestUnmapName(t *testing.T) {
+	mappings := []Mapping{
+		{From: "refs/tags/*", To: "refs/tags/upstream/*"},
+		{From: "refs/heads/main", To: "refs/heads/upstream-main"},
+	}
+
+	tests := []struct {
+		name   string
+		mirror string
+		want   string
+		mapped bool
+	}{
+		{name: "glob", mirror: "refs/tags/upstream/v1.0", want: "refs/tags/v1.0", mapped: true},
+		{name: "exact", mirror: "refs/heads/upstream-main", want: "refs/heads/main", mapped: true},
+		{name: "not mapped", mirror: "refs/heads/dev", want: "refs/heads/dev", mapped: true},
+		// a source ref with this name would be mapped elsewhere
+		{name: "name of a mapped ref", mirror: "refs/heads/main"},
+		{name: "tag of the mirror", mirror: "refs/tags/v1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, mapped := unmapName(mappings, plumbing.ReferenceName(tt.mirror))
+			if mapped != tt.mapped || got.String() != tt.want {
+				t.Fatalf("got %q, %t, want %q, %t", got, mapped, tt.want, tt.mapped)
+			}
+			if mapped && mapName(mappings, got).String() != tt.mirror {
+				t.Errorf("%s is mapped to %s, want %s", got, mapName(mappings, got), tt.mirror)
+			}
+		})
+	}
+}
+
+func TestMapRefs(t *testing.T) {
+	hash := plumbing.NewHash("1111111111111111111111111111111111111111")
+	refs := func(names ...string) []*plumbing.Reference {
+		var res []*plumbing.Reference
+		for _, name := range names {
+			res = append(res, plumbing.NewHashReference(plumbing.ReferenceName(name), hash))
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		mappings []Mapping
+		refs     []*plumbing.Reference
+		want     []string
+		invalid  bool
+	}{
+		{name: "no mappings", refs: refs("refs/heads/main"), want: []string{"refs/heads/main"}},
+		{
+			name:     "mapped and kept refs",
+			mappings: []Mapping{{From: "refs/tags/*", To: "refs/tags/upstream/*"}},
+			refs:     refs("refs/heads/main", "refs/tags/v1"),
+			want:     []string{"refs/heads/main", "refs/tags/upstream/v1"},
+		},
+		{
+			name:     "first mapping wins",
+			mappings: []Mapping{{From: "refs/heads/main", To: "refs/heads/stable"}, {From: "refs/heads/*", To: "refs/heads/upstream/*"}},
+			refs:     refs("refs/heads/main", "refs/heads/dev"),
+			want:     []string{"refs/heads/stable", "refs/heads/upstream/dev"},
+		},
+		{
+			name:     "two refs mapped to one",
+			mappings: []Mapping{{From: "refs/heads/main", To: "refs/heads/stable"}},
+			refs:     refs("refs/heads/main", "refs/heads/stable"),
+			invalid:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapRefs(tt.refs, tt.mappings)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("got refs %v, want a collision error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i, ref := range got {
+				if ref.Name().String() != tt.want[i] || ref.Hash() != hash {
+					t.Errorf("got %s, want %s %s", ref, hash, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+type (
+	// Mismatch is a mirror ref that does not have the value that was pushed,
+	// e.g. when a server-side hook drops it without failing the push.
+	Mismatch struct {
+		Ref plumbing.ReferenceName
+		// Expected is the hash pushed by the sync
+		Expected plumbing.Hash
+		// Actual is the hash on the mirror, zero when the ref is missing
+		Actual plumbing.Hash
+	}
+
+	MismatchError struct {
+		Refs []Mismatch
+	}
+)
+
+var (
+	ErrMismatch error = errors.New("mirror does not match the pushed refs")
+)
+
+func (e *MismatchError) Error() string {
+	var refs []string
+	for _, m := range e.Refs {
+		refs = append(refs, m.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrMismatch, strings.Join(refs, ", "))
+}
+
+func (e *MismatchError) Unwrap() error {
+	return ErrMismatch
+}
+
+func (m Mismatch) String() string {
+	if m.Actual.IsZero() {
+		return fmt.Sprintf("%s (missing, expected %s)", m.Ref, m.Expected)
+	}
+	return fmt.Sprintf("%s (%s, expected %s)", m.Ref, m.Actual, m.Expected)
+}
+
+// checkMirror compares the refs of the mirror after a push with the source
+// refs, with their name on the mirror. The refs that were left untouched on
+// purpose (diverged, in conflict or not verified) are skipped.
+func checkMirror(current map[plumbing.ReferenceName]plumbing.Hash, refs []*plumbing.Reference, skipped map[plumbing.ReferenceName]bool, s Settings) ([]Mismatch, error) {
+	// nothing is pushed from an empty source
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	refs, err := mapRefs(refs, s.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	for _, ref := range refs {
+		if skipped[ref.Name()] {
+			continue
+		}
+		if h := current[ref.Name()]; h != ref.Hash() {
+			mismatches = append(mismatches, Mismatch{Ref: ref.Name(), Expected: ref.Hash(), Actual: h})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Ref < mismatches[j].Ref
+	})
+	return mismatches, nil
+}
@@ -0,0 +1,76 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// Prune tells which mirror refs are deleted when they are not on the source
+// anymore.
+type Prune string
+
+const (
+	// PruneNever keeps every mirror ref (default)
+	PruneNever Prune = "never"
+	// PruneAlways deletes every mirror ref that is not on the source
+	PruneAlways Prune = "always"
+	// PruneMatching only deletes the mirror refs selected by the ref filters,
+	// the refs that only exist on the mirror are kept
+	PruneMatching Prune = "only-matching-filters"
+)
+
+// internalNamespace holds the refs written by mirror-sync itself, they are
+// never pruned.
+const internalNamespace = "refs/mirror-sync/"
+
+// isProtected tells if the mirror ref must never be deleted or rewritten.
+// The patterns are full ref names (e.g. refs/tags/v*).
+func (s Settings) isProtected(name plumbing.ReferenceName) bool {
+	protected := s.protected
+	// the settings were not made by NewRepository
+	if protected == nil {
+		protected = compileGlobs(s.Protected)
+	}
+	return protected.match(name.String())
+}
+
+// prunedRefs lists the mirror refs to delete, refs are the refs pushed to
+// the mirror with their mirror name. In matching mode, a mirror ref is only
+// deleted when it is the name of a source ref selected by the filters.
+func prunedRefs(current map[plumbing.ReferenceName]plumbing.Hash, refs []*plumbing.Reference, s Settings) []plumbing.ReferenceName {
+	if s.Prune != PruneAlways && s.Prune != PruneMatching {
+		return nil
+	}
+
+	pushed := make(map[plumbing.ReferenceName]bool, len(refs))
+	for _, ref := range refs {
+		pushed[ref.Name()] = true
+	}
+
+	var res []plumbing.ReferenceName
+	for name := range current {
+		if pushed[name] || name == plumbing.HEAD || strings.HasPrefix(name.String(), internalNamespace) {
+			continue
+		}
+		if s.isProtected(name) {
+			continue
+		}
+		if s.Prune == PruneMatching {
+			if src, ok := unmapName(s.Mappings, name); !ok || !s.Refs.Match(src) {
+				continue
+			}
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+func deleteRefSpecs(names []plumbing.ReferenceName) []config.RefSpec {
+	specs := make([]config.RefSpec, 0, len(names))
+	for _, name := range names {
+		specs = append(specs, config.RefSpec(":"+name.String()))
+	}
+	return specs
+}
@@ -0,0 +1,101 @@
+package git
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestPrunedRefs(t *testing.T) {
+	h := plumbing.NewHash("1111111111111111111111111111111111111111")
+	current := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/main":       h,
+		"refs/heads/old":        h,
+		"refs/heads/release/1":  h,
+		"refs/heads/wip/x":      h,
+		"refs/tags/v1":          h,
+		"refs/notes/commits":    h,
+		"refs/mirror-sync/none": h,
+		"HEAD":                  h,
+	}
+	pushed := []*plumbing.Reference{plumbing.NewHashReference("refs/heads/main", h)}
+
+	tests := []struct {
+		name string
+		s    Settings
+		want []plumbing.ReferenceName
+	}{
+		{name: "default keeps everything", s: Settings{}},
+		{name: "never keeps everything", s: Settings{Prune: PruneNever}},
+		{
+			name: "always deletes the refs not pushed",
+			s:    Settings{Prune: PruneAlways},
+			want: []plumbing.ReferenceName{"refs/heads/old", "refs/heads/release/1", "refs/heads/wip/x", "refs/notes/commits", "refs/tags/v1"},
+		},
+		{
+			name: "protected refs survive",
+			s:    Settings{Prune: PruneAlways, Protected: []string{"refs/heads/release/*", "refs/tags/*"}},
+			want: []plumbing.ReferenceName{"refs/heads/old", "refs/heads/wip/x", "refs/notes/commits"},
+		},
+		{
+			name: "matching only deletes the refs selected by the filters",
+			s: Settings{
+				Prune: PruneMatching,
+				Refs:  NewRefFilter(Patterns{Exclude: []string{"wip/*"}}, Patterns{Exclude: []string{"*"}}, Patterns{Include: []string{"refs/pull/*"}}),
+			},
+			want: []plumbing.ReferenceName{"refs/heads/old", "refs/heads/release/1"},
+		},
+		{
+			name: "matching with protected refs",
+			s: Settings{
+				Prune:     PruneMatching,
+				Protected: []string{"refs/heads/old"},
+			},
+			want: []plumbing.ReferenceName{"refs/heads/release/1", "refs/heads/wip/x", "refs/notes/commits", "refs/tags/v1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prunedRefs(current, pushed, tt.s)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	src, srcPath := newBare(t)
+	mirror, mirrorPath := newBare(t)
+	h := newHistory(t, src, mirror)
+
+	setRef(t, src, "refs/heads/main", h.c2)
+	for _, name := range []plumbing.ReferenceName{"refs/heads/main", "refs/heads/old", "refs/heads/keep/x", "refs/tags/v1"} {
+		setRef(t, mirror, name, h.c1)
+	}
+
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+mirrorPath, NoAuthentication{})}, Settings{
+		Prune:     PruneMatching,
+		Refs:      NewRefFilter(Patterns{}, Patterns{Exclude: []string{"*"}}, Patterns{}),
+		Protected: []string{"refs/heads/keep/*"},
+	})
+	mustSync(t, newTestCache(t), r)
+
+	want := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/main":   h.c2,
+		"refs/heads/keep/x": h.c1,
+		"refs/tags/v1":      h.c1,
+	}
+	got := refsOf(t, mirror)
+	if len(got) != len(want) {
+		t.Errorf("got mirror refs %v, want %v", got, want)
+	}
+	for name, h := range want {
+		if got[name] != h {
+			t.Errorf("mirror %s is %s, want %s", name, got[name], h)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+type (
+	// PushOptions change the push of the synced refs to a mirror.
+	PushOptions struct {
+		// Options are sent to the server like with git push -o (e.g.
+		// ci.skip on GitLab)
+		Options []string
+		// Atomic updates every ref or none of them
+		Atomic bool
+	}
+
+	UnsupportedError struct {
+		Feature string
+	}
+)
+
+var (
+	ErrUnsupported error = errors.New("not supported by the mirror")
+)
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s are %s", e.Feature, ErrUnsupported)
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return ErrUnsupported
+}
+
+// WithPushOptions returns the mirror with the given push options.
+func (m Mirror) WithPushOptions(o PushOptions) Mirror {
+	m.push = o
+	return m
+}
+
+// checkPush makes sure the mirror supports the push options, go-git would
+// silently push without them.
+func (m Mirror) checkPush(ctx context.Context) error {
+	if !m.push.Atomic && len(m.push.Options) == 0 {
+		return nil
+	}
+
+	ep, err := transport.NewEndpoint(m.url)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+	t, err := transport.Get(ep.Protocol)
+	if err != nil {
+		return err
+	}
+	s, err := t.NewSession(nil, ep, m.auth.Value())
+	if err != nil {
+		return err
+	}
+	conn, err := s.Handshake(ctx, transport.ReceivePackService)
+	if err != nil {
+		return fmt.Errorf("failed to connect to mirror: %w", err)
+	}
+	defer conn.Close()
+
+	caps := conn.Capabilities()
+	if m.push.Atomic && !caps.Supports(capability.Atomic) {
+		return &UnsupportedError{Feature: "atomic pushes"}
+	}
+	if len(m.push.Options) > 0 && !caps.Supports(capability.PushOptions) {
+		return &UnsupportedError{Feature: "push options"}
+	}
+	return nil
+}
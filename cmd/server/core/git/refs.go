@@ -0,0 +1,163 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+type (
+	// Patterns is a list of globs, '*' matches any sequence of characters
+	// including '/', like in a git refspec.
+	Patterns struct {
+		Include []string
+		Exclude []string
+	}
+
+	// RefFilter selects the refs that are mirrored. Branch and tag patterns
+	// are relative to refs/heads/ and refs/tags/, the other patterns are
+	// full ref names (e.g. refs/notes/*).
+	RefFilter struct {
+		branches patterns
+		tags     patterns
+		others   patterns
+	}
+
+	// patterns are the compiled globs of Patterns
+	patterns struct {
+		include globs
+		exclude globs
+	}
+
+	// glob is a pattern split on its '*', it is compiled once and matched
+	// without allocating
+	glob  []string
+	globs []glob
+)
+
+func NewRefFilter(branches, tags, others Patterns) RefFilter {
+	return RefFilter{
+		branches: branches.compile(),
+		tags:     tags.compile(),
+		others:   others.compile(),
+	}
+}
+
+// Match tells if the ref has to be mirrored. An empty include list keeps
+// every ref of its kind, the refs of mirror-sync itself are never mirrored.
+func (f RefFilter) Match(name plumbing.ReferenceName) bool {
+	if name == plumbing.HEAD || strings.HasPrefix(name.String(), internalNamespace) {
+		return false
+	}
+
+	switch {
+	case name.IsBranch():
+		return f.branches.match(name.Short())
+	case name.IsTag():
+		return f.tags.match(name.Short())
+	default:
+		return f.others.match(name.String())
+	}
+}
+
+// MatchExplicit tells if the ref has to be mirrored, like Match, but the
+// refs other than branches and tags are only selected by an include
+// pattern. The forges create refs of their own, like refs/pull/*, that an
+// empty include list would select.
+func (f RefFilter) MatchExplicit(name plumbing.ReferenceName) bool {
+	if !f.Match(name) {
+		return false
+	}
+	return name.IsBranch() || name.IsTag() || len(f.others.include) > 0
+}
+
+func (p Patterns) compile() patterns {
+	return patterns{
+		include: compileGlobs(p.Include),
+		exclude: compileGlobs(p.Exclude),
+	}
+}
+
+func (p patterns) match(name string) bool {
+	if p.exclude.match(name) {
+		return false
+	}
+	return len(p.include) == 0 || p.include.match(name)
+}
+
+func compileGlob(pattern string) glob {
+	return strings.Split(pattern, "*")
+}
+
+func compileGlobs(patterns []string) globs {
+	if len(patterns) == 0 {
+		return nil
+	}
+	res := make(globs, 0, len(patterns))
+	for _, p := range patterns {
+		res = append(res, compileGlob(p))
+	}
+	return res
+}
+
+// match tells if the name matches the whole pattern, a '*' matches any
+// sequence of characters. The parts between the stars are matched at their
+// first occurrence, which is enough without other wildcards.
+func (g glob) match(name string) bool {
+	if len(g) == 1 {
+		return name == g[0]
+	}
+	if !strings.HasPrefix(name, g[0]) {
+		return false
+	}
+	name = name[len(g[0]):]
+	for _, part := range g[1 : len(g)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return strings.HasSuffix(name, g[len(g)-1])
+}
+
+// match tells if the name matches one of the patterns
+func (gs globs) match(name string) bool {
+	for _, g := range gs {
+		if g.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRefs keeps the refs pointing to an object that have to be mirrored.
+func filterRefs(refs []*plumbing.Reference, f RefFilter) []*plumbing.Reference {
+	var res []*plumbing.Reference
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		if !f.Match(ref.Name()) {
+			continue
+		}
+		res = append(res, ref)
+	}
+	return res
+}
+
+// refSpecs makes one explicit refspec per ref, go-git does not support
+// negative refspecs so the filters cannot be expressed with wildcards.
+func refSpecs(refs []*plumbing.Reference, force bool) []config.RefSpec {
+	prefix := ""
+	if force {
+		prefix = "+"
+	}
+
+	specs := make([]config.RefSpec, 0, len(refs))
+	for _, ref := range refs {
+		specs = append(specs, config.RefSpec(prefix+ref.Name().String()+":"+ref.Name().String()))
+	}
+	return specs
+}
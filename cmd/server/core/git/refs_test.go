@@ -0,0 +1,100 @@
+package git
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "main", name: "main", want: true},
+		{pattern: "main", name: "main2", want: false},
+		{pattern: "main", name: "feature/main", want: false},
+		{pattern: "*", name: "", want: true},
+		{pattern: "*", name: "feature/x", want: true},
+		{pattern: "**", name: "feature/x/y", want: true},
+		{pattern: "feature/*", name: "feature/x", want: true},
+		{pattern: "feature/*", name: "feature/x/y", want: true},
+		{pattern: "feature/*", name: "feature", want: false},
+		{pattern: "feature/**", name: "feature/x/y", want: true},
+		{pattern: "*/main", name: "release/main", want: true},
+		{pattern: "*/main", name: "release/main/x", want: false},
+		{pattern: "v*.*", name: "v1.2", want: true},
+		{pattern: "v*.*", name: "v12", want: false},
+		{pattern: "a*b*b", name: "abb", want: true},
+		{pattern: "a*b*b", name: "ab", want: false},
+		{pattern: "ab*b", name: "ab", want: false},
+		{pattern: "*-rc", name: "v1-rc", want: true},
+		{pattern: "*-rc", name: "v1-rc1", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := compileGlob(tt.pattern).match(tt.name); got != tt.want {
+			t.Errorf("%q matching %q: got %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefFilterMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches Patterns
+		tags     Patterns
+		others   Patterns
+		ref      plumbing.ReferenceName
+		want     bool
+	}{
+		{name: "no filter keeps branches", ref: "refs/heads/main", want: true},
+		{name: "no filter keeps tags", ref: "refs/tags/v1", want: true},
+		{name: "no filter keeps other refs", ref: "refs/notes/commits", want: true},
+		{name: "HEAD is never mirrored", ref: plumbing.HEAD, want: false},
+		{name: "internal refs are never mirrored", ref: "refs/mirror-sync/backup/refs/heads/main", want: false},
+		{name: "included branch", branches: Patterns{Include: []string{"main"}}, ref: "refs/heads/main", want: true},
+		{name: "branch not included", branches: Patterns{Include: []string{"main"}}, ref: "refs/heads/dev", want: false},
+		{name: "branch patterns use short names", branches: Patterns{Include: []string{"refs/heads/main"}}, ref: "refs/heads/main", want: false},
+		{name: "tag patterns use short names", tags: Patterns{Include: []string{"v*"}}, ref: "refs/tags/v1.0", want: true},
+		{name: "other patterns use full names", others: Patterns{Include: []string{"refs/notes/*"}}, ref: "refs/notes/commits", want: true},
+		{name: "other patterns do not match short names", others: Patterns{Include: []string{"notes/*"}}, ref: "refs/notes/commits", want: false},
+		{name: "exclude wins over include", branches: Patterns{Include: []string{"feature/*"}, Exclude: []string{"feature/wip-*"}}, ref: "refs/heads/feature/wip-x", want: false},
+		{name: "exclude only", branches: Patterns{Exclude: []string{"wip/**"}}, ref: "refs/heads/wip/a/b", want: false},
+		{name: "exclude only keeps the rest", branches: Patterns{Exclude: []string{"wip/**"}}, ref: "refs/heads/main", want: true},
+		{name: "branch filters do not apply to tags", branches: Patterns{Include: []string{"main"}}, ref: "refs/tags/v1", want: true},
+		{name: "tag filters do not apply to branches", tags: Patterns{Exclude: []string{"*"}}, ref: "refs/heads/main", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewRefFilter(tt.branches, tt.tags, tt.others)
+			if got := f.Match(tt.ref); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterRefs(t *testing.T) {
+	h := plumbing.NewHash("1111111111111111111111111111111111111111")
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/main", h),
+		plumbing.NewHashReference("refs/heads/dev", h),
+		plumbing.NewSymbolicReference("refs/heads/alias", "refs/heads/main"),
+		plumbing.NewHashReference("refs/tags/v1", h),
+	}
+
+	got := filterRefs(refs, NewRefFilter(Patterns{Exclude: []string{"dev"}}, Patterns{}, Patterns{}))
+
+	var names []plumbing.ReferenceName
+	for _, ref := range got {
+		names = append(names, ref.Name())
+	}
+	want := []plumbing.ReferenceName{"refs/heads/main", "refs/tags/v1"}
+	if !slices.Equal(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,245 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+type (
+	// Shallow limits the history fetched from the source, for the
+	// repositories too big to be mirrored whole. The zero value fetches the
+	// whole history.
+	Shallow struct {
+		// Depth is the number of commits fetched from the tip of each ref
+		Depth int
+		// Since fetches the commits made after the date, Within the ones
+		// made in the period before each sync
+		Since  time.Time
+		Within time.Duration
+	}
+
+	// ShallowError is a push that needs commits below the shallow boundary
+	// of the cache, the mirror does not have them and they cannot be sent.
+	ShallowError struct {
+		Err error
+	}
+)
+
+// shallowSinceDepth is the depth of the first fetch of a date limited
+// history, it is doubled until the date is reached
+const shallowSinceDepth = 64
+
+var (
+	ErrShallow error = errors.New("mirror does not have the history below the shallow boundary")
+)
+
+// shallowRejections are the errors of the servers that refuse a pack whose
+// commits have missing parents
+var shallowRejections = []string{
+	"missing necessary objects",
+	"shallow update not allowed",
+	"did not receive expected object",
+}
+
+func (e *ShallowError) Error() string {
+	if e.Err == nil {
+		return ErrShallow.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrShallow, e.Err)
+}
+
+func (e *ShallowError) Unwrap() error {
+	return ErrShallow
+}
+
+func (s Shallow) enabled() bool {
+	return s.Depth > 0 || !s.Since.IsZero() || s.Within > 0
+}
+
+// since returns the date of the oldest commit to fetch, zero when the
+// history is only limited by depth.
+func (s Shallow) since(now time.Time) time.Time {
+	if s.Within > 0 {
+		return now.Add(-s.Within)
+	}
+	return s.Since
+}
+
+// shallowFetch fetches the refs with a limited history. go-git only
+// supports a depth, a date is reached by deepening the history until the
+// commits at the boundary are older than it.
+func shallowFetch(ctx context.Context, repo *git.Repository, src *git.Remote, o git.FetchOptions, s Shallow) error {
+	o.Depth = s.Depth
+	if o.Depth <= 0 {
+		o.Depth = shallowSinceDepth
+	}
+	since := s.since(time.Now())
+
+	var previous []plumbing.Hash
+	for {
+		err := src.FetchContext(ctx, &o)
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return err
+		}
+		boundary, err := markShallow(repo)
+		if err != nil {
+			return err
+		}
+		// the history is complete or the server ignores the depth
+		if since.IsZero() || len(boundary) == 0 || slices.Equal(boundary, previous) {
+			return nil
+		}
+
+		recent := false
+		for _, h := range boundary {
+			c, err := object.GetCommit(repo.Storer, h)
+			if err != nil {
+				return fmt.Errorf("failed to read shallow commit %s: %w", h, err)
+			}
+			if c.Committer.When.After(since) {
+				recent = true
+				break
+			}
+		}
+		if !recent {
+			return nil
+		}
+		previous = boundary
+		o.Depth *= 2
+	}
+}
+
+// markShallow finds the commits of the cache whose parents are missing and
+// records them as its shallow commits, go-git does not keep the ones sent
+// by the server. They are returned sorted.
+func markShallow(repo *git.Repository) ([]plumbing.Hash, error) {
+	refs, err := localRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	var pending []plumbing.Hash
+	for _, ref := range refs {
+		c, err := peel(repo, ref.Hash())
+		if err != nil {
+			// refs pointing to trees or blobs have no history
+			continue
+		}
+		pending = append(pending, c.Hash)
+	}
+
+	var boundary []plumbing.Hash
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+
+		c, err := object.GetCommit(repo.Storer, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+		shallow := false
+		for _, p := range c.ParentHashes {
+			if err := repo.Storer.HasEncodedObject(p); err != nil {
+				shallow = true
+				continue
+			}
+			pending = append(pending, p)
+		}
+		if shallow {
+			boundary = append(boundary, h)
+		}
+	}
+
+	slices.SortFunc(boundary, func(a, b plumbing.Hash) int {
+		return a.Compare(b.Bytes())
+	})
+	if err := repo.Storer.SetShallow(boundary); err != nil {
+		return nil, fmt.Errorf("failed to write shallow commits: %w", err)
+	}
+	return boundary, nil
+}
+
+// shallowStops returns the missing parents of the shallow commits of the
+// cache, the history walks must stop there.
+func shallowStops(repo *git.Repository) ([]plumbing.Hash, error) {
+	shallows, err := repo.Storer.Shallow()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+
+	var stops []plumbing.Hash
+	for _, h := range shallows {
+		c, err := object.GetCommit(repo.Storer, h)
+		if err != nil {
+			continue
+		}
+		for _, p := range c.ParentHashes {
+			if err := repo.Storer.HasEncodedObject(p); err != nil {
+				stops = append(stops, p)
+			}
+		}
+	}
+	return stops, nil
+}
+
+// checkShallow makes sure a local mirror has the history below the shallow
+// boundary of the cache, the missing parents of the shallow commits, before
+// pushing to it. go-git never sends them and, unlike git, it accepts a pack
+// with missing objects in a local repository. The other mirrors are not
+// checked, the servers refuse such a pack and the push fails with
+// shallowRejection.
+func checkShallow(repo *git.Repository, url string) error {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil || ep.Protocol != "file" {
+		return nil
+	}
+	stops, err := shallowStops(repo)
+	if err != nil {
+		return err
+	}
+	if len(stops) == 0 {
+		return nil
+	}
+
+	dst, err := git.PlainOpen(ep.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open local repository: %w", err)
+	}
+	for _, h := range stops {
+		if err := dst.Storer.HasEncodedObject(h); err != nil {
+			return &ShallowError{Err: fmt.Errorf("commit %s is missing", h)}
+		}
+	}
+	return nil
+}
+
+// shallowRejection tells if a push error is a mirror refusing a pack that
+// does not have the history below the shallow boundary.
+func shallowRejection(repo *git.Repository, err error) error {
+	if err == nil {
+		return nil
+	}
+	if shallows, serr := repo.Storer.Shallow(); serr != nil || len(shallows) == 0 {
+		return err
+	}
+	for _, r := range shallowRejections {
+		if strings.Contains(err.Error(), r) {
+			return &ShallowError{Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,203 @@
+package git
+
+import (
+	"errors"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// datedHistory commits n empty commits on master of the repository, one minute
+// apart from the test signature date, and returns them oldest first.
+func datedHistory(t *testing.T, repo *git.Repository, n int) []plumbing.Hash {
+	t.Helper()
+	tree := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []plumbing.Hash
+	for i := range n {
+		sig := signature
+		sig.When = sig.When.Add(time.Duration(i) * time.Minute)
+		c := &object.Commit{
+			Author:    sig,
+			Committer: sig,
+			Message:   "commit",
+			TreeHash:  treeHash,
+		}
+		if i > 0 {
+			c.ParentHashes = []plumbing.Hash{hashes[i-1]}
+		}
+		obj := repo.Storer.NewEncodedObject()
+		if err := c.Encode(obj); err != nil {
+			t.Fatal(err)
+		}
+		h, err := repo.Storer.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, h)
+	}
+	setRef(t, repo, plumbing.NewBranchReferenceName("master"), hashes[n-1])
+	return hashes
+}
+
+// gitServer serves the repositories in root with git http-backend, the
+// go-git server sends the whole history whatever the depth.
+func gitServer(t *testing.T, root string) string {
+	t.Helper()
+	path, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	srv := httptest.NewServer(&cgi.Handler{
+		Path: path,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newServedSource creates an empty bare repository served by git
+// http-backend, with its url.
+func newServedSource(t *testing.T) (*git.Repository, string) {
+	t.Helper()
+	root := t.TempDir()
+	repo, err := git.PlainInit(filepath.Join(root, "r.git"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, gitServer(t, root) + "/r.git"
+}
+
+func TestSyncShallow(t *testing.T) {
+	tests := []struct {
+		name    string
+		commits int
+		shallow Shallow
+		// fetched is the index of the oldest fetched commit
+		fetched int
+	}{
+		// the new commit pushed to the mirror is on top of the history
+		{name: "depth", commits: 10, shallow: Shallow{Depth: 3}, fetched: 8},
+		{name: "depth longer than the history", commits: 10, shallow: Shallow{Depth: 20}},
+		// the first fetch stops at commit 37, older than the date
+		{name: "since", commits: 100, shallow: Shallow{Since: signature.When.Add(50 * time.Minute)}, fetched: 37},
+		// the first fetch stops at commit 87, the second one at commit 23
+		{name: "since deepened", commits: 150, shallow: Shallow{Since: signature.When.Add(50 * time.Minute)}, fetched: 23},
+		{name: "since older than the history", commits: 150, shallow: Shallow{Since: signature.When.Add(-time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcPath := newServedSource(t)
+			hashes := datedHistory(t, src, tt.commits)
+
+			// the mirror has the whole history, only the new commits are
+			// pushed
+			dst, dstPath := newBare(t)
+			full := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+dstPath, NoAuthentication{})}, Settings{})
+			mustSync(t, newTestCache(t), full)
+			tip := newCommit(t, src, "new", hashes[len(hashes)-1])
+			setRef(t, src, plumbing.NewBranchReferenceName("master"), tip)
+
+			c := newTestCache(t)
+			r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+dstPath, NoAuthentication{})}, Settings{Mode: ModeForce, Shallow: tt.shallow})
+			mustSync(t, c, r)
+
+			repo := openCache(t, c, "r")
+			if n, want := countCommits(t, repo), len(hashes)-tt.fetched+1; n != want {
+				t.Errorf("cache has %d commits, want %d", n, want)
+			}
+			shallows, err := repo.Storer.Shallow()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []plumbing.Hash
+			if tt.fetched > 0 {
+				want = []plumbing.Hash{hashes[tt.fetched]}
+			}
+			if !slices.Equal(shallows, want) {
+				t.Errorf("got shallow commits %v, want %v", shallows, want)
+			}
+			if h := refsOf(t, dst)[plumbing.NewBranchReferenceName("master")]; h != tip {
+				t.Errorf("mirror master is %s, want %s", h, tip)
+			}
+		})
+	}
+}
+
+func TestSyncShallowMissingHistory(t *testing.T) {
+	src, srcPath := newServedSource(t)
+	datedHistory(t, src, 10)
+	dst, dstPath := newBare(t)
+
+	r := NewRepository("r", srcPath, NoAuthentication{}, []Mirror{NewMirror("m", "file://"+dstPath, NoAuthentication{})}, Settings{Mode: ModeForce, Shallow: Shallow{Depth: 3}})
+	res, err := Sync(t.Context(), newTestCache(t), r)
+	if !errors.Is(err, ErrShallow) {
+		t.Fatalf("got error %v, want %v", err, ErrShallow)
+	}
+	if !errors.Is(res.Mirrors[0].Err, ErrShallow) {
+		t.Errorf("got mirror error %v, want %v", res.Mirrors[0].Err, ErrShallow)
+	}
+	// nothing is pushed to a mirror that would be left with missing objects
+	if refs := refsOf(t, dst); len(refs) > 0 {
+		t.Errorf("mirror has refs %v", refs)
+	}
+}
+
+func TestSyncShallowKnownHistory(t *testing.T) {
+	src, srcPath := newServedSource(t)
+	hashes := datedHistory(t, src, 10)
+	dst, dstPath := newBare(t)
+	mirrors := []Mirror{NewMirror("m", "file://"+dstPath, NoAuthentication{})}
+
+	// the mirror has the history below the boundary of the shallow cache
+	master := plumbing.NewBranchReferenceName("master")
+	setRef(t, src, master, hashes[6])
+	mustSync(t, newTestCache(t), NewRepository("r", srcPath, NoAuthentication{}, mirrors, Settings{}))
+	setRef(t, src, master, hashes[9])
+
+	r := NewRepository("r", srcPath, NoAuthentication{}, mirrors, Settings{Shallow: Shallow{Depth: 3}})
+	mustSync(t, newTestCache(t), r)
+	if got := refsOf(t, dst)[master]; got != hashes[9] {
+		t.Errorf("mirror master is %s, want %s", got, hashes[9])
+	}
+}
+
+func TestShallowSince(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		shallow Shallow
+		want    time.Time
+	}{
+		{name: "depth", shallow: Shallow{Depth: 3}},
+		{name: "since", shallow: Shallow{Since: since}, want: since},
+		{name: "within", shallow: Shallow{Within: 24 * time.Hour}, want: now.Add(-24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.shallow.since(now); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
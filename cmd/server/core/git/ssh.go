@@ -0,0 +1,113 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	ErrHostKeyMismatch error = errors.New("ssh host key does not match")
+	ErrHostKeyUnknown  error = errors.New("ssh host key is not in known_hosts")
+)
+
+// hostKeyCallback pins the server key, either with a fingerprint or with
+// the content of a known_hosts file. Without any of them, the known_hosts
+// files of the user running the daemon are used.
+func hostKeyCallback(knownHosts []byte, fingerprint string) (ssh.HostKeyCallback, error) {
+	if len(fingerprint) > 0 {
+		return fingerprintCallback(fingerprint), nil
+	}
+	if len(knownHosts) > 0 {
+		return knownHostsCallback(knownHosts)
+	}
+	return userKnownHostsCallback, nil
+}
+
+// userKnownHostsCallback reads the known_hosts files of the daemon user on
+// each connection, the files of SSH_KNOWN_HOSTS or else ~/.ssh/known_hosts
+// and /etc/ssh/ssh_known_hosts. A missing file only fails the sync of the
+// repository that connects, not the loading of its whole project.
+func userKnownHostsCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	files := filepath.SplitList(os.Getenv("SSH_KNOWN_HOSTS"))
+	if len(files) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+	}
+	files = slices.DeleteFunc(files, func(file string) bool {
+		_, err := os.Stat(file)
+		return err != nil
+	})
+	if len(files) == 0 {
+		return fmt.Errorf("%w: %s, set known_hosts or host_key_fingerprint, the daemon has no known_hosts file", ErrHostKeyUnknown, hostname)
+	}
+
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return fmt.Errorf("failed to parse known_hosts: %w", err)
+	}
+	return checkKnownHosts(callback, hostname, remote, key)
+}
+
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if ssh.FingerprintSHA256(key) == fingerprint || ssh.FingerprintLegacyMD5(key) == strings.TrimPrefix(fingerprint, "MD5:") {
+			return nil
+		}
+		return fmt.Errorf("%w: %s presented %s", ErrHostKeyMismatch, hostname, ssh.FingerprintSHA256(key))
+	}
+}
+
+// knownHostsCallback checks the host key against the content of a
+// known_hosts file, in the whole OpenSSH format: hashed hosts, wildcards,
+// negated patterns, certificate authorities and revoked keys.
+func knownHostsCallback(content []byte) (ssh.HostKeyCallback, error) {
+	// the parser of x/crypto only reads files
+	f, err := os.CreateTemp("", "known_hosts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse known_hosts: %w", err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return checkKnownHosts(callback, hostname, remote, key)
+	}, nil
+}
+
+// checkKnownHosts calls the known_hosts callback and turns its key errors
+// into ErrHostKeyMismatch and ErrHostKeyUnknown.
+func checkKnownHosts(callback ssh.HostKeyCallback, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := callback(hostname, remote, key)
+	var kerr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &kerr) && len(kerr.Want) > 0:
+		return fmt.Errorf("%w: %s presented %s", ErrHostKeyMismatch, hostname, ssh.FingerprintSHA256(key))
+	case errors.As(err, &kerr):
+		return fmt.Errorf("%w: %s", ErrHostKeyUnknown, hostname)
+	default:
+		return err
+	}
+}
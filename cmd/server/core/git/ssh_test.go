@@ -0,0 +1,134 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestKnownHostsCallback(t *testing.T) {
+	key := newHostKey(t)
+	other := newHostKey(t)
+	line := func(hosts ...string) string {
+		return knownhosts.Line(hosts, key)
+	}
+
+	tests := []struct {
+		name       string
+		knownHosts string
+		host       string
+		key        ssh.PublicKey
+		want       error
+	}{
+		{name: "plain host", knownHosts: line("git.example.com"), host: "git.example.com:22", key: key},
+		{name: "host with a port", knownHosts: line("[git.example.com]:2222"), host: "git.example.com:2222", key: key},
+		{name: "other port", knownHosts: line("[git.example.com]:2222"), host: "git.example.com:22", key: key, want: ErrHostKeyUnknown},
+		{name: "hashed host", knownHosts: line(knownhosts.HashHostname("git.example.com")), host: "git.example.com:22", key: key},
+		{name: "wildcard", knownHosts: line("*.example.com"), host: "git.example.com:22", key: key},
+		{name: "single character wildcard", knownHosts: line("git?.example.com"), host: "git1.example.com:22", key: key},
+		{name: "negated pattern", knownHosts: line("*.example.com", "!evil.example.com"), host: "evil.example.com:22", key: key, want: ErrHostKeyUnknown},
+		{name: "unknown host", knownHosts: line("git.example.com"), host: "git.example.org:22", key: key, want: ErrHostKeyUnknown},
+		{name: "other key", knownHosts: line("git.example.com"), host: "git.example.com:22", key: other, want: ErrHostKeyMismatch},
+		{name: "comments and blank lines", knownHosts: "# servers\n\n" + line("git.example.com") + "\n", host: "git.example.com:22", key: key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback, err := hostKeyCallback([]byte(tt.knownHosts), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = callback(tt.host, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}, tt.key)
+			if tt.want == nil && err != nil {
+				t.Errorf("got %s, want no error", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownHostsCallbackInvalid(t *testing.T) {
+	if _, err := hostKeyCallback([]byte("git.example.com ssh-ed25519 not-base64"), ""); err == nil {
+		t.Error("invalid known_hosts accepted")
+	}
+}
+
+func TestFingerprintCallback(t *testing.T) {
+	key := newHostKey(t)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		want        error
+	}{
+		{name: "sha256", fingerprint: ssh.FingerprintSHA256(key)},
+		{name: "md5", fingerprint: "MD5:" + ssh.FingerprintLegacyMD5(key)},
+		{name: "other key", fingerprint: ssh.FingerprintSHA256(newHostKey(t)), want: ErrHostKeyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback, err := hostKeyCallback(nil, tt.fingerprint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := callback("git.example.com:22", nil, key); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserKnownHostsCallback(t *testing.T) {
+	key := newHostKey(t)
+	t.Setenv("HOME", t.TempDir())
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("SSH_KNOWN_HOSTS", filepath.Join(t.TempDir(), "missing"))
+		callback, err := hostKeyCallback(nil, "")
+		if err != nil {
+			t.Fatalf("got %s, want the error on connection", err)
+		}
+		if err := callback("git.example.com:22", nil, key); !errors.Is(err, ErrHostKeyUnknown) {
+			t.Errorf("got %v, want %s", err, ErrHostKeyUnknown)
+		}
+	})
+
+	t.Run("known host", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(path, []byte(knownhosts.Line([]string{"git.example.com"}, key)+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SSH_KNOWN_HOSTS", path)
+		callback, err := hostKeyCallback(nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := callback("git.example.com:22", &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}, key); err != nil {
+			t.Errorf("got %s, want no error", err)
+		}
+	})
+}
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
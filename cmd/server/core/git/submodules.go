@@ -0,0 +1,133 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+// Submodule is a repository referenced by the .gitmodules file of one of
+// the synced refs.
+type Submodule struct {
+	Name string
+	Path string
+	// URL is absolute, the relative urls are resolved against the source
+	URL string
+}
+
+// submodules reads the .gitmodules file at the tip of every ref, each
+// submodule url is returned once.
+func submodules(repo *git.Repository, refs []*plumbing.Reference, src string) ([]Submodule, error) {
+	found := make(map[string]Submodule)
+	for _, ref := range refs {
+		c, err := peel(repo, ref.Hash())
+		if err != nil {
+			continue
+		}
+
+		f, err := c.File(".gitmodules")
+		if err != nil {
+			if errors.Is(err, object.ErrFileNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read .gitmodules of %s: %w", ref.Name(), err)
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gitmodules of %s: %w", ref.Name(), err)
+		}
+
+		modules := config.NewModules()
+		if err := modules.Unmarshal([]byte(content)); err != nil {
+			// a broken file on one ref does not prevent the others from being read
+			continue
+		}
+		for _, m := range modules.Submodules {
+			if len(m.URL) == 0 {
+				continue
+			}
+			url := resolveSubmoduleURL(src, m.URL)
+			if _, ok := found[url]; ok {
+				continue
+			}
+			found[url] = Submodule{
+				Name: m.Name,
+				Path: m.Path,
+				URL:  url,
+			}
+		}
+	}
+
+	res := make([]Submodule, 0, len(found))
+	for _, sm := range found {
+		res = append(res, sm)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].URL < res[j].URL
+	})
+	return res, nil
+}
+
+// resolveSubmoduleURL makes a url like ../lib.git relative to the url of
+// the superproject, like git does.
+func resolveSubmoduleURL(base, url string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+
+	base = strings.TrimSuffix(base, "/")
+	sep := "/"
+
+	for {
+		switch {
+		case strings.HasPrefix(url, "./"):
+			url = url[2:]
+		case strings.HasPrefix(url, "../"):
+			url = url[3:]
+			i := strings.LastIndexAny(base, "/:")
+			if i < 0 {
+				base = ""
+				continue
+			}
+			// scp-like urls (git@host:path) separate the path with ':'
+			sep = string(base[i])
+			base = base[:i]
+		default:
+			return base + sep + url
+		}
+	}
+}
+
+// Destination expands the url template of the submodule mirrors: {host},
+// {path} and {name} are replaced with the host, the path without .git and
+// the last element of the path of the submodule url.
+func (sm Submodule) Destination(template string) (string, error) {
+	ep, err := transport.NewEndpoint(sm.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse submodule url %s: %w", sm.URL, err)
+	}
+
+	p := strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git")
+	return strings.NewReplacer(
+		"{host}", ep.Host,
+		"{path}", p,
+		"{name}", path.Base(p),
+	).Replace(template), nil
+}
+
+// Host returns the host of a repository url, empty for local repositories.
+func Host(url string) string {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return ""
+	}
+	return ep.Host
+}
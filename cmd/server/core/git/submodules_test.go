@@ -0,0 +1,95 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		url  string
+		want string
+	}{
+		{name: "absolute url", base: "https://git.example.com/user/repo", url: "https://other.example.com/lib.git", want: "https://other.example.com/lib.git"},
+		{name: "sibling", base: "https://git.example.com/user/repo", url: "../lib.git", want: "https://git.example.com/user/lib.git"},
+		{name: "trailing slash", base: "https://git.example.com/user/repo/", url: "../lib.git", want: "https://git.example.com/user/lib.git"},
+		{name: "current directory", base: "https://git.example.com/user/repo", url: "./lib.git", want: "https://git.example.com/user/repo/lib.git"},
+		{name: "other user", base: "https://git.example.com/user/repo", url: "../../other/lib.git", want: "https://git.example.com/other/lib.git"},
+		{name: "scp-like", base: "git@git.example.com:user/repo", url: "../lib.git", want: "git@git.example.com:user/lib.git"},
+		{name: "scp-like above the path", base: "git@git.example.com:repo", url: "../lib.git", want: "git@git.example.com:lib.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveSubmoduleURL(tt.base, tt.url); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmoduleDestination(t *testing.T) {
+	sm := Submodule{Name: "lib", Path: "vendor/lib", URL: "https://git.example.com/group/lib.git"}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: "https://mirror.example.com/{name}.git", want: "https://mirror.example.com/lib.git"},
+		{template: "https://mirror.example.com/{path}.git", want: "https://mirror.example.com/group/lib.git"},
+		{template: "https://mirror.example.com/{host}/{path}", want: "https://mirror.example.com/git.example.com/group/lib"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := sm.Destination(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	src, _ := newSource(t)
+	main := commit(t, src, ".gitmodules", `[submodule "lib"]
+	path = lib
+	url = ../lib.git
+`)
+	dev := commit(t, src, ".gitmodules", `[submodule "lib"]
+	path = lib
+	url = ../lib.git
+[submodule "docs"]
+	path = third_party/docs
+	url = https://docs.example.com/docs.git
+`)
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), main),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("dev"), dev),
+	}
+
+	got, err := submodules(src, refs, "https://git.example.com/user/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each url is returned once, sorted
+	want := []Submodule{
+		{Name: "docs", Path: "third_party/docs", URL: "https://docs.example.com/docs.git"},
+		{Name: "lib", Path: "lib", URL: "https://git.example.com/user/lib.git"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("submodule %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
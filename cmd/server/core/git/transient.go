@@ -0,0 +1,79 @@
+package git
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
+)
+
+// transientFailures are the messages of the network errors that go-git and
+// the ssh client flatten into strings
+var transientFailures = []string{
+	"connection refused",
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"temporary failure in name resolution",
+}
+
+// Transient tells if a failed sync may succeed when tried again: network
+// errors, timeouts and the 5xx or 429 responses of the servers. The
+// authentication failures and the refs rejected by a mirror or by the
+// settings of the repository are not.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, transport.ErrTimeoutExceeded) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// go-git does not unwrap the errors of the http responses
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var res *githttp.Err
+		if errors.As(unexpected.Err, &res) {
+			return res.Status >= http.StatusInternalServerError || res.Status == http.StatusTooManyRequests
+		}
+	}
+
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return dns.IsTimeout || dns.IsTemporary
+	}
+	// a connection that failed, unless the certificate of the server was refused
+	var cert *tls.CertificateVerificationError
+	if errors.As(err, &cert) {
+		return false
+	}
+	var op *net.OpError
+	if errors.As(err, &op) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, f := range transientFailures {
+		if strings.Contains(msg, f) {
+			return true
+		}
+	}
+	return false
+}
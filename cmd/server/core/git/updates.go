@@ -0,0 +1,34 @@
+package git
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// RefUpdate is a ref of a mirror changed by a sync, Old is zero for a
+// created ref and New for a deleted one.
+type RefUpdate struct {
+	Ref plumbing.ReferenceName
+	Old plumbing.Hash
+	New plumbing.Hash
+}
+
+// refUpdates compares the refs of a mirror before and after a sync.
+func refUpdates(before, after map[plumbing.ReferenceName]plumbing.Hash) []RefUpdate {
+	var updates []RefUpdate
+	for name, h := range after {
+		if old := before[name]; old != h {
+			updates = append(updates, RefUpdate{Ref: name, Old: old, New: h})
+		}
+	}
+	for name, h := range before {
+		if _, ok := after[name]; !ok {
+			updates = append(updates, RefUpdate{Ref: name, Old: h})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Ref < updates[j].Ref
+	})
+	return updates
+}
@@ -0,0 +1,294 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// Verification only lets the refs whose tip commit or annotated tag is
+	// signed by a trusted key through. The zero value verifies nothing.
+	Verification struct {
+		keyring openpgp.EntityList
+		signers []ssh.PublicKey
+	}
+
+	// Unverified is a ref that has not been pushed because its signature
+	// could not be verified.
+	Unverified struct {
+		Ref    plumbing.ReferenceName
+		Reason string
+	}
+
+	UnverifiedError struct {
+		Refs []Unverified
+	}
+)
+
+const (
+	pgpSignaturePrefix = "-----BEGIN PGP SIGNATURE-----"
+	sshSignaturePrefix = "-----BEGIN SSH SIGNATURE-----"
+
+	// sshNamespace is the namespace of the ssh signatures made by git
+	sshNamespace = "git"
+)
+
+var (
+	ErrUnverified error = errors.New("refs not verified")
+)
+
+// NewVerification parses the trusted keys: an armored OpenPGP keyring and
+// the content of an ssh allowed signers file (see ssh-keygen(1)).
+func NewVerification(openpgpKeys, allowedSigners string) (Verification, error) {
+	var v Verification
+	if len(strings.TrimSpace(openpgpKeys)) > 0 {
+		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(openpgpKeys))
+		if err != nil {
+			return Verification{}, fmt.Errorf("failed to read openpgp keys: %w", err)
+		}
+		v.keyring = keyring
+	}
+
+	signers, err := parseAllowedSigners(allowedSigners)
+	if err != nil {
+		return Verification{}, err
+	}
+	v.signers = signers
+
+	return v, nil
+}
+
+func (v Verification) enabled() bool {
+	return len(v.keyring) > 0 || len(v.signers) > 0
+}
+
+func (e *UnverifiedError) Error() string {
+	var refs []string
+	for _, u := range e.Refs {
+		refs = append(refs, u.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrUnverified, strings.Join(refs, ", "))
+}
+
+func (e *UnverifiedError) Unwrap() error {
+	return ErrUnverified
+}
+
+func (u Unverified) String() string {
+	return fmt.Sprintf("%s (%s)", u.Ref, u.Reason)
+}
+
+// verifyRefs splits the refs between the ones that are signed by a trusted
+// key and the ones that are not.
+func verifyRefs(repo *git.Repository, refs []*plumbing.Reference, v Verification) ([]*plumbing.Reference, []Unverified) {
+	if !v.enabled() {
+		return refs, nil
+	}
+
+	var verified []*plumbing.Reference
+	var unverified []Unverified
+	for _, ref := range refs {
+		if err := v.verify(repo, ref.Hash()); err != nil {
+			unverified = append(unverified, Unverified{Ref: ref.Name(), Reason: err.Error()})
+			continue
+		}
+		verified = append(verified, ref)
+	}
+	return verified, unverified
+}
+
+// verify checks the signature of a commit, or of an annotated tag. A tag
+// that is not signed itself is trusted when its commit is.
+func (v Verification) verify(repo *git.Repository, h plumbing.Hash) error {
+	obj, err := object.GetObject(repo.Storer, h)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", h, err)
+	}
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		return v.check(o.PGPSignature, o.EncodeWithoutSignature)
+	case *object.Tag:
+		if len(o.PGPSignature) > 0 {
+			return v.check(o.PGPSignature, o.EncodeWithoutSignature)
+		}
+		c, err := o.Commit()
+		if err != nil {
+			return fmt.Errorf("tag is not signed and does not point to a commit")
+		}
+		return v.check(c.PGPSignature, c.EncodeWithoutSignature)
+	default:
+		return fmt.Errorf("%s is a %s", h, obj.Type())
+	}
+}
+
+func (v Verification) check(signature string, encode func(plumbing.EncodedObject) error) error {
+	if len(signature) == 0 {
+		return fmt.Errorf("not signed")
+	}
+
+	payload := &plumbing.MemoryObject{}
+	if err := encode(payload); err != nil {
+		return fmt.Errorf("failed to encode signed payload: %w", err)
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		return fmt.Errorf("failed to encode signed payload: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(signature, pgpSignaturePrefix):
+		if len(v.keyring) == 0 {
+			return fmt.Errorf("openpgp signature without trusted openpgp keys")
+		}
+		if _, err := openpgp.CheckArmoredDetachedSignature(v.keyring, r, strings.NewReader(signature), nil); err != nil {
+			return fmt.Errorf("bad openpgp signature: %w", err)
+		}
+		return nil
+	case strings.HasPrefix(signature, sshSignaturePrefix):
+		if len(v.signers) == 0 {
+			return fmt.Errorf("ssh signature without allowed signers")
+		}
+		var message bytes.Buffer
+		if _, err := message.ReadFrom(r); err != nil {
+			return fmt.Errorf("failed to encode signed payload: %w", err)
+		}
+		if err := verifySSHSignature(v.signers, message.Bytes(), signature); err != nil {
+			return fmt.Errorf("bad ssh signature: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature format")
+	}
+}
+
+// parseAllowedSigners reads the keys of an allowed signers file. The
+// principals are read but not checked: a signature of any of the keys is
+// trusted, whoever the author or the committer is. The keys restricted to
+// other namespaces than git are ignored.
+func parseAllowedSigners(content string) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	s := bufio.NewScanner(strings.NewReader(content))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the principals are followed by the same fields as a line of
+		// authorized_keys
+		_, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid allowed signers line: %s", line)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signers line: %s: %w", line, err)
+		}
+
+		allowed := true
+		for _, o := range options {
+			name, value, _ := strings.Cut(o, "=")
+			switch strings.ToLower(name) {
+			case "cert-authority":
+				// certificates are not supported, the ca key must not be
+				// trusted for plain signatures
+				allowed = false
+			case "namespaces":
+				allowed = false
+				for _, ns := range strings.Split(strings.Trim(value, `"`), ",") {
+					if ns == sshNamespace {
+						allowed = true
+					}
+				}
+			}
+		}
+		if allowed {
+			keys = append(keys, key)
+		}
+	}
+	return keys, s.Err()
+}
+
+// verifySSHSignature checks an armored ssh signature (PROTOCOL.sshsig of
+// OpenSSH) of the message, made by one of the keys.
+func verifySSHSignature(keys []ssh.PublicKey, message []byte, armored string) error {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return fmt.Errorf("invalid armor")
+	}
+
+	blob, ok := bytes.CutPrefix(block.Bytes, []byte("SSHSIG"))
+	if !ok {
+		return fmt.Errorf("invalid magic")
+	}
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob, &sig); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return fmt.Errorf("unsupported version %d", sig.Version)
+	}
+	if sig.Namespace != sshNamespace {
+		return fmt.Errorf("unexpected namespace %s", sig.Namespace)
+	}
+
+	trusted := false
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), sig.PublicKey) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("key is not an allowed signer")
+	}
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported hash algorithm %s", sig.HashAlgorithm)
+	}
+	h.Write(message)
+
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+
+	var s ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &s); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return key.Verify(signed, &s)
+}
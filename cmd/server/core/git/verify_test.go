@@ -0,0 +1,316 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// signer returns the armored signature of a payload
+type signer func(t *testing.T, payload []byte) string
+
+func TestVerifyRefs(t *testing.T) {
+	trustedPGP, otherPGP := newPGPKey(t), newPGPKey(t)
+	trustedSSH, otherSSH := newSSHKey(t), newSSHKey(t)
+	v, err := NewVerification(armoredPublicKey(t, trustedPGP), allowedSigner(trustedSSH.PublicKey(), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		commit signer
+		// tag makes an annotated tag of the commit, signed when set
+		tag    signer
+		tagged bool
+		reason string
+	}{
+		{name: "openpgp commit", commit: pgpSigner(trustedPGP)},
+		{name: "openpgp commit of another key", commit: pgpSigner(otherPGP), reason: "bad openpgp signature"},
+		{name: "ssh commit", commit: sshSigner(trustedSSH, "git")},
+		{name: "ssh commit of another key", commit: sshSigner(otherSSH, "git"), reason: "key is not an allowed signer"},
+		{name: "ssh commit of another namespace", commit: sshSigner(trustedSSH, "file"), reason: "unexpected namespace file"},
+		{name: "unsigned commit", reason: "not signed"},
+		{name: "openpgp tag", tag: pgpSigner(trustedPGP), tagged: true},
+		{name: "openpgp tag of another key", commit: pgpSigner(trustedPGP), tag: pgpSigner(otherPGP), tagged: true, reason: "bad openpgp signature"},
+		{name: "ssh tag", tag: sshSigner(trustedSSH, "git"), tagged: true},
+		{name: "ssh tag of another key", commit: sshSigner(trustedSSH, "git"), tag: sshSigner(otherSSH, "git"), tagged: true, reason: "key is not an allowed signer"},
+		{name: "unsigned tag of a signed commit", commit: sshSigner(trustedSSH, "git"), tagged: true},
+		{name: "unsigned tag of an unsigned commit", tagged: true, reason: "not signed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newBare(t)
+			ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName("x"), signedCommit(t, repo, tt.commit))
+			if tt.tagged {
+				ref = plumbing.NewHashReference(plumbing.NewTagReferenceName("v1"), signedTag(t, repo, ref.Hash(), tt.tag))
+			}
+
+			verified, unverified := verifyRefs(repo, []*plumbing.Reference{ref}, v)
+			if len(tt.reason) == 0 {
+				if len(verified) != 1 || len(unverified) != 0 {
+					t.Errorf("got unverified %v, want %s verified", unverified, ref.Name())
+				}
+				return
+			}
+			if len(verified) != 0 || len(unverified) != 1 {
+				t.Fatalf("got %d verified refs, want %s unverified", len(verified), ref.Name())
+			}
+			if u := unverified[0]; u.Ref != ref.Name() || !strings.Contains(u.Reason, tt.reason) {
+				t.Errorf("got %s, want %s (%s)", u, ref.Name(), tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyKindOfKey(t *testing.T) {
+	pgpKey, sshKey := newPGPKey(t), newSSHKey(t)
+
+	tests := []struct {
+		name           string
+		openpgpKeys    string
+		allowedSigners string
+		signer         signer
+		reason         string
+	}{
+		{name: "openpgp signature without openpgp keys", allowedSigners: allowedSigner(sshKey.PublicKey(), ""), signer: pgpSigner(pgpKey), reason: "without trusted openpgp keys"},
+		{name: "ssh signature without allowed signers", openpgpKeys: armoredPublicKey(t, pgpKey), signer: sshSigner(sshKey, "git"), reason: "without allowed signers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerification(tt.openpgpKeys, tt.allowedSigners)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, _ := newBare(t)
+			err = v.verify(repo, signedCommit(t, repo, tt.signer))
+			if err == nil || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("got %v, want %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	key := newSSHKey(t).PublicKey()
+	line := func(options string) string {
+		return allowedSigner(key, options)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		keys    int
+		invalid bool
+	}{
+		{name: "principal and key", content: line(""), keys: 1},
+		{name: "several principals", content: "alice@example.com,bob@example.com " + strings.SplitN(line(""), " ", 2)[1], keys: 1},
+		{name: "comments and blank lines", content: "# signers\n\n" + line("") + "\n", keys: 1},
+		{name: "git namespace", content: line(`namespaces="git"`), keys: 1},
+		{name: "git among other namespaces", content: line(`namespaces="file,git"`), keys: 1},
+		{name: "other namespace", content: line(`namespaces="file"`)},
+		{name: "certificate authority", content: line("cert-authority")},
+		{name: "no key", content: "alice@example.com", invalid: true},
+		{name: "invalid key", content: "alice@example.com ssh-ed25519 not-base64", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseAllowedSigners(tt.content)
+			if tt.invalid {
+				if err == nil {
+					t.Error("invalid allowed signers accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != tt.keys {
+				t.Errorf("got %d keys, want %d", len(keys), tt.keys)
+			}
+		})
+	}
+}
+
+func TestVerifySSHSignatureTampered(t *testing.T) {
+	key := newSSHKey(t)
+	signature := sshSigner(key, "git")(t, []byte("payload"))
+	if err := verifySSHSignature([]ssh.PublicKey{key.PublicKey()}, []byte("other payload"), signature); err == nil {
+		t.Error("signature of another payload accepted")
+	}
+}
+
+// signedCommit stores a commit with an empty tree signed by sign, unsigned
+// when sign is nil.
+func signedCommit(t *testing.T, repo *git.Repository, sign signer) plumbing.Hash {
+	t.Helper()
+	tree := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "signed",
+		TreeHash:  treeHash,
+	}
+	if sign != nil {
+		c.PGPSignature = sign(t, payload(t, c.EncodeWithoutSignature))
+	}
+	return store(t, repo, c.Encode)
+}
+
+// signedTag stores an annotated tag of the commit signed by sign, unsigned
+// when sign is nil.
+func signedTag(t *testing.T, repo *git.Repository, target plumbing.Hash, sign signer) plumbing.Hash {
+	t.Helper()
+	tag := &object.Tag{
+		Name:   "v1",
+		Tagger: signature,
+		// the signature follows the message, which ends with a newline
+		Message:    "signed\n",
+		TargetType: plumbing.CommitObject,
+		Target:     target,
+	}
+	if sign != nil {
+		tag.PGPSignature = sign(t, payload(t, tag.EncodeWithoutSignature))
+	}
+	return store(t, repo, tag.Encode)
+}
+
+func payload(t *testing.T, encode func(plumbing.EncodedObject) error) []byte {
+	t.Helper()
+	obj := &plumbing.MemoryObject{}
+	if err := encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	r, err := obj.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func store(t *testing.T, repo *git.Repository, encode func(plumbing.EncodedObject) error) plumbing.Hash {
+	t.Helper()
+	obj := repo.Storer.NewEncodedObject()
+	if err := encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	h, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newPGPKey(t *testing.T) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func pgpSigner(e *openpgp.Entity) signer {
+	return func(t *testing.T, payload []byte) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&buf, e, bytes.NewReader(payload), nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String() + "\n"
+	}
+}
+
+func newSSHKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// allowedSigner returns the allowed signers line of the key.
+func allowedSigner(key ssh.PublicKey, options string) string {
+	line := "test@example.com "
+	if len(options) > 0 {
+		line += options + " "
+	}
+	return line + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// sshSigner signs like ssh-keygen -Y sign does (PROTOCOL.sshsig).
+func sshSigner(key ssh.Signer, namespace string) signer {
+	return func(t *testing.T, payload []byte) string {
+		t.Helper()
+		h := sha512.Sum512(payload)
+		signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+			Namespace     string
+			Reserved      string
+			HashAlgorithm string
+			Hash          []byte
+		}{namespace, "", "sha512", h[:]})...)
+		sig, err := key.Sign(rand.Reader, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+			Version       uint32
+			PublicKey     []byte
+			Namespace     string
+			Reserved      string
+			HashAlgorithm string
+			Signature     []byte
+		}{1, key.PublicKey().Marshal(), namespace, "", "sha512", ssh.Marshal(sig)})...)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}))
+	}
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"fmt"
+	"log/slog"
+	"mirror-sync/pkg/project"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	// overlapState tracks the syncs of a repository to apply its overlap policy
+	overlapState struct {
+		mu   sync.Mutex
+		cond *sync.Cond
+		// running is set while a sync is in progress, waiting while a sync
+		// is queued behind it
+		running bool
+		waiting bool
+	}
+)
+
+// overlapWrapper applies the overlap policy of the repository to its cron
+// job, like cron.SkipIfStillRunning but with the skipped runs recorded.
+func (s *Scheduler) overlapWrapper(repo project.Repository) cron.JobWrapper {
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			s.exclusive(repo, project.TriggerCron, j.Run)
+		})
+	}
+}
+
+// exclusive runs fn unless a sync of the repository is in progress, in which
+// case the overlap policy of the repository decides if it is run anyway,
+// after the one in progress or not at all.
+func (s *Scheduler) exclusive(repo project.Repository, trigger string, fn func()) {
+	if len(repo.Overlap) == 0 || repo.Overlap == project.OverlapAllow {
+		fn()
+		return
+	}
+
+	o := s.overlapState(repo.Name)
+	o.mu.Lock()
+	if o.running {
+		if repo.Overlap == project.OverlapSkip || o.waiting {
+			o.mu.Unlock()
+			s.skip(repo, trigger)
+			return
+		}
+		slog.Info(fmt.Sprintf("[%s] previous run still in progress, waiting for it", repo.Name))
+		o.waiting = true
+		for o.running {
+			o.cond.Wait()
+		}
+		o.waiting = false
+	}
+	o.running = true
+	o.mu.Unlock()
+
+	defer func() {
+		o.mu.Lock()
+		o.running = false
+		o.cond.Signal()
+		o.mu.Unlock()
+	}()
+	fn()
+}
+
+// overlapState returns the state of the syncs of a repository, it is kept when
+// the repository is updated so that a new schedule does not overlap the
+// syncs started with the previous one.
+func (s *Scheduler) overlapState(name string) *overlapState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.overlaps[name]
+	if !ok {
+		o = &overlapState{}
+		o.cond = sync.NewCond(&o.mu)
+		s.overlaps[name] = o
+	}
+	return o
+}
+
+// skip records a sync dropped by the overlap policy, the repositories that
+// are not saved have no runs.
+func (s *Scheduler) skip(repo project.Repository, trigger string) {
+	slog.Warn(fmt.Sprintf("[%s] sync skipped: previous run still in progress", repo.Name))
+	if len(repo.UUID) == 0 {
+		return
+	}
+	if err := s.data.SkipRun(repo.UUID, trigger, time.Now()); err != nil {
+		slog.Error(fmt.Sprintf("[%s] %s", repo.Name, err))
+	}
+}
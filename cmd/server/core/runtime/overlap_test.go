@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"mirror-sync/pkg/project"
+	goruntime "runtime"
+	"sync"
+	"testing"
+)
+
+func TestExclusive(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlap string
+		// ran is the number of syncs started while the first one runs
+		ran     int
+		skipped int
+	}{
+		{name: "default", ran: 2},
+		{name: "allow", overlap: project.OverlapAllow, ran: 2},
+		{name: "skip", overlap: project.OverlapSkip, skipped: 2},
+		{name: "queue one", overlap: project.OverlapQueueOne, ran: 1, skipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newTestScheduler(t)
+			repo.Overlap = tt.overlap
+
+			release := make(chan struct{})
+			started := make(chan struct{})
+			go s.exclusive(repo, project.TriggerCron, func() {
+				close(started)
+				<-release
+			})
+			<-started
+
+			// the two syncs started meanwhile run, wait or are dropped, only
+			// the one that waits does not return before the first is done
+			var mu sync.Mutex
+			ran := 0
+			run := func() {
+				s.exclusive(repo, project.TriggerManual, func() {
+					mu.Lock()
+					ran++
+					mu.Unlock()
+				})
+			}
+			var wg sync.WaitGroup
+			if tt.overlap == project.OverlapQueueOne {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					run()
+				}()
+				waitWaiting(t, s, repo.Name)
+			} else {
+				run()
+			}
+			run()
+			close(release)
+			wg.Wait()
+
+			if ran != tt.ran {
+				t.Errorf("%d syncs ran, want %d", ran, tt.ran)
+			}
+			runs, err := s.data.Runs(repo.UUID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != tt.skipped {
+				t.Fatalf("got %d runs, want %d skipped", len(runs), tt.skipped)
+			}
+			for _, run := range runs {
+				if run.Status != project.RunSkipped || run.Trigger != project.TriggerManual {
+					t.Errorf("got a %s run triggered by %s, want a skipped manual one", run.Status, run.Trigger)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipUnsaved(t *testing.T) {
+	s, repo := newTestScheduler(t)
+	saved := repo.UUID
+	repo.UUID = ""
+	s.skip(repo, project.TriggerCron)
+
+	runs, err := s.data.Runs(saved, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) > 0 {
+		t.Errorf("got runs %v for an unsaved repository", runs)
+	}
+}
+
+// newTestScheduler returns a scheduler without jobs on a new database, with
+// a saved repository.
+func newTestScheduler(t *testing.T) (*Scheduler, project.Repository) {
+	t.Helper()
+	return newSchedulerWith(t, nil, project.Repository{Source: "https://git.example.com/r"})
+}
+
+// waitWaiting waits until a sync of the repository waits for the one in
+// progress.
+func waitWaiting(t *testing.T, s *Scheduler, name string) {
+	t.Helper()
+	o := s.overlapState(name)
+	for {
+		o.mu.Lock()
+		waiting := o.waiting
+		o.mu.Unlock()
+		if waiting {
+			return
+		}
+		select {
+		case <-t.Context().Done():
+			t.Fatal("sync is not waiting")
+		default:
+			goruntime.Gosched()
+		}
+	}
+}
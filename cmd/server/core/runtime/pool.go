@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// pool runs the syncs with a global limit and a limit per host. A job
+	// only starts once every host it contacts has a free slot, the jobs
+	// that cannot start yet stay in the queue in their order of arrival.
+	pool struct {
+		mu sync.Mutex
+		// concurrency is the maximum number of running jobs
+		concurrency int
+		// hosts are the limits by host name, "*" applies to the others
+		hosts   map[string]int
+		running []*job
+		queued  []*job
+		// busy is the number of running jobs by host
+		busy map[string]int
+	}
+
+	job struct {
+		Job
+		run  func()
+		done chan struct{}
+	}
+
+	// Job is a sync attempt waiting for or holding a slot of the pool
+	Job struct {
+		Repository string
+		Trigger    string
+		Attempt    int
+		// Hosts are the remote hosts of the source and the mirrors
+		Hosts    []string
+		QueuedAt time.Time
+		// StartedAt is zero while the job is queued
+		StartedAt time.Time
+	}
+)
+
+// anyHost is the key of the limit of the hosts without their own one
+const anyHost = "*"
+
+func newPool(concurrency int, hosts map[string]int) *pool {
+	return &pool{
+		concurrency: concurrency,
+		hosts:       hosts,
+		busy:        make(map[string]int),
+	}
+}
+
+// do queues the job and runs fn once it gets a slot, it returns when fn is
+// done, or with the error of ctx if it is canceled while the job is queued.
+func (p *pool) do(ctx context.Context, j Job, fn func()) error {
+	j.QueuedAt = time.Now()
+	jb := &job{Job: j, run: fn, done: make(chan struct{})}
+
+	p.mu.Lock()
+	p.queued = append(p.queued, jb)
+	p.dispatch()
+	if i := slices.Index(p.queued, jb); i >= 0 {
+		slog.Info(fmt.Sprintf("[%s] queued, %d syncs running and %d queued before it", j.Repository, len(p.running), i))
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-jb.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	i := slices.Index(p.queued, jb)
+	if i >= 0 {
+		p.queued = slices.Delete(p.queued, i, i+1)
+	}
+	p.mu.Unlock()
+	if i >= 0 {
+		return ctx.Err()
+	}
+	// the job started meanwhile, fn is bound to the same context
+	<-jb.done
+	return nil
+}
+
+// dispatch starts the queued jobs that fit, it must be called with the lock
+// held.
+func (p *pool) dispatch() {
+	for i := 0; i < len(p.queued); {
+		if len(p.running) >= p.concurrency {
+			return
+		}
+		jb := p.queued[i]
+		if !p.fits(jb) {
+			i++
+			continue
+		}
+
+		p.queued = slices.Delete(p.queued, i, i+1)
+		jb.StartedAt = time.Now()
+		p.running = append(p.running, jb)
+		for _, h := range jb.Hosts {
+			p.busy[h]++
+		}
+		go func() {
+			defer p.finish(jb)
+			jb.run()
+		}()
+	}
+}
+
+func (p *pool) fits(jb *job) bool {
+	for _, h := range jb.Hosts {
+		limit, ok := p.hosts[h]
+		if !ok {
+			limit = p.hosts[anyHost]
+		}
+		if limit > 0 && p.busy[h] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pool) finish(jb *job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i := slices.Index(p.running, jb); i >= 0 {
+		p.running = slices.Delete(p.running, i, i+1)
+	}
+	for _, h := range jb.Hosts {
+		if p.busy[h]--; p.busy[h] <= 0 {
+			delete(p.busy, h)
+		}
+	}
+	close(jb.done)
+	p.dispatch()
+}
+
+// jobs returns the running jobs then the queued ones, in their order.
+func (p *pool) jobs() []Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	jobs := make([]Job, 0, len(p.running)+len(p.queued))
+	for _, jb := range p.running {
+		jobs = append(jobs, jb.Job)
+	}
+	for _, jb := range p.queued {
+		jobs = append(jobs, jb.Job)
+	}
+	return jobs
+}
@@ -0,0 +1,176 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	goruntime "runtime"
+	"slices"
+	"testing"
+)
+
+func TestPoolLimits(t *testing.T) {
+	type job struct {
+		name  string
+		hosts []string
+	}
+
+	tests := []struct {
+		name        string
+		concurrency int
+		hosts       map[string]int
+		jobs        []job
+		running     []string
+		queued      []string
+	}{
+		{
+			name:        "global limit",
+			concurrency: 2,
+			jobs:        []job{{name: "a"}, {name: "b"}, {name: "c"}},
+			running:     []string{"a", "b"},
+			queued:      []string{"c"},
+		},
+		{
+			name:        "host limit",
+			concurrency: 10,
+			hosts:       map[string]int{"github.com": 1},
+			jobs:        []job{{"a", []string{"github.com"}}, {"b", []string{"github.com"}}, {"c", []string{"gitlab.com"}}, {"d", []string{"gitlab.com"}}},
+			running:     []string{"a", "c", "d"},
+			queued:      []string{"b"},
+		},
+		{
+			name:        "limit of the other hosts",
+			concurrency: 10,
+			hosts:       map[string]int{"github.com": 2, anyHost: 1},
+			jobs:        []job{{"a", []string{"github.com"}}, {"b", []string{"github.com"}}, {"c", []string{"gitlab.com"}}, {"d", []string{"gitlab.com"}}, {"e", []string{"example.com"}}},
+			running:     []string{"a", "b", "c", "e"},
+			queued:      []string{"d"},
+		},
+		{
+			name:        "every host of a job",
+			concurrency: 10,
+			hosts:       map[string]int{anyHost: 1},
+			jobs:        []job{{"a", []string{"github.com"}}, {"b", []string{"gitlab.com", "github.com"}}, {"c", []string{"gitlab.com"}}},
+			running:     []string{"a", "c"},
+			queued:      []string{"b"},
+		},
+		{
+			name:        "global limit over the host limits",
+			concurrency: 1,
+			hosts:       map[string]int{anyHost: 2},
+			jobs:        []job{{"a", []string{"github.com"}}, {"b", []string{"gitlab.com"}}},
+			running:     []string{"a"},
+			queued:      []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPool(tt.concurrency, tt.hosts)
+			release := make(chan struct{})
+			done := make(chan struct{})
+			for i, j := range tt.jobs {
+				go func() {
+					_ = p.do(t.Context(), Job{Repository: j.name, Hosts: j.hosts}, func() { <-release })
+					done <- struct{}{}
+				}()
+				waitQueued(t, p, i+1)
+			}
+
+			running, queued := poolState(p)
+			if !slices.Equal(running, tt.running) || !slices.Equal(queued, tt.queued) {
+				t.Errorf("got running %v and queued %v, want %v and %v", running, queued, tt.running, tt.queued)
+			}
+
+			// the queued jobs start as the others finish
+			close(release)
+			for range tt.jobs {
+				<-done
+			}
+			if jobs := p.jobs(); len(jobs) > 0 {
+				t.Errorf("jobs left in the pool: %v", jobs)
+			}
+		})
+	}
+}
+
+func TestPoolOrder(t *testing.T) {
+	p := newPool(1, nil)
+	started := make(chan string)
+	release := make(chan struct{})
+	names := []string{"a", "b", "c", "d"}
+	for i, name := range names {
+		go func() {
+			_ = p.do(t.Context(), Job{Repository: name}, func() {
+				started <- name
+				<-release
+			})
+		}()
+		waitQueued(t, p, i+1)
+	}
+
+	var order []string
+	for range names {
+		order = append(order, <-started)
+		release <- struct{}{}
+	}
+	if !slices.Equal(order, names) {
+		t.Errorf("jobs started in order %v, want %v", order, names)
+	}
+}
+
+func TestPoolCanceledWhileQueued(t *testing.T) {
+	p := newPool(1, nil)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go p.do(t.Context(), Job{Repository: "first"}, func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ran := false
+	done := make(chan error)
+	go func() {
+		done <- p.do(ctx, Job{Repository: "second"}, func() { ran = true })
+	}()
+	waitQueued(t, p, 2)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if ran {
+		t.Error("canceled job ran")
+	}
+	if jobs := p.jobs(); len(jobs) > 1 {
+		t.Errorf("canceled job is still queued: %v", jobs)
+	}
+}
+
+// waitQueued waits until the pool holds n jobs.
+func waitQueued(t *testing.T, p *pool, n int) {
+	t.Helper()
+	for len(p.jobs()) < n {
+		select {
+		case <-t.Context().Done():
+			t.Fatal("job was not queued")
+		default:
+			goruntime.Gosched()
+		}
+	}
+}
+
+// poolState returns the names of the running and queued jobs of the pool.
+func poolState(p *pool) ([]string, []string) {
+	var running, queued []string
+	for _, j := range p.jobs() {
+		if j.StartedAt.IsZero() {
+			queued = append(queued, j.Repository)
+		} else {
+			running = append(running, j.Repository)
+		}
+	}
+	return running, queued
+}
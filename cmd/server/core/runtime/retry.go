@@ -0,0 +1,90 @@
+package runtime
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"mirror-sync/cmd/server/core/git"
+	"mirror-sync/pkg/project"
+	"time"
+)
+
+type (
+	// retryPolicy is the exponential backoff between the attempts of a sync
+	retryPolicy struct {
+		attempts int
+		delay    time.Duration
+		maxDelay time.Duration
+		jitter   float64
+	}
+)
+
+const (
+	defaultRetryDelay    = 10 * time.Second
+	defaultRetryMaxDelay = 5 * time.Minute
+)
+
+// retry returns the retry policy of the repository, a single attempt when
+// none is set.
+func retry(repo project.Repository) (retryPolicy, error) {
+	p := retryPolicy{
+		attempts: max(repo.Retry.Attempts, 1),
+		delay:    defaultRetryDelay,
+		maxDelay: defaultRetryMaxDelay,
+		jitter:   repo.Retry.Jitter,
+	}
+	if len(repo.Retry.Delay) > 0 {
+		d, err := project.ParseDuration(repo.Retry.Delay)
+		if err != nil {
+			return retryPolicy{}, fmt.Errorf("invalid retry delay: %w", err)
+		}
+		p.delay = d
+	}
+	if len(repo.Retry.MaxDelay) > 0 {
+		d, err := project.ParseDuration(repo.Retry.MaxDelay)
+		if err != nil {
+			return retryPolicy{}, fmt.Errorf("invalid retry max delay: %w", err)
+		}
+		p.maxDelay = d
+	}
+	p.maxDelay = max(p.maxDelay, p.delay)
+	return p, nil
+}
+
+// wait returns the delay before the attempt following the given one, it is
+// doubled after each attempt up to the max delay then spread by the jitter.
+func (p retryPolicy) wait(attempt int) time.Duration {
+	d := p.delay
+	for i := 1; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxDelay)
+	if p.jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.jitter * float64(d))
+	}
+	return d
+}
+
+// retryable returns the mirrors of a failed attempt to try again, the ones
+// that failed on a transient error or all of them when the source could not
+// be fetched, and the errors of the other mirrors that failed.
+func retryable(gr git.Repository, res git.Result, err error, timedOut bool) ([]string, []error) {
+	if len(res.Mirrors) == 0 {
+		if timedOut || git.Transient(err) {
+			return gr.MirrorNames(), nil
+		}
+		return nil, []error{err}
+	}
+
+	var retried []string
+	var errs []error
+	for _, m := range res.Mirrors {
+		switch {
+		case m.Err == nil:
+		case timedOut || git.Transient(m.Err):
+			retried = append(retried, m.Name)
+		default:
+			errs = append(errs, m.Err)
+		}
+	}
+	return retried, errs
+}
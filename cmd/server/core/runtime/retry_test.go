@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"mirror-sync/cmd/server/core/git"
+	"mirror-sync/pkg/project"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   project.RetrySettings
+		want    retryPolicy
+		invalid bool
+	}{
+		{name: "default", want: retryPolicy{attempts: 1, delay: defaultRetryDelay, maxDelay: defaultRetryMaxDelay}},
+		{name: "custom", retry: project.RetrySettings{Attempts: 3, Delay: "1s", MaxDelay: "1m", Jitter: 0.1}, want: retryPolicy{attempts: 3, delay: time.Second, maxDelay: time.Minute, jitter: 0.1}},
+		{name: "max delay shorter than the delay", retry: project.RetrySettings{Delay: "10m"}, want: retryPolicy{attempts: 1, delay: 10 * time.Minute, maxDelay: 10 * time.Minute}},
+		{name: "invalid delay", retry: project.RetrySettings{Delay: "soon"}, invalid: true},
+		{name: "invalid max delay", retry: project.RetrySettings{MaxDelay: "later"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := retry(project.Repository{Retry: tt.retry})
+			if invalid := err != nil; invalid != tt.invalid {
+				t.Fatalf("invalid is %t, want %t (%v)", invalid, tt.invalid, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := retryPolicy{attempts: 6, delay: 10 * time.Second, maxDelay: time.Minute}
+	for attempt, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		if got := p.wait(attempt + 1); got != want {
+			t.Errorf("wait after attempt %d is %s, want %s", attempt+1, got, want)
+		}
+	}
+
+	// the jitter spreads the capped delay both ways
+	p.jitter = 0.2
+	for range 1000 {
+		if got := p.wait(5); got < 48*time.Second || got > 72*time.Second {
+			t.Fatalf("wait with jitter is %s, want between 48s and 72s", got)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	gr := git.NewRepository("r", "https://git.example.com/r", git.NoAuthentication{}, []git.Mirror{
+		git.NewMirror("a", "https://a.example.com/r", git.NoAuthentication{}),
+		git.NewMirror("b", "https://b.example.com/r", git.NoAuthentication{}),
+		git.NewMirror("c", "https://c.example.com/r", git.NoAuthentication{}),
+	}, git.Settings{})
+	transient := fmt.Errorf("failed to push: %w", syscall.ECONNREFUSED)
+	permanent := errors.New("authentication required")
+	mirrors := git.Result{Mirrors: []git.MirrorResult{
+		{Name: "a"},
+		{Name: "b", Err: transient},
+		{Name: "c", Err: permanent},
+	}}
+
+	tests := []struct {
+		name     string
+		res      git.Result
+		err      error
+		timedOut bool
+		retried  []string
+		errs     []error
+	}{
+		{name: "transient source failure", err: transient, retried: []string{"a", "b", "c"}},
+		{name: "permanent source failure", err: permanent, errs: []error{permanent}},
+		{name: "source timeout", err: permanent, timedOut: true, retried: []string{"a", "b", "c"}},
+		{name: "mirror failures", res: mirrors, err: errors.Join(transient, permanent), retried: []string{"b"}, errs: []error{permanent}},
+		{name: "mirror timeout", res: mirrors, err: errors.Join(transient, permanent), timedOut: true, retried: []string{"b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retried, errs := retryable(gr, tt.res, tt.err, tt.timedOut)
+			if !slices.Equal(retried, tt.retried) {
+				t.Errorf("got retried mirrors %v, want %v", retried, tt.retried)
+			}
+			if !slices.Equal(errs, tt.errs) {
+				t.Errorf("got errors %v, want %v", errs, tt.errs)
+			}
+		})
+	}
+}
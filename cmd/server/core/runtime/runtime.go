@@ -1,25 +1,92 @@
 package runtime
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"mirror-sync/cmd/server/core/git"
+	"mirror-sync/cmd/server/core/storage"
 	"mirror-sync/pkg/project"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/robfig/cron/v3"
 )
 
 type (
 	Scheduler struct {
-		cr  *cron.Cron
-		ids map[string]map[string]cron.EntryID
+		cr    *cron.Cron
+		cache *git.Cache
+		data  *storage.Repository
+		ids   map[string]map[string]cron.EntryID
+		opts  Options
+		pool  *pool
+		// ctx is canceled when the daemon stops, the queued syncs are
+		// dropped and the running ones interrupted
+		ctx  context.Context
+		stop context.CancelFunc
+
+		mu sync.Mutex
+		// overlaps are the states of the syncs by repository name
+		overlaps map[string]*overlapState
+	}
+
+	// Options are the daemon-wide settings of the syncs
+	Options struct {
+		// Timeout is the default timeout of a sync, 0 means none
+		Timeout time.Duration
+		// Limits apply to every repository
+		Limits git.Limits
+		// Connection are the default connection settings of the remotes
+		Connection git.Connection
+		// Concurrency is the maximum number of syncs running at once, the
+		// others wait in a queue
+		Concurrency int
+		// HostConcurrency is the maximum number of syncs running at once by
+		// host of their remotes, "*" applies to the other hosts
+		HostConcurrency map[string]int
 	}
+
+	// PausedError lists the repositories of a manual run that were not
+	// synced because they or their project are paused.
+	PausedError struct {
+		Repositories []string
+	}
+)
+
+var (
+	ErrPaused error = errors.New("paused")
 )
 
-func New(prs []project.Project) (*Scheduler, error) {
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("%s, not synced: %s", ErrPaused, strings.Join(e.Repositories, ", "))
+}
+
+func (e *PausedError) Unwrap() error {
+	return ErrPaused
+}
+
+func New(prs []project.Project, cache *git.Cache, data *storage.Repository, opts Options) (*Scheduler, error) {
+	if opts.Concurrency <= 0 {
+		return nil, fmt.Errorf("invalid concurrency %d, it must be positive", opts.Concurrency)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
 	s := &Scheduler{
-		cr:  cron.New(),
-		ids: make(map[string]map[string]cron.EntryID),
+		cr:    cron.New(),
+		cache: cache,
+		data:  data,
+		ids:   make(map[string]map[string]cron.EntryID),
+		opts:  opts,
+		pool:  newPool(opts.Concurrency, opts.HostConcurrency),
+		ctx:   ctx,
+		stop:  stop,
+
+		overlaps: make(map[string]*overlapState),
 	}
 
 	for _, pr := range prs {
@@ -34,15 +101,18 @@ func New(prs []project.Project) (*Scheduler, error) {
 func (s *Scheduler) Add(pr project.Project) error {
 	s.ids[pr.Name] = make(map[string]cron.EntryID)
 	for _, repo := range pr.Repositories {
-		gr := s.prepare(repo)
-		id, err := s.cr.AddFunc(repo.Schedule, func() {
-			slog.Info(fmt.Sprintf("[%s] starting sync...", repo.Name))
-			if err := git.Sync(gr); err != nil {
-				slog.Error(fmt.Sprintf("[%s] failed to sync repository: %s", repo.Name, err))
-				return
-			}
-			slog.Info(fmt.Sprintf("[%s] synced", repo.Name))
-		})
+		// submodules are synced with their parent
+		if len(repo.Parent) > 0 {
+			continue
+		}
+		gr, err := s.prepare(repo)
+		if err != nil {
+			return fmt.Errorf("[%s] %w", repo.Name, err)
+		}
+		job := cron.NewChain(s.overlapWrapper(repo)).Then(cron.FuncJob(func() {
+			s.sync(s.ctx, repo, gr, project.TriggerCron)
+		}))
+		id, err := s.cr.AddJob(repo.Schedule, job)
 		if err != nil {
 			return err
 		}
@@ -64,40 +134,598 @@ func (s *Scheduler) Remove(pr project.Project) {
 	delete(s.ids, pr.Name)
 }
 
-func (s *Scheduler) RunOnce(pr project.Project) error {
+// RunOnce syncs the repositories of the project and returns once they are
+// done. The syncs are not canceled with ctx, a client that goes away must
+// not stop a push halfway, only the timeouts of the repositories and the
+// daemon stopping apply. The paused repositories are not synced, they are
+// returned in a PausedError once the others are done.
+func (s *Scheduler) RunOnce(ctx context.Context, pr project.Project) error {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	defer context.AfterFunc(s.ctx, cancel)()
+	var paused []string
 	for _, repo := range pr.Repositories {
-		gr := s.prepare(repo)
-		slog.Info(fmt.Sprintf("[%s] starting sync...", repo.Name))
-		if err := git.Sync(gr); err != nil {
+		if len(repo.Parent) > 0 {
+			continue
+		}
+		if s.paused(repo) {
+			slog.Info(fmt.Sprintf("[%s] paused, manual sync refused", repo.Name))
+			paused = append(paused, repo.Name)
+			continue
+		}
+		gr, err := s.prepare(repo)
+		if err != nil {
 			slog.Error(fmt.Sprintf("[%s] failed to sync repository: %s", repo.Name, err))
 			continue
 		}
-		slog.Info(fmt.Sprintf("[%s] synced", repo.Name))
+		s.exclusive(repo, project.TriggerManual, func() {
+			s.sync(ctx, repo, gr, project.TriggerManual)
+		})
+	}
+	if len(paused) > 0 {
+		return &PausedError{Repositories: paused}
 	}
 	return nil
 }
 
-func (s *Scheduler) prepare(repo project.Repository) git.Repository {
-	var srcAuth git.Authentication = git.NoAuthentication{}
-	var dstAuth git.Authentication = git.NoAuthentication{}
-	if v, ok := repo.Authentications["source"]; ok {
-		if len(v.Token) > 0 {
-			srcAuth = git.NewTokenAuthentication(v.Token)
-		} else if v.Basic != nil {
-			srcAuth = git.NewBasicAuthentication(v.Basic.Username, v.Basic.Password)
+// sync syncs the repository and its submodules, trigger is what started it.
+func (s *Scheduler) sync(ctx context.Context, repo project.Repository, gr git.Repository, trigger string) {
+	s.syncTree(ctx, repo, gr, trigger, make(map[string]bool))
+}
+
+// syncTree syncs the repository then its submodules, ancestors are the
+// sources of the superprojects to avoid cycles. Each repository has its own
+// timeout and retries.
+func (s *Scheduler) syncTree(ctx context.Context, repo project.Repository, gr git.Repository, trigger string, ancestors map[string]bool) {
+	if s.paused(repo) {
+		slog.Info(fmt.Sprintf("[%s] paused, sync skipped", repo.Name))
+		return
+	}
+
+	timeout, err := s.timeout(repo)
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] failed to sync repository: %s", repo.Name, err))
+		s.endRun(repo, s.startRun(repo, trigger, 1), err, nil, nil)
+		return
+	}
+	policy, err := retry(repo)
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] failed to sync repository: %s", repo.Name, err))
+		s.endRun(repo, s.startRun(repo, trigger, 1), err, nil, nil)
+		return
+	}
+
+	var res git.Result
+	// failed are the errors of the mirrors that are not tried again
+	var failed []error
+	current := gr
+	for attempt := 1; ; attempt++ {
+		var timedOut bool
+		j := Job{Repository: repo.Name, Trigger: trigger, Attempt: attempt, Hosts: hosts(repo)}
+		if perr := s.pool.do(ctx, j, func() {
+			res, timedOut, err = s.attempt(ctx, repo, current, trigger, attempt, timeout)
+		}); perr != nil {
+			err = fmt.Errorf("canceled while queued: %w", perr)
+			s.endRun(repo, s.startRun(repo, trigger, attempt), err, nil, nil)
+			break
 		}
+		if err == nil {
+			break
+		}
+
+		// only the mirrors that failed on a transient error are tried again
+		retried, errs := retryable(current, res, err, timedOut)
+		if attempt >= policy.attempts || len(retried) == 0 {
+			break
+		}
+		failed = append(failed, errs...)
+		current = gr.WithMirrors(retried)
+
+		wait := policy.wait(attempt)
+		slog.Warn(fmt.Sprintf("[%s] attempt %d/%d failed, retrying %s in %s: %s", repo.Name, attempt, policy.attempts, strings.Join(retried, ", "), wait.Round(time.Second), err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if s.paused(repo) {
+			slog.Info(fmt.Sprintf("[%s] paused, retries canceled", repo.Name))
+			return
+		}
+	}
+	err = errors.Join(append(failed, err)...)
+
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] failed to sync repository: %s", repo.Name, err))
+	} else {
+		slog.Info(fmt.Sprintf("[%s] synced", repo.Name))
+		s.archive(ctx, repo, gr)
 	}
-	if v, ok := repo.Authentications["mirror"]; ok {
-		if len(v.Token) > 0 {
-			dstAuth = git.NewTokenAuthentication(v.Token)
-		} else if v.Basic != nil {
-			dstAuth = git.NewBasicAuthentication(v.Basic.Username, v.Basic.Password)
+
+	// the submodules that are not referenced anymore are removed, only once
+	// the whole list is known
+	if err == nil && len(repo.UUID) > 0 {
+		keep := make([]string, 0, len(res.Submodules))
+		for _, sm := range res.Submodules {
+			keep = append(keep, submoduleName(repo, sm))
 		}
+		removed, err := s.data.PruneSubmodules(repo.UUID, keep)
+		if err != nil {
+			slog.Error(fmt.Sprintf("[%s] failed to remove stale submodules: %s", repo.Name, err))
+		}
+		for _, name := range removed {
+			slog.Info(fmt.Sprintf("[%s] submodule repository '%s' removed, it is not referenced anymore", repo.Name, name))
+		}
+	}
+
+	ancestors[repo.Source] = true
+	defer delete(ancestors, repo.Source)
+	for _, sm := range res.Submodules {
+		if ancestors[sm.URL] {
+			continue
+		}
+
+		child, err := submodule(repo, sm)
+		if err != nil {
+			slog.Error(fmt.Sprintf("[%s] failed to mirror submodule '%s': %s", repo.Name, sm.Name, err))
+			continue
+		}
+		child, err = s.data.SaveSubmodule(repo, child)
+		if err != nil {
+			slog.Error(fmt.Sprintf("[%s] failed to save submodule '%s': %s", repo.Name, sm.Name, err))
+			continue
+		}
+		gc, err := s.prepare(child)
+		if err != nil {
+			slog.Error(fmt.Sprintf("[%s] failed to mirror submodule '%s': %s", repo.Name, sm.Name, err))
+			continue
+		}
+		s.syncTree(ctx, child, gc, trigger, ancestors)
 	}
-	return git.NewRepository(repo.Source, repo.Destination, srcAuth, dstAuth)
+}
+
+// attempt runs a single sync of the repository within its timeout, records
+// it and saves the status of its mirrors.
+func (s *Scheduler) attempt(ctx context.Context, repo project.Repository, gr git.Repository, trigger string, attempt int, timeout time.Duration) (git.Result, bool, error) {
+	run := s.startRun(repo, trigger, attempt)
+
+	syncCtx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		syncCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	if attempt > 1 {
+		slog.Info(fmt.Sprintf("[%s] starting sync, attempt %d...", repo.Name, attempt))
+	} else {
+		slog.Info(fmt.Sprintf("[%s] starting sync...", repo.Name))
+	}
+	res, err := git.Sync(syncCtx, s.cache, gr)
+	timedOut := errors.Is(syncCtx.Err(), context.DeadlineExceeded)
+
+	now := time.Now()
+	var updates []project.RefUpdate
+	var found []project.Mismatch
+	results := res.Mirrors
+	// the source could not be fetched, every mirror of the attempt failed
+	if err != nil && len(results) == 0 {
+		for _, name := range gr.MirrorNames() {
+			results = append(results, git.MirrorResult{Name: name, Err: err})
+		}
+	}
+	if err != nil && timedOut {
+		err = fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	for _, m := range results {
+		if m.Err != nil && timedOut {
+			m.Err = fmt.Errorf("timed out after %s: %w", timeout, m.Err)
+		}
+		if m.Err != nil {
+			slog.Error(fmt.Sprintf("[%s] failed to sync mirror '%s': %s", repo.Name, m.Name, m.Err))
+		} else {
+			slog.Info(fmt.Sprintf("[%s] mirror '%s' synced", repo.Name, m.Name))
+		}
+		var mismatches []project.Mismatch
+		for _, mm := range m.Mismatches {
+			pm := project.Mismatch{Ref: mm.Ref.String(), Expected: mm.Expected.String()}
+			if !mm.Actual.IsZero() {
+				pm.Actual = mm.Actual.String()
+			}
+			mismatches = append(mismatches, pm)
+			pm.Mirror = m.Name
+			found = append(found, pm)
+		}
+		if err := s.data.SaveMirrorStatus(repo.UUID, m.Name, now, m.Err, failureReason(m.Err, timedOut), m.Checked, mismatches); err != nil {
+			slog.Error(fmt.Sprintf("[%s] %s", repo.Name, err))
+		}
+		for _, u := range m.Updates {
+			ru := project.RefUpdate{Mirror: m.Name, Ref: u.Ref.String()}
+			if !u.Old.IsZero() {
+				ru.Old = u.Old.String()
+			}
+			if !u.New.IsZero() {
+				ru.New = u.New.String()
+			}
+			updates = append(updates, ru)
+		}
+	}
+	s.endRun(repo, run, err, updates, found)
+
+	return res, timedOut, err
+}
+
+// paused tells if the repository or its project has been paused since it
+// was scheduled, the state is read at each sync so that it survives the
+// restarts of the daemon. The submodules follow their parent.
+func (s *Scheduler) paused(repo project.Repository) bool {
+	if len(repo.UUID) == 0 {
+		return false
+	}
+	paused, err := s.data.Paused(repo.UUID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] %s", repo.Name, err))
+		return false
+	}
+	return paused
+}
+
+// Queue returns the running syncs then the queued ones.
+func (s *Scheduler) Queue() []Job {
+	return s.pool.jobs()
+}
+
+// hosts returns the remote hosts contacted by a sync of the repository, the
+// local paths and bundles have none.
+func hosts(repo project.Repository) []string {
+	var hs []string
+	add := func(url string) {
+		if h := git.Host(url); len(h) > 0 && !slices.Contains(hs, h) {
+			hs = append(hs, h)
+		}
+	}
+	add(repo.Source)
+	for _, m := range repo.Mirrors {
+		if m.Bundle == nil {
+			add(m.URL)
+		}
+	}
+	return hs
+}
+
+// startRun records an attempt in progress and returns its id, 0 when it
+// could not be recorded. The submodules are not stored, their syncs are not
+// recorded either.
+func (s *Scheduler) startRun(repo project.Repository, trigger string, attempt int) int64 {
+	if len(repo.UUID) == 0 {
+		return 0
+	}
+	id, err := s.data.StartRun(repo.UUID, trigger, attempt, time.Now())
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] %s", repo.Name, err))
+		return 0
+	}
+	return id
+}
+
+// endRun records the outcome of the run, nothing is recorded when the run
+// could not be started.
+func (s *Scheduler) endRun(repo project.Repository, run int64, err error, updates []project.RefUpdate, mismatches []project.Mismatch) {
+	if run == 0 {
+		return
+	}
+	if err := s.data.EndRun(run, time.Now(), err, updates, mismatches); err != nil {
+		slog.Error(fmt.Sprintf("[%s] %s", repo.Name, err))
+	}
+}
+
+// archive writes the archives of the repository, they are not bound to the
+// timeout of the sync.
+func (s *Scheduler) archive(ctx context.Context, repo project.Repository, gr git.Repository) {
+	if repo.Archives == nil {
+		return
+	}
+
+	created, err := git.Archive(ctx, s.cache, gr, time.Now())
+	for _, path := range created {
+		slog.Info(fmt.Sprintf("[%s] archive %s written", repo.Name, path))
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] failed to archive refs: %s", repo.Name, err))
+	}
+}
+
+// timeout returns the timeout of the repository, or the one of the daemon.
+func (s *Scheduler) timeout(repo project.Repository) (time.Duration, error) {
+	if len(repo.Timeout) == 0 {
+		return s.opts.Timeout, nil
+	}
+	d, err := project.ParseDuration(repo.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %w", err)
+	}
+	return d, nil
+}
+
+func failureReason(err error, timedOut bool) string {
+	switch {
+	case err == nil:
+		return ""
+	case timedOut:
+		return project.FailureTimeout
+	case errors.Is(err, git.ErrMismatch):
+		return project.FailureMismatch
+	case errors.Is(err, git.ErrDiverged):
+		return project.FailureDiverged
+	case errors.Is(err, git.ErrConflict):
+		return project.FailureConflict
+	case errors.Is(err, git.ErrUnverified):
+		return project.FailureUnverified
+	case errors.Is(err, git.ErrLFSObjectMissing):
+		return project.FailureLFSMissing
+	case errors.Is(err, git.ErrLimitExceeded):
+		return project.FailureLimit
+	case errors.Is(err, git.ErrUnsupported):
+		return project.FailureUnsupported
+	case errors.Is(err, git.ErrShallow):
+		return project.FailureShallow
+	default:
+		return project.FailureError
+	}
+}
+
+// submoduleName names the child repository after the path of the submodule
+// in its parent, the only part that two submodules of a parent cannot share.
+func submoduleName(parent project.Repository, sm git.Submodule) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(strings.Trim(sm.Path, "/")))
+	return fmt.Sprintf("%s-%s", parent.Name, name)
+}
+
+// submodule makes the child repository of a submodule, it inherits the
+// settings of its parent and is pushed to the url template of the parent.
+func submodule(parent project.Repository, sm git.Submodule) (project.Repository, error) {
+	url, err := sm.Destination(parent.Submodules.URL)
+	if err != nil {
+		return project.Repository{}, err
+	}
+
+	child := project.Repository{
+		Name:     submoduleName(parent, sm),
+		Schedule: parent.Schedule,
+		Source:   sm.URL,
+		Mirrors: []project.Mirror{
+			{Name: "mirror", URL: url},
+		},
+		Authentications: make(map[string]project.AuthenticationSettings),
+		Connections:     make(map[string]project.ConnectionSettings),
+		Mappings:        parent.Mappings,
+		Verify:          parent.Verify,
+		Limits:          parent.Limits,
+		Mode:            parent.Mode,
+		Backup:          parent.Backup,
+		Prune:           parent.Prune,
+		Protected:       parent.Protected,
+		LFS:             parent.LFS,
+		Submodules:      parent.Submodules,
+		Timeout:         parent.Timeout,
+		Depth:           parent.Depth,
+		ShallowSince:    parent.ShallowSince,
+		Retry:           parent.Retry,
+		// the submodule sources are often third party repositories
+		Direction: project.DirectionPush,
+		Conflicts: parent.Conflicts,
+	}
+
+	// the credentials of the source are only sent to the same host
+	if auth, ok := parent.Authentications["source"]; ok && git.Host(sm.URL) == git.Host(parent.Source) {
+		child.Authentications["source"] = auth
+	}
+	if conn, ok := parent.Connections["source"]; ok && git.Host(sm.URL) == git.Host(parent.Source) {
+		child.Connections["source"] = conn
+	}
+
+	// the submodules are pushed like the first mirror
+	if len(parent.Mirrors) > 0 {
+		child.Mirrors[0].PushOptions = parent.Mirrors[0].PushOptions
+		child.Mirrors[0].Atomic = parent.Mirrors[0].Atomic
+	}
+
+	auth, ok := parent.Authentications["submodules"]
+	if !ok && len(parent.Mirrors) > 0 {
+		auth, ok = parent.Authentications[parent.Mirrors[0].Name]
+	}
+	if ok {
+		child.Authentications["mirror"] = auth
+		child.Authentications["submodules"] = auth
+	}
+
+	conn, ok := parent.Connections["submodules"]
+	if !ok && len(parent.Mirrors) > 0 {
+		conn, ok = parent.Connections[parent.Mirrors[0].Name]
+	}
+	if ok {
+		child.Connections["mirror"] = conn
+		child.Connections["submodules"] = conn
+	}
+
+	return child, nil
+}
+
+func (s *Scheduler) prepare(repo project.Repository) (git.Repository, error) {
+	srcAuth, err := authentication(repo.Authentications["source"])
+	if err != nil {
+		return git.Repository{}, fmt.Errorf("invalid source authentication: %w", err)
+	}
+	srcAuth, err = s.connection(srcAuth, repo.Connections["source"])
+	if err != nil {
+		return git.Repository{}, fmt.Errorf("invalid source connection settings: %w", err)
+	}
+
+	var mirrors []git.Mirror
+	for _, m := range repo.Mirrors {
+		if m.Bundle != nil {
+			b := git.Bundle{Dir: m.Bundle.Path, Keep: m.Bundle.Keep}
+			if len(m.Bundle.Retention) > 0 {
+				b.Retention, err = project.ParseDuration(m.Bundle.Retention)
+				if err != nil {
+					return git.Repository{}, fmt.Errorf("invalid bundle retention of mirror '%s': %w", m.Name, err)
+				}
+			}
+			mirrors = append(mirrors, git.NewBundleMirror(m.Name, b))
+			continue
+		}
+		auth, err := authentication(repo.Authentications[m.Name])
+		if err != nil {
+			return git.Repository{}, fmt.Errorf("invalid authentication of mirror '%s': %w", m.Name, err)
+		}
+		auth, err = s.connection(auth, repo.Connections[m.Name])
+		if err != nil {
+			return git.Repository{}, fmt.Errorf("invalid connection settings of mirror '%s': %w", m.Name, err)
+		}
+		mirrors = append(mirrors, git.NewMirror(m.Name, m.URL, auth).WithPushOptions(git.PushOptions{
+			Options: m.PushOptions,
+			Atomic:  m.Atomic,
+		}))
+	}
+
+	settings := git.Settings{
+		Refs: git.NewRefFilter(
+			git.Patterns(repo.Refs.Branches),
+			git.Patterns(repo.Refs.Tags),
+			git.Patterns(repo.Refs.Others),
+		),
+		Mode:       git.Mode(repo.Mode),
+		Prune:      git.Prune(repo.Prune),
+		Protected:  repo.Protected,
+		LFS:        repo.LFS,
+		Submodules: repo.Submodules.Enabled,
+		Direction:  git.Direction(repo.Direction),
+		Conflicts:  git.ConflictPolicy(repo.Conflicts),
+	}
+	for _, m := range repo.Mappings {
+		settings.Mappings = append(settings.Mappings, git.Mapping(m))
+	}
+
+	settings.Limits = s.opts.Limits.Lower(git.Limits{
+		MaxPackSize: repo.Limits.MaxPackSizeMB * 1024 * 1024,
+		MaxObjects:  repo.Limits.MaxObjects,
+		MaxRefs:     repo.Limits.MaxRefs,
+	})
+
+	settings.Verify, err = git.NewVerification(repo.Verify.OpenPGPKeys, repo.Verify.AllowedSigners)
+	if err != nil {
+		return git.Repository{}, fmt.Errorf("invalid verify settings: %w", err)
+	}
+
+	if repo.Archives != nil {
+		settings.Archives = git.Archives{
+			Dir:      repo.Archives.Path,
+			Branches: repo.Archives.Branches,
+			Tags:     repo.Archives.Tags,
+			Format:   git.ArchiveFormat(repo.Archives.Format),
+		}
+		if len(repo.Archives.Retention) > 0 {
+			settings.Archives.Retention, err = project.ParseDuration(repo.Archives.Retention)
+			if err != nil {
+				return git.Repository{}, fmt.Errorf("invalid archives retention: %w", err)
+			}
+		}
+		if len(repo.Archives.Interval) > 0 {
+			settings.Archives.Interval, err = project.ParseDuration(repo.Archives.Interval)
+			if err != nil {
+				return git.Repository{}, fmt.Errorf("invalid archives interval: %w", err)
+			}
+		}
+	}
+
+	settings.Shallow.Depth = repo.Depth
+	if len(repo.ShallowSince) > 0 {
+		// a duration is counted back from each sync
+		if settings.Shallow.Within, err = project.ParseDuration(repo.ShallowSince); err != nil {
+			settings.Shallow.Since, err = project.ParseDate(repo.ShallowSince)
+			if err != nil {
+				return git.Repository{}, fmt.Errorf("invalid shallow_since: %w", err)
+			}
+		}
+	}
+
+	if repo.Backup.Enabled {
+		settings.Backup.Enabled = true
+		if len(repo.Backup.Retention) > 0 {
+			settings.Backup.Retention, err = project.ParseDuration(repo.Backup.Retention)
+			if err != nil {
+				return git.Repository{}, fmt.Errorf("invalid backup retention: %w", err)
+			}
+		}
+	}
+
+	return git.NewRepository(repo.Name, repo.Source, srcAuth, mirrors, settings), nil
+}
+
+// Backups lists the backups stored on a mirror of the repository.
+func (s *Scheduler) Backups(ctx context.Context, repo project.Repository, mirror string) ([]git.Backup, error) {
+	gr, err := s.prepare(repo)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", repo.Name, err)
+	}
+	return git.Backups(ctx, gr, mirror)
+}
+
+// Restore puts a backed-up ref back on a mirror of the repository.
+func (s *Scheduler) Restore(ctx context.Context, repo project.Repository, mirror, ref string) error {
+	gr, err := s.prepare(repo)
+	if err != nil {
+		return fmt.Errorf("[%s] %w", repo.Name, err)
+	}
+
+	slog.Info(fmt.Sprintf("[%s] restoring '%s' on mirror '%s'...", repo.Name, ref, mirror))
+	if err := git.Restore(ctx, s.cache, gr, mirror, plumbing.ReferenceName(ref)); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("[%s] '%s' restored on mirror '%s'", repo.Name, ref, mirror))
+	return nil
+}
+
+func authentication(v project.AuthenticationSettings) (git.Authentication, error) {
+	if len(v.Token) > 0 {
+		return git.NewTokenAuthentication(v.Token), nil
+	} else if v.Basic != nil {
+		return git.NewBasicAuthentication(v.Basic.Username, v.Basic.Password), nil
+	} else if v.SSH != nil {
+		return git.NewSSHAuthentication(v.SSH.Username, []byte(v.SSH.PrivateKey), v.SSH.Passphrase, []byte(v.SSH.KnownHosts), v.SSH.HostKeyFingerprint)
+	}
+	return git.NoAuthentication{}, nil
+}
+
+// connection applies the connection settings of a remote over the defaults
+// of the daemon.
+func (s *Scheduler) connection(auth git.Authentication, v project.ConnectionSettings) (git.Authentication, error) {
+	return git.WithConnection(auth, s.opts.Connection.Override(git.Connection{
+		CABundle:           []byte(v.CABundle),
+		InsecureSkipVerify: v.InsecureSkipVerify,
+		ClientCert:         []byte(v.ClientCert),
+		ClientKey:          []byte(v.ClientKey),
+		Proxy:              v.Proxy,
+		NoProxy:            v.NoProxy,
+	}))
 }
 
 // Run the cron scheduler, or no-op if already running.
 func (s *Scheduler) Run() {
 	s.cr.Run()
 }
+
+// Stop stops scheduling the syncs and cancels the ones queued or running,
+// it returns once the scheduled ones are done.
+func (s *Scheduler) Stop() {
+	s.stop()
+	<-s.cr.Stop().Done()
+}
@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"mirror-sync/cmd/server/core/git"
+	"mirror-sync/cmd/server/core/storage"
+	"mirror-sync/pkg/project"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFailureReason(t *testing.T) {
+	// the sync errors wrap the error of each mirror
+	mirror := func(err error) error {
+		return errors.Join(fmt.Errorf("failed to push to mirror server 'm': %w", err))
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		timedOut bool
+		want     string
+	}{
+		{name: "success"},
+		{name: "timeout", err: errors.New("context deadline exceeded"), timedOut: true, want: project.FailureTimeout},
+		{name: "shallow", err: mirror(&git.ShallowError{Err: errors.New("commit is missing")}), want: project.FailureShallow},
+		{name: "mismatch", err: mirror(&git.MismatchError{}), want: project.FailureMismatch},
+		{name: "unsupported", err: mirror(&git.UnsupportedError{Feature: "atomic pushes"}), want: project.FailureUnsupported},
+		{name: "other", err: mirror(errors.New("connection refused")), want: project.FailureError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureReason(tt.err, tt.timedOut); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWithoutKnownHosts(t *testing.T) {
+	// the daemon user has no known_hosts file
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_KNOWN_HOSTS", filepath.Join(t.TempDir(), "missing"))
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := project.Project{Name: "p", Repositories: []project.Repository{{
+		Name:     "p-r",
+		Source:   "ssh://git@git.example.com/r.git",
+		Mirrors:  []project.Mirror{{Name: "mirror", URL: "https://git.example.com/r.git"}},
+		Schedule: "* * * * *",
+		Authentications: map[string]project.AuthenticationSettings{
+			"source": {SSH: &project.SSHAuthenticationSettings{PrivateKey: string(pem.EncodeToMemory(block))}},
+		},
+	}}}
+
+	// the repository only fails when it connects
+	s, err := New([]project.Project{pr}, nil, nil, Options{Concurrency: 1})
+	if err != nil {
+		t.Fatalf("got %s, want the projects loaded", err)
+	}
+	if len(s.ids["p"]) != 1 {
+		t.Errorf("got jobs %v, want the repository scheduled", s.ids["p"])
+	}
+}
+
+func TestSyncTimeout(t *testing.T) {
+	// the source never answers, the sync only ends with its timeout
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cache, err := git.NewCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, repo := newSchedulerWith(t, cache, project.Repository{
+		Source:  srv.URL + "/r.git",
+		Mirrors: []project.Mirror{{Name: "m", URL: "file://" + t.TempDir()}},
+		Timeout: "100ms",
+	})
+	pr, err := s.data.Project("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.RunOnce(t.Context(), pr) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("sync did not end with its timeout")
+	}
+
+	runs, err := s.data.Runs(repo.UUID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].EndedAt == nil || !strings.Contains(runs[0].Error, "timed out after 100ms") {
+		t.Fatalf("got runs %+v, want one run that timed out", runs)
+	}
+	repo, err = s.data.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := repo.Mirrors[0].Status; st == nil || st.Success || st.Reason != project.FailureTimeout {
+		t.Errorf("got mirror status %+v, want a %q failure", st, project.FailureTimeout)
+	}
+}
+
+// newSchedulerWith returns a scheduler without jobs using the cache, with
+// repo saved as "p-r" in the project "p" of a new database.
+func newSchedulerWith(t *testing.T, cache *git.Cache, repo project.Repository) (*Scheduler, project.Repository) {
+	t.Helper()
+	data, err := storage.OpenDB(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	repo.Name = "p-r"
+	repo.Schedule = "* * * * *"
+	if repo.Authentications == nil {
+		repo.Authentications = map[string]project.AuthenticationSettings{}
+	}
+	if err := data.Save(project.Project{Name: "p", Repositories: []project.Repository{repo}}); err != nil {
+		t.Fatal(err)
+	}
+	repo, err = data.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(nil, cache, data, Options{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, repo
+}
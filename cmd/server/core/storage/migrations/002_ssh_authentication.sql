@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE Authentication ADD COLUMN ssh_username TEXT;
+ALTER TABLE Authentication ADD COLUMN ssh_private_key TEXT;
+ALTER TABLE Authentication ADD COLUMN ssh_passphrase TEXT;
+ALTER TABLE Authentication ADD COLUMN ssh_known_hosts TEXT;
+ALTER TABLE Authentication ADD COLUMN ssh_host_key_fingerprint TEXT;
+
+-- +goose Down
+ALTER TABLE Authentication DROP COLUMN ssh_username;
+ALTER TABLE Authentication DROP COLUMN ssh_private_key;
+ALTER TABLE Authentication DROP COLUMN ssh_passphrase;
+ALTER TABLE Authentication DROP COLUMN ssh_known_hosts;
+ALTER TABLE Authentication DROP COLUMN ssh_host_key_fingerprint;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN ref_filters TEXT;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN ref_filters;
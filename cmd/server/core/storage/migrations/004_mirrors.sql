@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE Mirrors (
+	repository TEXT NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	last_sync DATETIME,
+	last_success INTEGER,
+	last_error TEXT
+);
+CREATE INDEX Mirrors_repository_IDX ON Mirrors (repository);
+
+INSERT INTO Mirrors (repository, name, url) SELECT uuid, 'mirror', destination FROM Repositories;
+ALTER TABLE Repositories DROP COLUMN destination;
+
+-- +goose Down
+ALTER TABLE Repositories ADD COLUMN destination TEXT NOT NULL DEFAULT '';
+UPDATE Repositories SET destination = (SELECT url FROM Mirrors WHERE Mirrors.repository = Repositories.uuid LIMIT 1);
+DROP TABLE Mirrors;
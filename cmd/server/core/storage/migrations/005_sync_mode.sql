@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN mode TEXT NOT NULL DEFAULT 'force';
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN mode;
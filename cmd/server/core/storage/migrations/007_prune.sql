@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN prune TEXT NOT NULL DEFAULT 'never';
+ALTER TABLE Repositories ADD COLUMN protected TEXT;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN protected;
+ALTER TABLE Repositories DROP COLUMN prune;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN lfs INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN lfs;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN submodules TEXT;
+ALTER TABLE Repositories ADD COLUMN parent TEXT;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN parent;
+ALTER TABLE Repositories DROP COLUMN submodules;
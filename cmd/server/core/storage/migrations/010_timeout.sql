@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN timeout TEXT NOT NULL DEFAULT '';
+ALTER TABLE Mirrors ADD COLUMN failure_reason TEXT;
+
+-- +goose Down
+ALTER TABLE Mirrors DROP COLUMN failure_reason;
+ALTER TABLE Repositories DROP COLUMN timeout;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN direction TEXT NOT NULL DEFAULT 'push';
+ALTER TABLE Repositories ADD COLUMN conflicts TEXT NOT NULL DEFAULT 'halt-and-report';
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN conflicts;
+ALTER TABLE Repositories DROP COLUMN direction;
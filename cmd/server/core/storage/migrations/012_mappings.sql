@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN mappings TEXT;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN mappings;
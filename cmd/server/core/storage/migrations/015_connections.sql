@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN connections TEXT;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN connections;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Mirrors ADD COLUMN bundle TEXT;
+
+-- +goose Down
+ALTER TABLE Mirrors DROP COLUMN bundle;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Mirrors ADD COLUMN mismatches TEXT;
+ALTER TABLE Mirrors ADD COLUMN checked INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE Mirrors DROP COLUMN checked;
+ALTER TABLE Mirrors DROP COLUMN mismatches;
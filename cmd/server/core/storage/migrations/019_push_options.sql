@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Mirrors ADD COLUMN push_options TEXT;
+ALTER TABLE Mirrors ADD COLUMN atomic INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE Mirrors DROP COLUMN atomic;
+ALTER TABLE Mirrors DROP COLUMN push_options;
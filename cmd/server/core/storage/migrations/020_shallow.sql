@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Repositories ADD COLUMN shallow_since TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN shallow_since;
+ALTER TABLE Repositories DROP COLUMN depth;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE Runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repository TEXT NOT NULL,
+	"trigger" TEXT NOT NULL,
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME,
+	status TEXT NOT NULL,
+	error TEXT,
+	ref_updates TEXT,
+	mismatches TEXT
+);
+CREATE INDEX Runs_repository_IDX ON Runs (repository, started_at);
+
+-- +goose Down
+DROP TABLE Runs;
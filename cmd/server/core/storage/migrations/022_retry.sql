@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN retry TEXT;
+ALTER TABLE Runs ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE Runs DROP COLUMN attempt;
+ALTER TABLE Repositories DROP COLUMN retry;
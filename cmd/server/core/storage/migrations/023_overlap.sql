@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE Repositories ADD COLUMN overlap TEXT NOT NULL DEFAULT 'allow';
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN overlap;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE Projects ADD COLUMN paused INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Repositories ADD COLUMN paused INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE Repositories DROP COLUMN paused;
+ALTER TABLE Projects DROP COLUMN paused;
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mirror-sync/pkg/project"
+	"time"
+)
+
+// saveMirrors creates or updates the mirrors of the repository and removes
+// the ones that are not configured anymore. The status of the existing
+// mirrors is kept.
+func (r Repository) saveMirrors(tx *sql.Tx, repoUUID string, mirrors []project.Mirror) error {
+	names := make(map[string]bool)
+	for _, m := range mirrors {
+		names[m.Name] = true
+
+		var bundle *string
+		if m.Bundle != nil {
+			b, err := json.Marshal(m.Bundle)
+			if err != nil {
+				return fmt.Errorf("failed to marshal bundle settings: %s", err)
+			}
+			s := string(b)
+			bundle = &s
+		}
+
+		options, err := json.Marshal(m.PushOptions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal push options: %s", err)
+		}
+
+		res, err := tx.Exec("UPDATE Mirrors SET url = ?, bundle = ?, push_options = ?, atomic = ? WHERE repository = ? AND name = ?", m.URL, bundle, string(options), m.Atomic, repoUUID, m.Name)
+		if err != nil {
+			return fmt.Errorf("failed to execute sql query: %s", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to execute sql query: %s", err)
+		}
+		if n > 0 {
+			continue
+		}
+
+		if _, err := tx.Exec("INSERT INTO Mirrors (repository, name, url, bundle, push_options, atomic) VALUES (?, ?, ?, ?, ?, ?)", repoUUID, m.Name, m.URL, bundle, string(options), m.Atomic); err != nil {
+			return fmt.Errorf("failed to execute sql query: %s", err)
+		}
+	}
+
+	rows, err := tx.Query("SELECT name FROM Mirrors WHERE repository = ?", repoUUID)
+	if err != nil {
+		return fmt.Errorf("failed to query mirrors of the repository %s: %s", repoUUID, err)
+	}
+
+	var orphans []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan mirror entry: %s", err)
+		}
+		if !names[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	rows.Close()
+
+	for _, name := range orphans {
+		if _, err := tx.Exec("DELETE FROM Mirrors WHERE repository = ? AND name = ?", repoUUID, name); err != nil {
+			return fmt.Errorf("failed to delete the mirror entry from the database: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) listMirrors(repositoryUUID string) ([]project.Mirror, error) {
+	rows, err := r.db.Query("SELECT name, url, bundle, push_options, atomic, last_sync, last_success, last_error, failure_reason, mismatches, checked FROM Mirrors WHERE repository = ? ORDER BY name", repositoryUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mirrors of the repository %s: %w", repositoryUUID, err)
+	}
+	defer rows.Close()
+
+	var res []project.Mirror
+	for rows.Next() {
+		var m project.Mirror
+		var lastSync sql.NullTime
+		var lastSuccess, checked sql.NullBool
+		var bundle, options, lastError, reason, mismatches sql.NullString
+		var atomic sql.NullBool
+		if err := rows.Scan(&m.Name, &m.URL, &bundle, &options, &atomic, &lastSync, &lastSuccess, &lastError, &reason, &mismatches, &checked); err != nil {
+			return nil, fmt.Errorf("failed to scan mirror entry: %w", err)
+		}
+		if options.Valid && len(options.String) > 0 {
+			if err := json.Unmarshal([]byte(options.String), &m.PushOptions); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal push options: %w", err)
+			}
+		}
+		m.Atomic = atomic.Bool
+		if bundle.Valid && len(bundle.String) > 0 {
+			if err := json.Unmarshal([]byte(bundle.String), &m.Bundle); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal bundle settings: %w", err)
+			}
+		}
+		if lastSync.Valid {
+			m.Status = &project.MirrorStatus{
+				LastSync: lastSync.Time,
+				Success:  lastSuccess.Bool,
+				Error:    lastError.String,
+				Reason:   reason.String,
+				Checked:  checked.Bool,
+			}
+			if mismatches.Valid && len(mismatches.String) > 0 {
+				if err := json.Unmarshal([]byte(mismatches.String), &m.Status.Mismatches); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal mismatches: %w", err)
+				}
+			}
+		}
+		res = append(res, m)
+	}
+
+	return res, nil
+}
+
+// SaveMirrorStatus records the result of the last push to a mirror, reason
+// is the kind of failure, checked tells if the mirror was checked after the
+// push and mismatches are the refs that failed the check
+func (r *Repository) SaveMirrorStatus(repositoryUUID, name string, at time.Time, syncErr error, reason string, checked bool, mismatches []project.Mismatch) error {
+	var msg, kind, found *string
+	if syncErr != nil {
+		s := syncErr.Error()
+		msg = &s
+		kind = &reason
+	}
+	if len(mismatches) > 0 {
+		b, err := json.Marshal(mismatches)
+		if err != nil {
+			return fmt.Errorf("failed to marshal mismatches: %w", err)
+		}
+		s := string(b)
+		found = &s
+	}
+
+	_, err := r.db.Exec("UPDATE Mirrors SET last_sync = ?, last_success = ?, last_error = ?, failure_reason = ?, mismatches = ?, checked = ? WHERE repository = ? AND name = ?", at.UTC(), syncErr == nil, msg, kind, found, checked, repositoryUUID, name)
+	if err != nil {
+		return fmt.Errorf("failed to save the status of the mirror %s: %w", name, err)
+	}
+
+	return nil
+}
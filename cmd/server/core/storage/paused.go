@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SetProjectPaused pauses or resumes the syncs of every repository of the
+// project, or returns ErrNotFound.
+func (r *Repository) SetProjectPaused(name string, paused bool) error {
+	res, err := r.db.Exec("UPDATE Projects SET paused = ? WHERE name = ?", paused, name)
+	if err != nil {
+		return fmt.Errorf("failed to update the project %s: %w", name, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("project %s: %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+// SetRepositoryPaused pauses or resumes the syncs of the repository, or
+// returns ErrNotFound.
+func (r *Repository) SetRepositoryPaused(name string, paused bool) error {
+	res, err := r.db.Exec("UPDATE Repositories SET paused = ? WHERE name = ?", paused, name)
+	if err != nil {
+		return fmt.Errorf("failed to update the repository %s: %w", name, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("repository %s: %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+// Paused tells if the repository or its project is paused.
+func (r *Repository) Paused(repositoryUUID string) (bool, error) {
+	row := r.db.QueryRow("SELECT r.paused OR p.paused FROM Repositories r JOIN Projects p ON p.uuid = r.project WHERE r.uuid = ?", repositoryUUID)
+
+	var paused bool
+	if err := row.Scan(&paused); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("repository %s: %w", repositoryUUID, ErrNotFound)
+		}
+		return false, fmt.Errorf("failed to read the paused state of %s: %w", repositoryUUID, err)
+	}
+	return paused, nil
+}
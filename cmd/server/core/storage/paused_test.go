@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPaused(t *testing.T) {
+	tests := []struct {
+		name       string
+		project    bool
+		repository bool
+	}{
+		{name: "running"},
+		{name: "repository paused", repository: true},
+		{name: "project paused", project: true},
+		{name: "both paused", project: true, repository: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestDB(t)
+			if err := r.Save(testProject("a")); err != nil {
+				t.Fatal(err)
+			}
+			repo, err := r.RepositoryByName("p-r")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.SetProjectPaused("p", tt.project); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SetRepositoryPaused("p-r", tt.repository); err != nil {
+				t.Fatal(err)
+			}
+			assertPaused(t, r, repo.UUID, tt.project || tt.repository)
+
+			// resuming both runs the syncs again
+			if err := r.SetProjectPaused("p", false); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SetRepositoryPaused("p-r", false); err != nil {
+				t.Fatal(err)
+			}
+			assertPaused(t, r, repo.UUID, false)
+		})
+	}
+}
+
+func TestPausedNotFound(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.SetProjectPaused("p", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v pausing a missing project, want %v", err, ErrNotFound)
+	}
+	if err := r.SetRepositoryPaused("p-r", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v pausing a missing repository, want %v", err, ErrNotFound)
+	}
+	if _, err := r.Paused("00000000-0000-0000-0000-000000000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing repository, want %v", err, ErrNotFound)
+	}
+}
+
+func assertPaused(t *testing.T, r *Repository, uuid string, want bool) {
+	t.Helper()
+	paused, err := r.Paused(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paused != want {
+		t.Errorf("paused is %t, want %t", paused, want)
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mirror-sync/pkg/project"
+	"time"
+)
+
+// StartRun records an attempt of a sync of the repository in progress and
+// returns its id.
+func (r *Repository) StartRun(repositoryUUID, trigger string, attempt int, at time.Time) (int64, error) {
+	res, err := r.db.Exec("INSERT INTO Runs (repository, \"trigger\", attempt, started_at, status) VALUES (?, ?, ?, ?, ?)", repositoryUUID, trigger, attempt, at.UTC(), project.RunRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save the run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to save the run: %w", err)
+	}
+	return id, nil
+}
+
+// EndRun records the outcome of a run, the run failed when syncErr is set.
+// The mismatches are the ones of every mirror.
+func (r *Repository) EndRun(id int64, at time.Time, syncErr error, updates []project.RefUpdate, mismatches []project.Mismatch) error {
+	status := project.RunSuccess
+	var msg *string
+	if syncErr != nil {
+		status = project.RunFailed
+		s := syncErr.Error()
+		msg = &s
+	}
+
+	var refUpdates *string
+	if len(updates) > 0 {
+		b, err := json.Marshal(updates)
+		if err != nil {
+			return fmt.Errorf("failed to marshal ref updates: %w", err)
+		}
+		s := string(b)
+		refUpdates = &s
+	}
+
+	var found *string
+	if len(mismatches) > 0 {
+		b, err := json.Marshal(mismatches)
+		if err != nil {
+			return fmt.Errorf("failed to marshal mismatches: %w", err)
+		}
+		s := string(b)
+		found = &s
+	}
+
+	if _, err := r.db.Exec("UPDATE Runs SET ended_at = ?, status = ?, error = ?, ref_updates = ?, mismatches = ? WHERE id = ?", at.UTC(), status, msg, refUpdates, found, id); err != nil {
+		return fmt.Errorf("failed to save the run %d: %w", id, err)
+	}
+	return nil
+}
+
+// SkipRun records a sync dropped by the overlap policy of the repository.
+func (r *Repository) SkipRun(repositoryUUID, trigger string, at time.Time) error {
+	if _, err := r.db.Exec("INSERT INTO Runs (repository, \"trigger\", started_at, ended_at, status, error) VALUES (?, ?, ?, ?, ?, ?)", repositoryUUID, trigger, at.UTC(), at.UTC(), project.RunSkipped, "skipped: previous run still in progress"); err != nil {
+		return fmt.Errorf("failed to save the skipped run: %w", err)
+	}
+	return nil
+}
+
+// InterruptRuns fails the runs left in progress by a daemon that stopped
+// during a sync.
+func (r *Repository) InterruptRuns(at time.Time) error {
+	if _, err := r.db.Exec("UPDATE Runs SET ended_at = ?, status = ?, error = ? WHERE status = ?", at.UTC(), project.RunFailed, "interrupted: the daemon stopped during the sync", project.RunRunning); err != nil {
+		return fmt.Errorf("failed to update the runs in progress: %w", err)
+	}
+	return nil
+}
+
+// Runs returns the latest runs of the repository, newest first, limit <= 0
+// returns all of them
+func (r *Repository) Runs(repositoryUUID string, limit int) ([]project.Run, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.Query("SELECT id, repository, \"trigger\", attempt, started_at, ended_at, status, error, ref_updates, mismatches FROM Runs WHERE repository = ? ORDER BY started_at DESC, id DESC LIMIT ?", repositoryUUID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs of the repository %s: %w", repositoryUUID, err)
+	}
+	defer rows.Close()
+
+	runs := []project.Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Run returns a run by id, or ErrNotFound
+func (r *Repository) Run(id int64) (project.Run, error) {
+	row := r.db.QueryRow("SELECT id, repository, \"trigger\", attempt, started_at, ended_at, status, error, ref_updates, mismatches FROM Runs WHERE id = ?", id)
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return project.Run{}, fmt.Errorf("run %d: %w", id, ErrNotFound)
+	}
+	return run, err
+}
+
+func scanRun(row interface{ Scan(...any) error }) (project.Run, error) {
+	var run project.Run
+	var endedAt sql.NullTime
+	var msg, refUpdates, mismatches sql.NullString
+	if err := row.Scan(&run.ID, &run.Repository, &run.Trigger, &run.Attempt, &run.StartedAt, &endedAt, &run.Status, &msg, &refUpdates, &mismatches); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return project.Run{}, err
+		}
+		return project.Run{}, fmt.Errorf("failed to scan run entry: %w", err)
+	}
+	if endedAt.Valid {
+		run.EndedAt = &endedAt.Time
+	}
+	run.Error = msg.String
+	if refUpdates.Valid && len(refUpdates.String) > 0 {
+		if err := json.Unmarshal([]byte(refUpdates.String), &run.RefUpdates); err != nil {
+			return project.Run{}, fmt.Errorf("failed to unmarshal ref updates: %w", err)
+		}
+	}
+	if mismatches.Valid && len(mismatches.String) > 0 {
+		if err := json.Unmarshal([]byte(mismatches.String), &run.Mismatches); err != nil {
+			return project.Run{}, fmt.Errorf("failed to unmarshal mismatches: %w", err)
+		}
+	}
+	return run, nil
+}
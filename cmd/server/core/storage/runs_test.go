@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"mirror-sync/pkg/project"
+)
+
+func TestRuns(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.Save(testProject("a")); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := r.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	updates := []project.RefUpdate{{Mirror: "a", Ref: "refs/heads/main", Old: "1111", New: "2222"}}
+	mismatches := []project.Mismatch{{Mirror: "a", Ref: "refs/tags/v1", Expected: "3333"}}
+	success, err := r.StartRun(repo.UUID, project.TriggerCron, 1, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EndRun(success, start.Add(time.Minute), nil, updates, nil); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := r.StartRun(repo.UUID, project.TriggerManual, 2, start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EndRun(failed, start.Add(3*time.Minute), errors.New("mismatch"), nil, mismatches); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SkipRun(repo.UUID, project.TriggerCron, start.Add(4*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	ended := func(d time.Duration) *time.Time {
+		at := start.Add(d)
+		return &at
+	}
+	want := []project.Run{
+		{Repository: repo.UUID, Trigger: project.TriggerCron, Attempt: 1, StartedAt: start.Add(4 * time.Minute), EndedAt: ended(4 * time.Minute), Status: project.RunSkipped, Error: "skipped: previous run still in progress"},
+		{ID: failed, Repository: repo.UUID, Trigger: project.TriggerManual, Attempt: 2, StartedAt: start.Add(2 * time.Minute), EndedAt: ended(3 * time.Minute), Status: project.RunFailed, Error: "mismatch", Mismatches: mismatches},
+		{ID: success, Repository: repo.UUID, Trigger: project.TriggerCron, Attempt: 1, StartedAt: start, EndedAt: ended(time.Minute), Status: project.RunSuccess, RefUpdates: updates},
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []project.Run
+	}{
+		{name: "all", want: want},
+		{name: "negative limit", limit: -1, want: want},
+		{name: "limit", limit: 2, want: want[:2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := r.Runs(repo.UUID, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRuns(t, runs, tt.want)
+		})
+	}
+
+	run, err := r.Run(failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRuns(t, []project.Run{run}, want[1:2])
+	if _, err := r.Run(failed + 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing run, want %v", err, ErrNotFound)
+	}
+}
+
+func TestInterruptRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	r, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(testProject("a")); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := r.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	done, err := r.StartRun(repo.UUID, project.TriggerCron, 1, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EndRun(done, start.Add(time.Minute), nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	running, err := r.StartRun(repo.UUID, project.TriggerCron, 1, start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the daemon stops during the second run
+	if err := r.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err = OpenDB(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.db.Close() })
+	restart := start.Add(time.Hour)
+	if err := r.InterruptRuns(restart); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id     int64
+		status string
+		ended  time.Time
+		error  string
+	}{
+		{id: done, status: project.RunSuccess, ended: start.Add(time.Minute)},
+		{id: running, status: project.RunFailed, ended: restart, error: "interrupted: the daemon stopped during the sync"},
+	}
+	for _, tt := range tests {
+		run, err := r.Run(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != tt.status || run.Error != tt.error || run.EndedAt == nil || !run.EndedAt.Equal(tt.ended) {
+			t.Errorf("run %d is %s (%q) ended at %v, want %s (%q) ended at %s", tt.id, run.Status, run.Error, run.EndedAt, tt.status, tt.error, tt.ended)
+		}
+	}
+}
+
+// assertRuns compares the runs, the ids of the expected ones are only
+// checked when set.
+func assertRuns(t *testing.T, got, want []project.Run) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d runs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if w.ID == 0 {
+			w.ID = g.ID
+		}
+		if g.ID != w.ID || g.Repository != w.Repository || g.Trigger != w.Trigger || g.Attempt != w.Attempt || g.Status != w.Status || g.Error != w.Error {
+			t.Errorf("run %d is %+v, want %+v", i, g, w)
+		}
+		if !g.StartedAt.Equal(w.StartedAt) || (g.EndedAt == nil) != (w.EndedAt == nil) || (g.EndedAt != nil && !g.EndedAt.Equal(*w.EndedAt)) {
+			t.Errorf("run %d is from %s to %v, want from %s to %v", i, g.StartedAt, g.EndedAt, w.StartedAt, w.EndedAt)
+		}
+		if !slices.Equal(g.RefUpdates, w.RefUpdates) || !slices.Equal(g.Mismatches, w.Mismatches) {
+			t.Errorf("run %d has updates %v and mismatches %v, want %v and %v", i, g.RefUpdates, g.Mismatches, w.RefUpdates, w.Mismatches)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mirror-sync/pkg/project"
+	"slices"
 
 	"github.com/google/uuid"
 	_ "github.com/ncruces/go-sqlite3/driver"
@@ -17,6 +19,12 @@ type (
 	}
 )
 
+var (
+	ErrNotFound error = errors.New("not found")
+	// ErrNameTaken is a submodule named like another repository
+	ErrNameTaken error = errors.New("name already used by another repository")
+)
+
 func OpenDB(path string) (*Repository, error) {
 	// connect
 	db, err := sql.Open("sqlite3", "file:"+path)
@@ -93,7 +101,7 @@ func (r *Repository) RepositoryExistsByName(name string) (bool, error) {
 	return true, nil
 }
 
-func (r *Repository) Create(pr project.Project) error {
+func (r *Repository) Create(pr project.Project) (err error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to create transaction: %s", err)
@@ -103,7 +111,9 @@ func (r *Repository) Create(pr project.Project) error {
 			tx.Rollback()
 			return
 		}
-		tx.Commit()
+		if cerr := tx.Commit(); cerr != nil {
+			err = fmt.Errorf("failed to commit transaction: %s", cerr)
+		}
 	}()
 
 	// Create Project entry
@@ -120,6 +130,9 @@ func (r *Repository) Create(pr project.Project) error {
 	// Create repositories entries
 
 	for _, repo := range pr.Repositories {
+		if err := r.checkNotSubmodule(repo.Name); err != nil {
+			return err
+		}
 		if err := r.createRepository(tx, projectUUID, repo); err != nil {
 			return err
 		}
@@ -128,19 +141,76 @@ func (r *Repository) Create(pr project.Project) error {
 	return nil
 }
 
+// jsonSettings are the settings of a repository stored as JSON columns
+type jsonSettings struct {
+	refFilters, mappings, verify, limits, connections, archives, backup, protected, submodules, retry string
+}
+
+// marshalSettings encodes the settings of the repository for the create and
+// update statements
+func marshalSettings(repo project.Repository) (jsonSettings, error) {
+	var s jsonSettings
+	for _, c := range []struct {
+		dst   *string
+		value any
+		name  string
+	}{
+		{&s.refFilters, repo.Refs, "ref filters"},
+		{&s.mappings, repo.Mappings, "ref mappings"},
+		{&s.verify, repo.Verify, "verify settings"},
+		{&s.limits, repo.Limits, "limits"},
+		{&s.connections, repo.Connections, "connection settings"},
+		{&s.archives, repo.Archives, "archive settings"},
+		{&s.backup, repo.Backup, "backup settings"},
+		{&s.protected, repo.Protected, "protected refs"},
+		{&s.submodules, repo.Submodules, "submodule settings"},
+		{&s.retry, repo.Retry, "retry settings"},
+	} {
+		b, err := json.Marshal(c.value)
+		if err != nil {
+			return jsonSettings{}, fmt.Errorf("failed to marshal %s: %w", c.name, err)
+		}
+		*c.dst = string(b)
+	}
+	return s, nil
+}
+
 func (r Repository) createRepository(tx *sql.Tx, projectUuid string, repo project.Repository) error {
 	repoUUID := uuid.NewString()
 
-	stmt, err := tx.Prepare("INSERT INTO Repositories (uuid, name, source, destination, schedule, project) VALUES (?, ?, ?, ?, ?, ?)")
+	settings, err := marshalSettings(repo)
+	if err != nil {
+		return err
+	}
+
+	var parent sql.NullString
+	if len(repo.Parent) > 0 {
+		parent = sql.NullString{String: repo.Parent, Valid: true}
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO Repositories (uuid, name, source, schedule, project, ref_filters, mode, backup, prune, protected, lfs, submodules, parent, timeout, direction, conflicts, mappings, verify, limits, connections, archives, depth, shallow_since, retry, overlap) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return fmt.Errorf("failed to create statement: %s", err)
 	}
 
-	if _, err := stmt.Exec(repoUUID, repo.Name, repo.Source, repo.Destination, repo.Schedule, projectUuid); err != nil {
+	if _, err := stmt.Exec(repoUUID, repo.Name, repo.Source, repo.Schedule, projectUuid, settings.refFilters, repo.Mode, settings.backup, repo.Prune, settings.protected, repo.LFS, settings.submodules, parent, repo.Timeout, repo.Direction, repo.Conflicts, settings.mappings, settings.verify, settings.limits, settings.connections, settings.archives, repo.Depth, repo.ShallowSince, settings.retry, repo.Overlap); err != nil {
 		return fmt.Errorf("failed to execute sql query: %s", err)
 	}
 
-	for ref, auth := range repo.Authentications {
+	if err := r.saveMirrors(tx, repoUUID, repo.Mirrors); err != nil {
+		return err
+	}
+
+	return r.saveAuthentications(tx, repoUUID, repo.Authentications)
+}
+
+// saveAuthentications replaces the authentication entries of the repository
+func (r Repository) saveAuthentications(tx *sql.Tx, repoUUID string, auths map[string]project.AuthenticationSettings) error {
+	if _, err := tx.Exec("DELETE FROM Authentication WHERE repository = ?", repoUUID); err != nil {
+		return fmt.Errorf("failed to delete the authentication entries from the database: %s", err)
+	}
+
+	for ref, auth := range auths {
 		if len(auth.Token) > 0 {
 			stmt, err := tx.Prepare("INSERT INTO Authentication (repository, ref, token) VALUES (?, ?, ?)")
 			if err != nil {
@@ -159,6 +229,15 @@ func (r Repository) createRepository(tx *sql.Tx, projectUuid string, repo projec
 			if _, err := stmt.Exec(repoUUID, ref, auth.Basic.Username, auth.Basic.Password); err != nil {
 				return fmt.Errorf("failed to execute sql query: %s", err)
 			}
+		} else if auth.SSH != nil {
+			stmt, err := tx.Prepare("INSERT INTO Authentication (repository, ref, ssh_username, ssh_private_key, ssh_passphrase, ssh_known_hosts, ssh_host_key_fingerprint) VALUES (?, ?, ?, ?, ?, ?, ?)")
+			if err != nil {
+				return fmt.Errorf("failed to create statement: %s", err)
+			}
+
+			if _, err := stmt.Exec(repoUUID, ref, auth.SSH.Username, auth.SSH.PrivateKey, auth.SSH.Passphrase, auth.SSH.KnownHosts, auth.SSH.HostKeyFingerprint); err != nil {
+				return fmt.Errorf("failed to execute sql query: %s", err)
+			}
 		}
 	}
 
@@ -199,7 +278,7 @@ func (r *Repository) RepositoryUUID(name string) (string, error) {
 	return uuid, nil
 }
 
-func (r *Repository) Update(pr project.Project) error {
+func (r *Repository) Update(pr project.Project) (err error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to create transaction: %s", err)
@@ -209,7 +288,9 @@ func (r *Repository) Update(pr project.Project) error {
 			tx.Rollback()
 			return
 		}
-		tx.Commit()
+		if cerr := tx.Commit(); cerr != nil {
+			err = fmt.Errorf("failed to commit transaction: %s", cerr)
+		}
 	}()
 
 	projectUUID, err := r.ProjectUUID(pr.Name)
@@ -226,6 +307,11 @@ func (r *Repository) Update(pr project.Project) error {
 		}
 
 		if exists {
+			// the submodule rows belong to their parent, a repository of the
+			// user would be taken for one and never scheduled
+			if err := r.checkNotSubmodule(repo.Name); err != nil {
+				return err
+			}
 			// if it exists, just update it
 			if err := r.updateRepository(tx, repo); err != nil {
 				return err
@@ -247,39 +333,168 @@ func (r *Repository) updateRepository(tx *sql.Tx, repo project.Repository) error
 		return fmt.Errorf("failed to get uuid from database: %w", err)
 	}
 
-	stmt, err := tx.Prepare("UPDATE Repositories SET schedule = ?, source = ?, destination = ? WHERE uuid = ?")
+	settings, err := marshalSettings(repo)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("UPDATE Repositories SET schedule = ?, source = ?, ref_filters = ?, mode = ?, backup = ?, prune = ?, protected = ?, lfs = ?, submodules = ?, timeout = ?, direction = ?, conflicts = ?, mappings = ?, verify = ?, limits = ?, connections = ?, archives = ?, depth = ?, shallow_since = ?, retry = ?, overlap = ? WHERE uuid = ?")
 	if err != nil {
 		return fmt.Errorf("failed to create statement: %w", err)
 	}
 
-	if _, err := stmt.Exec(repo.Schedule, repo.Source, repo.Destination, uuid); err != nil {
+	if _, err := stmt.Exec(repo.Schedule, repo.Source, settings.refFilters, repo.Mode, settings.backup, repo.Prune, settings.protected, repo.LFS, settings.submodules, repo.Timeout, repo.Direction, repo.Conflicts, settings.mappings, settings.verify, settings.limits, settings.connections, settings.archives, repo.Depth, repo.ShallowSince, settings.retry, repo.Overlap, uuid); err != nil {
 		return fmt.Errorf("failed to update repository entry for %s::'%s'", uuid, repo.Name)
 	}
 
-	for ref, auth := range repo.Authentications {
-		if auth.Basic != nil {
-			stmt, err := tx.Prepare("UPDATE Authentication SET username = ?, password = ?, token = null WHERE repository = ? AND ref = ?")
-			if err != nil {
-				return fmt.Errorf("failed to create statement: %w", err)
-			}
-			if _, err := stmt.Exec(auth.Basic.Username, auth.Basic.Password, uuid, ref); err != nil {
-				return fmt.Errorf("failed to execut sql query: %s", err)
+	if err := r.saveMirrors(tx, uuid, repo.Mirrors); err != nil {
+		return err
+	}
+
+	return r.saveAuthentications(tx, uuid, repo.Authentications)
+}
+
+// SaveSubmodule creates or updates a repository discovered as a submodule
+// of parent, in the project of parent, and returns it
+func (r *Repository) SaveSubmodule(parent, repo project.Repository) (project.Repository, error) {
+	row := r.db.QueryRow("SELECT project FROM Repositories WHERE uuid = ?", parent.UUID)
+	if row.Err() != nil {
+		return project.Repository{}, fmt.Errorf("failed to get row from database: %w", row.Err())
+	}
+
+	var projectUUID string
+	if err := row.Scan(&projectUUID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return project.Repository{}, fmt.Errorf("repository %s: %w", parent.Name, ErrNotFound)
+		}
+		return project.Repository{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	// two submodules with the same name would share the row and the cache
+	// of the daemon, only the same submodule of the same parent is updated
+	var source string
+	var current sql.NullString
+	exists := true
+	row = r.db.QueryRow("SELECT source, parent FROM Repositories WHERE name = ?", repo.Name)
+	if err := row.Scan(&source, &current); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return project.Repository{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		exists = false
+	}
+	if exists && (source != repo.Source || current.String != parent.UUID) {
+		return project.Repository{}, fmt.Errorf("repository %s (%s): %w", repo.Name, source, ErrNameTaken)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return project.Repository{}, fmt.Errorf("failed to create transaction: %s", err)
+	}
+
+	repo.Parent = parent.UUID
+	if exists {
+		err = r.updateRepository(tx, repo)
+	} else {
+		err = r.createRepository(tx, projectUUID, repo)
+	}
+	if err != nil {
+		tx.Rollback()
+		return project.Repository{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return project.Repository{}, fmt.Errorf("failed to commit transaction: %s", err)
+	}
+
+	return r.RepositoryByName(repo.Name)
+}
+
+// checkNotSubmodule returns ErrNameTaken when the name is the one of a
+// repository created for a submodule.
+func (r *Repository) checkNotSubmodule(name string) error {
+	var parent sql.NullString
+	err := r.db.QueryRow("SELECT parent FROM Repositories WHERE name = ? AND parent IS NOT NULL AND parent != ''", name).Scan(&parent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan row: %w", err)
+	}
+	return fmt.Errorf("repository %s is the mirror of a submodule: %w", name, ErrNameTaken)
+}
+
+// PruneSubmodules removes the submodule repositories of parent that are not
+// in keep, with their own submodules, and returns their names
+func (r *Repository) PruneSubmodules(parentUUID string, keep []string) (removed []string, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %s", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if cerr := tx.Commit(); cerr != nil {
+			err = fmt.Errorf("failed to commit transaction: %s", cerr)
+		}
+	}()
+
+	parents := []string{parentUUID}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		rows, err := tx.Query("SELECT uuid, name FROM Repositories WHERE parent = ?", parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the submodules of %s: %w", parent, err)
+		}
+		var stale []string
+		for rows.Next() {
+			var uuid, name string
+			if err := rows.Scan(&uuid, &name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan repository entry: %w", err)
 			}
-		} else {
-			stmt, err := tx.Prepare("UPDATE Authentication SET username = null, password = null, token = ? WHERE repository = ? AND ref = ?")
-			if err != nil {
-				return fmt.Errorf("failed to create statement: %w", err)
+			// the submodules of a removed one are removed with it
+			if parent == parentUUID && slices.Contains(keep, name) {
+				continue
 			}
-			if _, err := stmt.Exec(auth.Token, uuid, ref); err != nil {
-				return fmt.Errorf("failed to execute sql query: %s", err)
+			stale = append(stale, uuid)
+			removed = append(removed, name)
+		}
+		rows.Close()
+
+		for _, uuid := range stale {
+			if err := removeRepository(tx, uuid); err != nil {
+				return nil, err
 			}
 		}
+		parents = append(parents, stale...)
 	}
 
+	return removed, nil
+}
+
+// removeRepository deletes the repository with its authentications, mirrors
+// and runs
+func removeRepository(tx *sql.Tx, uuid string) error {
+	if _, err := tx.Exec("DELETE FROM Authentication WHERE repository = ?", uuid); err != nil {
+		return fmt.Errorf("failed to delete the authentication entries from the database: %s", err)
+	}
+	if _, err := tx.Exec("DELETE FROM Mirrors WHERE repository = ?", uuid); err != nil {
+		return fmt.Errorf("failed to delete the mirror entries from the database: %s", err)
+	}
+	if _, err := tx.Exec("DELETE FROM Runs WHERE repository = ?", uuid); err != nil {
+		return fmt.Errorf("failed to delete the run entries from the database: %s", err)
+	}
+	if _, err := tx.Exec("DELETE FROM Repositories WHERE uuid = ?", uuid); err != nil {
+		return fmt.Errorf("failed to delete the repository from the database: %s", err)
+	}
 	return nil
 }
 
-func (r *Repository) Remove(pr project.Project) error {
+func (r *Repository) Remove(pr project.Project) (err error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to create transaction: %s", err)
@@ -289,10 +504,15 @@ func (r *Repository) Remove(pr project.Project) error {
 			tx.Rollback()
 			return
 		}
-		tx.Commit()
+		if cerr := tx.Commit(); cerr != nil {
+			err = fmt.Errorf("failed to commit transaction: %s", cerr)
+		}
 	}()
 
 	uuid, err := r.ProjectUUID(pr.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get project uuid: %w", err)
+	}
 
 	repos, err := r.listRepositories(uuid)
 	if err != nil {
@@ -300,15 +520,11 @@ func (r *Repository) Remove(pr project.Project) error {
 	}
 
 	for _, repo := range repos {
-		if _, err := tx.Exec("DELETE FROM Authentication WHERE repository = ?", repo.UUID); err != nil {
-			return fmt.Errorf("failed to delete the authentication entries from the database: %s", err)
+		if err := removeRepository(tx, repo.UUID); err != nil {
+			return err
 		}
 	}
 
-	if _, err := tx.Exec("DELETE FROM Repositories WHERE project = ?", uuid); err != nil {
-		return fmt.Errorf("failed to delete the repositories from the database: %s", err)
-	}
-
 	if _, err := tx.Exec("DELETE FROM Projects WHERE uuid = ?", uuid); err != nil {
 		return fmt.Errorf("failed to delete the project from the database: %s", err)
 	}
@@ -319,7 +535,7 @@ func (r *Repository) Remove(pr project.Project) error {
 func (r *Repository) List() ([]project.Project, error) {
 	var prs []project.Project
 
-	rows, err := r.db.Query("SELECT uuid, name FROM Projects")
+	rows, err := r.db.Query("SELECT uuid, name, paused FROM Projects")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get the list of projects: %w", err)
 	}
@@ -327,7 +543,7 @@ func (r *Repository) List() ([]project.Project, error) {
 
 	for rows.Next() {
 		var pr project.Project
-		if err := rows.Scan(&pr.UUID, &pr.Name); err != nil {
+		if err := rows.Scan(&pr.UUID, &pr.Name, &pr.Paused); err != nil {
 			return nil, fmt.Errorf("failed to scan project name: %w", err)
 		}
 
@@ -344,8 +560,65 @@ func (r *Repository) List() ([]project.Project, error) {
 	return prs, nil
 }
 
+// Project returns the project with its repositories, or ErrNotFound
+func (r *Repository) Project(name string) (project.Project, error) {
+	pr := project.Project{
+		Name: name,
+	}
+
+	uuid, err := r.ProjectUUID(name)
+	if err != nil {
+		return project.Project{}, err
+	}
+	if len(uuid) == 0 {
+		return project.Project{}, fmt.Errorf("project %s: %w", name, ErrNotFound)
+	}
+	pr.UUID = uuid
+
+	if err := r.db.QueryRow("SELECT paused FROM Projects WHERE uuid = ?", uuid).Scan(&pr.Paused); err != nil {
+		return project.Project{}, fmt.Errorf("failed to read the paused state of %s: %w", name, err)
+	}
+
+	repos, err := r.listRepositories(uuid)
+	if err != nil {
+		return project.Project{}, err
+	}
+	pr.Repositories = repos
+
+	return pr, nil
+}
+
+// RepositoryByName returns the repository with its mirrors and
+// authentications, or ErrNotFound
+func (r *Repository) RepositoryByName(name string) (project.Repository, error) {
+	row := r.db.QueryRow("SELECT project FROM Repositories WHERE name = ?", name)
+	if row.Err() != nil {
+		return project.Repository{}, fmt.Errorf("failed to get row from database: %w", row.Err())
+	}
+
+	var projectUUID string
+	if err := row.Scan(&projectUUID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return project.Repository{}, fmt.Errorf("repository %s: %w", name, ErrNotFound)
+		}
+		return project.Repository{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	repos, err := r.listRepositories(projectUUID)
+	if err != nil {
+		return project.Repository{}, err
+	}
+	for _, repo := range repos {
+		if repo.Name == name {
+			return repo, nil
+		}
+	}
+
+	return project.Repository{}, fmt.Errorf("repository %s: %w", name, ErrNotFound)
+}
+
 func (r *Repository) listRepositories(projectUUID string) ([]project.Repository, error) {
-	stmt, err := r.db.Prepare("SELECT uuid, name, schedule, source, destination FROM Repositories WHERE project = ?")
+	stmt, err := r.db.Prepare("SELECT uuid, name, schedule, source, ref_filters, mode, backup, prune, protected, lfs, submodules, parent, timeout, direction, conflicts, mappings, verify, limits, connections, archives, depth, shallow_since, retry, overlap, paused FROM Repositories WHERE project = ?")
 	if err != nil {
 		return nil, fmt.Errorf("invalid syntax: %w", err)
 	}
@@ -359,10 +632,69 @@ func (r *Repository) listRepositories(projectUUID string) ([]project.Repository,
 	var repositories []project.Repository
 	for rows.Next() {
 		var repo project.Repository
-		if err := rows.Scan(&repo.UUID, &repo.Name, &repo.Schedule, &repo.Source, &repo.Destination); err != nil {
+		var refFilters, backup, protected, submodules, parent, mappings, verify, limits, connections, archives, retry sql.NullString
+		if err := rows.Scan(&repo.UUID, &repo.Name, &repo.Schedule, &repo.Source, &refFilters, &repo.Mode, &backup, &repo.Prune, &protected, &repo.LFS, &submodules, &parent, &repo.Timeout, &repo.Direction, &repo.Conflicts, &mappings, &verify, &limits, &connections, &archives, &repo.Depth, &repo.ShallowSince, &retry, &repo.Overlap, &repo.Paused); err != nil {
 			return nil, fmt.Errorf("failed to scan repository entry: %w", err)
 		}
 
+		if refFilters.Valid {
+			if err := json.Unmarshal([]byte(refFilters.String), &repo.Refs); err != nil {
+				return nil, fmt.Errorf("failed to parse ref filters of %s: %w", repo.Name, err)
+			}
+		}
+		if mappings.Valid {
+			if err := json.Unmarshal([]byte(mappings.String), &repo.Mappings); err != nil {
+				return nil, fmt.Errorf("failed to parse ref mappings of %s: %w", repo.Name, err)
+			}
+		}
+		if connections.Valid {
+			if err := json.Unmarshal([]byte(connections.String), &repo.Connections); err != nil {
+				return nil, fmt.Errorf("failed to parse connection settings of %s: %w", repo.Name, err)
+			}
+		}
+		if archives.Valid {
+			if err := json.Unmarshal([]byte(archives.String), &repo.Archives); err != nil {
+				return nil, fmt.Errorf("failed to parse archive settings of %s: %w", repo.Name, err)
+			}
+		}
+		if limits.Valid {
+			if err := json.Unmarshal([]byte(limits.String), &repo.Limits); err != nil {
+				return nil, fmt.Errorf("failed to parse limits of %s: %w", repo.Name, err)
+			}
+		}
+		if verify.Valid {
+			if err := json.Unmarshal([]byte(verify.String), &repo.Verify); err != nil {
+				return nil, fmt.Errorf("failed to parse verify settings of %s: %w", repo.Name, err)
+			}
+		}
+		if backup.Valid {
+			if err := json.Unmarshal([]byte(backup.String), &repo.Backup); err != nil {
+				return nil, fmt.Errorf("failed to parse backup settings of %s: %w", repo.Name, err)
+			}
+		}
+		if protected.Valid {
+			if err := json.Unmarshal([]byte(protected.String), &repo.Protected); err != nil {
+				return nil, fmt.Errorf("failed to parse protected refs of %s: %w", repo.Name, err)
+			}
+		}
+		if submodules.Valid {
+			if err := json.Unmarshal([]byte(submodules.String), &repo.Submodules); err != nil {
+				return nil, fmt.Errorf("failed to parse submodule settings of %s: %w", repo.Name, err)
+			}
+		}
+		if retry.Valid {
+			if err := json.Unmarshal([]byte(retry.String), &repo.Retry); err != nil {
+				return nil, fmt.Errorf("failed to parse retry settings of %s: %w", repo.Name, err)
+			}
+		}
+		repo.Parent = parent.String
+
+		mirrors, err := r.listMirrors(repo.UUID)
+		if err != nil {
+			return nil, err
+		}
+		repo.Mirrors = mirrors
+
 		auth, err := r.listAuthentications(repo.UUID)
 		if err != nil {
 			return nil, err
@@ -376,7 +708,7 @@ func (r *Repository) listRepositories(projectUUID string) ([]project.Repository,
 }
 
 func (r *Repository) listAuthentications(repositoryUUID string) (map[string]project.AuthenticationSettings, error) {
-	stmt, err := r.db.Prepare("SELECT ref, username, password, token FROM Authentication WHERE repository = ?")
+	stmt, err := r.db.Prepare("SELECT ref, username, password, token, ssh_username, ssh_private_key, ssh_passphrase, ssh_known_hosts, ssh_host_key_fingerprint FROM Authentication WHERE repository = ?")
 	if err != nil {
 		return nil, fmt.Errorf("invalid syntax: %w", err)
 	}
@@ -391,7 +723,8 @@ func (r *Repository) listAuthentications(repositoryUUID string) (map[string]proj
 	for rows.Next() {
 		var ref string
 		var username, password, token *string
-		if err := rows.Scan(&ref, &username, &password, &token); err != nil {
+		var sshUsername, sshPrivateKey, sshPassphrase, sshKnownHosts, sshFingerprint sql.NullString
+		if err := rows.Scan(&ref, &username, &password, &token, &sshUsername, &sshPrivateKey, &sshPassphrase, &sshKnownHosts, &sshFingerprint); err != nil {
 			return nil, fmt.Errorf("failed to scan authentication entry: %s", err)
 		}
 		if token != nil {
@@ -405,6 +738,16 @@ func (r *Repository) listAuthentications(repositoryUUID string) (map[string]proj
 					Password: *password,
 				},
 			}
+		} else if sshPrivateKey.Valid {
+			res[ref] = project.AuthenticationSettings{
+				SSH: &project.SSHAuthenticationSettings{
+					Username:           sshUsername.String,
+					PrivateKey:         sshPrivateKey.String,
+					Passphrase:         sshPassphrase.String,
+					KnownHosts:         sshKnownHosts.String,
+					HostKeyFingerprint: sshFingerprint.String,
+				},
+			}
 		}
 	}
 
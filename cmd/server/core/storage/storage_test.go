@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"mirror-sync/pkg/project"
+)
+
+func newTestDB(t *testing.T) *Repository {
+	t.Helper()
+	r, err := OpenDB(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.db.Close() })
+	if err := r.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func testProject(mirrors ...string) project.Project {
+	repo := project.Repository{
+		Name:            "p-r",
+		Source:          "https://git.example.com/r",
+		Schedule:        "* * * * *",
+		Authentications: map[string]project.AuthenticationSettings{},
+	}
+	for _, m := range mirrors {
+		repo.Mirrors = append(repo.Mirrors, project.Mirror{Name: m, URL: "https://" + m + ".example.com/r"})
+		repo.Authentications[m] = project.AuthenticationSettings{Token: m + "-token"}
+	}
+	return project.Project{Name: "p", Repositories: []project.Repository{repo}}
+}
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   []string
+		second  []string
+		mirrors []string
+	}{
+		{name: "create", first: []string{"a"}, mirrors: []string{"a"}},
+		{name: "add a mirror", first: []string{"a"}, second: []string{"a", "b"}, mirrors: []string{"a", "b"}},
+		{name: "remove a mirror", first: []string{"a", "b"}, second: []string{"b"}, mirrors: []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestDB(t)
+			if err := r.Save(testProject(tt.first...)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.second != nil {
+				if err := r.Save(testProject(tt.second...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertMirrors(t, savedRepository(t, r), tt.mirrors)
+		})
+	}
+}
+
+func TestUpdateRollsBack(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.Save(testProject("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mirrors are saved, then the authentications fail
+	if _, err := r.db.Exec("CREATE TRIGGER fail BEFORE INSERT ON Authentication BEGIN SELECT RAISE(ABORT, 'failed'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(testProject("c")); err == nil {
+		t.Fatal("update succeeded")
+	}
+
+	assertMirrors(t, savedRepository(t, r), []string{"a", "b"})
+}
+
+func TestRemove(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.Save(testProject("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(project.Project{Name: "p"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := r.RepositoryExistsByName("p-r"); err != nil || exists {
+		t.Errorf("repository exists is %t (%v) after the removal", exists, err)
+	}
+	var n int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM Authentication").Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d authentications (%v) left after the removal", n, err)
+	}
+}
+
+// savedRepository returns the repository of testProject as stored
+func savedRepository(t *testing.T, r *Repository) project.Repository {
+	t.Helper()
+	pr, err := r.Project("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.Repositories) != 1 {
+		t.Fatalf("got %d repositories, want 1", len(pr.Repositories))
+	}
+	return pr.Repositories[0]
+}
+
+func TestSaveRejectsSubmoduleName(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.Save(testProject("a")); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := r.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SaveSubmodule(parent, testSubmodule("p-r-lib")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"p", "other"} {
+		pr := testProject("a")
+		pr.Name = name
+		pr.Repositories[0].Name = "p-r-lib"
+		if err := r.Save(pr); !errors.Is(err, ErrNameTaken) {
+			t.Errorf("project %s: got %v, want %s", name, err, ErrNameTaken)
+		}
+	}
+
+	child, err := r.RepositoryByName("p-r-lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.Parent != parent.UUID {
+		t.Errorf("submodule parent is %q, want %q", child.Parent, parent.UUID)
+	}
+}
+
+func TestPruneSubmodules(t *testing.T) {
+	r := newTestDB(t)
+	if err := r.Save(testProject("a")); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := r.RepositoryByName("p-r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var children []project.Repository
+	for _, name := range []string{"p-r-kept", "p-r-stale"} {
+		child, err := r.SaveSubmodule(parent, testSubmodule(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, child)
+	}
+	// a submodule of the stale submodule goes with it
+	if _, err := r.SaveSubmodule(children[1], testSubmodule("p-r-stale-nested")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.StartRun(children[1].UUID, project.TriggerCron, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := r.PruneSubmodules(parent.UUID, []string{"p-r-kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"p-r-stale", "p-r-stale-nested"}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		exists bool
+	}{{"p-r", true}, {"p-r-kept", true}, {"p-r-stale", false}, {"p-r-stale-nested", false}} {
+		if exists, err := r.RepositoryExistsByName(tt.name); err != nil || exists != tt.exists {
+			t.Errorf("%s exists is %t (%v), want %t", tt.name, exists, err, tt.exists)
+		}
+	}
+	var n int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM Runs WHERE repository = ?", children[1].UUID).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d runs (%v) left for the removed submodule", n, err)
+	}
+}
+
+func testSubmodule(name string) project.Repository {
+	return project.Repository{
+		Name:            name,
+		Source:          "https://git.example.com/" + name,
+		Schedule:        "* * * * *",
+		Mirrors:         []project.Mirror{{Name: "mirror", URL: "https://mirror.example.com/" + name}},
+		Authentications: map[string]project.AuthenticationSettings{},
+	}
+}
+
+func assertMirrors(t *testing.T, repo project.Repository, want []string) {
+	t.Helper()
+	if len(repo.Mirrors) != len(want) {
+		t.Fatalf("got %d mirrors, want %v", len(repo.Mirrors), want)
+	}
+	for i, m := range repo.Mirrors {
+		if m.Name != want[i] {
+			t.Errorf("mirror %d is %s, want %s", i, m.Name, want[i])
+		}
+		if auth := repo.Authentications[m.Name]; auth.Token != m.Name+"-token" {
+			t.Errorf("mirror %s has the token %q", m.Name, auth.Token)
+		}
+	}
+}
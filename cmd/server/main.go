@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"mirror-sync/cmd/server/api"
 	"mirror-sync/cmd/server/core/config"
+	"mirror-sync/cmd/server/core/git"
 	cronruntime "mirror-sync/cmd/server/core/runtime"
 	"mirror-sync/cmd/server/core/storage"
 	"mirror-sync/pkg/constants"
+	"mirror-sync/pkg/project"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -35,6 +43,11 @@ func main() {
 		dbPath = c.Database.Path
 	}
 
+	cachePath := os.Getenv("MIRRORSYNC_CACHE_PATH")
+	if len(cachePath) == 0 {
+		cachePath = c.Cache.Path
+	}
+
 	p := os.Getenv("MIRRORSYNC_PORT")
 	if len(p) == 0 {
 		p = fmt.Sprintf("%d", c.Server.Port)
@@ -59,6 +72,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the runs left running were stopped with the previous daemon
+	if err := data.InterruptRuns(time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start server:", err.Error())
+		os.Exit(1)
+	}
+
 	// runtime
 	prs, err := data.List()
 	if err != nil {
@@ -66,7 +85,42 @@ func main() {
 		os.Exit(1)
 	}
 
-	scheduler, err := cronruntime.New(prs)
+	cache, err := git.NewCache(cachePath, c.Cache.MaxSizeMB*1024*1024)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start server:", err.Error())
+		os.Exit(1)
+	}
+
+	timeout, err := project.ParseDuration(c.Sync.Timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start server: bad sync timeout:", err.Error())
+		os.Exit(1)
+	}
+
+	conn, err := connection(c.Connection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start server: bad connection settings:", err.Error())
+		os.Exit(1)
+	}
+
+	for host, limit := range c.Sync.HostConcurrency {
+		if limit < 0 {
+			fmt.Fprintf(os.Stderr, "failed to start server: bad concurrency of %s: %d\n", host, limit)
+			os.Exit(1)
+		}
+	}
+
+	scheduler, err := cronruntime.New(prs, cache, data, cronruntime.Options{
+		Timeout:         timeout,
+		Connection:      conn,
+		Concurrency:     c.Sync.Concurrency,
+		HostConcurrency: c.Sync.HostConcurrency,
+		Limits: git.Limits{
+			MaxPackSize: c.Sync.Limits.MaxPackSizeMB * 1024 * 1024,
+			MaxObjects:  c.Sync.Limits.MaxObjects,
+			MaxRefs:     c.Sync.Limits.MaxRefs,
+		},
+	})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to start server:", err.Error())
 		os.Exit(1)
@@ -78,9 +132,58 @@ func main() {
 	// api
 	s := api.NewServer(data, scheduler, c.Server.Address, port)
 
+	// on stop, the syncs are canceled first, the manual ones hold their
+	// request until they are recorded
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		slog.Info("daemon stopping")
+		scheduler.Stop()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.Server.Shutdown(shutdown); err != nil {
+			slog.Error(fmt.Sprintf("failed to stop server: %s", err))
+		}
+	}()
+
 	slog.Info(fmt.Sprintf("daemon listening to %s:%s", c.Server.Address, p))
-	if err := s.Server.ListenAndServe(); err != nil {
+	if err := s.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		fmt.Fprintln(os.Stderr, "failed to start server:", err.Error())
 		os.Exit(1)
 	}
+	<-stopped
+}
+
+// connection reads the certificates of the default connection settings.
+func connection(c config.ConnectionConfiguration) (git.Connection, error) {
+	conn := git.Connection{
+		Proxy:   c.Proxy,
+		NoProxy: c.NoProxy,
+	}
+	if c.InsecureSkipVerify {
+		// the remotes that do not turn it back on are not verified
+		slog.Warn("the certificates of the servers are not verified by default, set insecure_skip_verify to false on the remotes to verify them")
+		conn.InsecureSkipVerify = &c.InsecureSkipVerify
+	}
+
+	var err error
+	for _, f := range []struct {
+		path string
+		dst  *[]byte
+	}{
+		{c.CABundlePath, &conn.CABundle},
+		{c.ClientCertPath, &conn.ClientCert},
+		{c.ClientKeyPath, &conn.ClientKey},
+	} {
+		if len(f.path) == 0 {
+			continue
+		}
+		if *f.dst, err = os.ReadFile(f.path); err != nil {
+			return git.Connection{}, err
+		}
+	}
+	return conn, nil
 }
@@ -3,6 +3,7 @@ module mirror-sync
 go 1.25
 
 require (
+	github.com/ProtonMail/go-crypto v1.3.0
 	github.com/go-chi/chi/v5 v5.2.3
 	github.com/go-git/go-git/v6 v6.0.0-20250929195514-145daf2492dd
 	github.com/goccy/go-yaml v1.18.0
@@ -11,11 +12,12 @@ require (
 	github.com/ncruces/go-sqlite3 v0.29.1
 	github.com/pressly/goose/v3 v3.26.0
 	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/crypto v0.42.0
+	golang.org/x/net v0.44.0
 )
 
 require (
 	github.com/Microsoft/go-winio v0.6.2 // indirect
-	github.com/ProtonMail/go-crypto v1.3.0 // indirect
 	github.com/cloudflare/circl v1.6.1 // indirect
 	github.com/cyphar/filepath-securejoin v0.4.1 // indirect
 	github.com/emirpasic/gods v1.18.1 // indirect
@@ -31,8 +33,6 @@ require (
 	github.com/sethvargo/go-retry v0.3.0 // indirect
 	github.com/tetratelabs/wazero v1.9.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.42.0 // indirect
-	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 )
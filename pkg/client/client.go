@@ -9,6 +9,7 @@ import (
 	"mirror-sync/pkg/remote/obj"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 type (
@@ -181,6 +182,178 @@ func (c *Client) RunOne(pr project.Project) error {
 	return nil
 }
 
+func (c *Client) Backups(repository, mirror string) ([]obj.Backup, error) {
+	url, err := url.JoinPath(c.url, "api", "v1", "repositories", repository, "mirrors", mirror, "backups")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make url: %s", err)
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	var payload obj.HTTPObject[[]obj.Backup]
+	d := json.NewDecoder(res.Body)
+	if err := d.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to parse the server response, is your client up-to-date? (reason: %s)", err)
+	}
+
+	return payload.Data, nil
+}
+
+func (c *Client) Restore(repository, mirror, ref string) error {
+	url, err := url.JoinPath(c.url, "api", "v1", "repositories", repository, "mirrors", mirror, "restore")
+	if err != nil {
+		return fmt.Errorf("failed to make url: %s", err)
+	}
+
+	data, err := json.Marshal(obj.RestoreRequest{Ref: ref})
+	if err != nil {
+		return fmt.Errorf("failed to marshal restore request: %s", err)
+	}
+
+	r := bytes.NewReader(data)
+
+	req, err := http.NewRequest("EXECUTE", url, r)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %s", err)
+	}
+
+	cli := http.Client{}
+	res, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	return nil
+}
+
+func (c *Client) Queue() ([]obj.Job, error) {
+	url, err := url.JoinPath(c.url, "api", "v1", "queue")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make url: %s", err)
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	var payload obj.HTTPObject[[]obj.Job]
+	d := json.NewDecoder(res.Body)
+	if err := d.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to parse the server response, is your client up-to-date? (reason: %s)", err)
+	}
+
+	return payload.Data, nil
+}
+
+func (c *Client) Runs(repository string, limit int) ([]project.Run, error) {
+	url, err := url.JoinPath(c.url, "api", "v1", "repositories", repository, "runs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make url: %s", err)
+	}
+
+	res, err := http.Get(fmt.Sprintf("%s?limit=%d", url, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	var payload obj.HTTPObject[[]project.Run]
+	d := json.NewDecoder(res.Body)
+	if err := d.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to parse the server response, is your client up-to-date? (reason: %s)", err)
+	}
+
+	return payload.Data, nil
+}
+
+func (c *Client) Run(id int64) (project.Run, error) {
+	url, err := url.JoinPath(c.url, "api", "v1", "runs", strconv.FormatInt(id, 10))
+	if err != nil {
+		return project.Run{}, fmt.Errorf("failed to make url: %s", err)
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		return project.Run{}, fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return project.Run{}, fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	var payload obj.HTTPObject[project.Run]
+	d := json.NewDecoder(res.Body)
+	if err := d.Decode(&payload); err != nil {
+		return project.Run{}, fmt.Errorf("failed to parse the server response, is your client up-to-date? (reason: %s)", err)
+	}
+
+	return payload.Data, nil
+}
+
+// Pause stops the syncs of the project, or of one of its repositories when
+// repository is set, until they are resumed.
+func (c *Client) Pause(pr project.Project, repository string) error {
+	return c.setPaused(pr, repository, "pause")
+}
+
+// Resume restarts the syncs paused by Pause.
+func (c *Client) Resume(pr project.Project, repository string) error {
+	return c.setPaused(pr, repository, "resume")
+}
+
+func (c *Client) setPaused(pr project.Project, repository, action string) error {
+	path := []string{"api", "v1", "projects", pr.Name, action}
+	if len(repository) > 0 {
+		path = []string{"api", "v1", "repositories", repository, action}
+	}
+	url, err := url.JoinPath(c.url, path...)
+	if err != nil {
+		return fmt.Errorf("failed to make url: %s", err)
+	}
+
+	req, err := http.NewRequest("EXECUTE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %s", err)
+	}
+
+	cli := http.Client{}
+	res, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send the request to the server: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("failed to send the request to the server: %s: %s", res.Status, toError(res.Body))
+	}
+
+	return nil
+}
+
 func toError(body io.ReadCloser) error {
 	var msg SimpleError
 
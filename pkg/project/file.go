@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/robfig/cron/v3"
@@ -25,23 +29,191 @@ type (
 	}
 
 	RepositoryDescriptor struct {
-		Storage  GitStorage `yaml:"storage"`
-		Schedule string     `yaml:"schedule"`
+		Storage  GitStorage     `yaml:"storage"`
+		Schedule string         `yaml:"schedule"`
+		Refs     RefsDescriptor `yaml:"refs"`
+		// Mappings rename the source refs on the mirrors, the first one that
+		// matches is used
+		Mappings []MappingDescriptor `yaml:"mappings"`
+		// Mode is "force" (default) or "safe"
+		Mode   string           `yaml:"mode"`
+		Backup BackupDescriptor `yaml:"backup"`
+		// Prune is "never" (default), "always" or "only-matching-filters"
+		Prune string `yaml:"prune"`
+		// Protected are full ref name patterns that are never deleted nor
+		// rewritten on the mirrors
+		Protected []string `yaml:"protected"`
+		// LFS mirrors the Git LFS objects too
+		LFS        bool                 `yaml:"lfs"`
+		Submodules SubmodulesDescriptor `yaml:"submodules"`
+		// Timeout stops a sync that takes longer (e.g. "30m"), overrides the
+		// timeout of the daemon
+		Timeout string `yaml:"timeout"`
+		// Verify only mirrors the refs signed by a trusted key
+		Verify VerifyDescriptor `yaml:"verify"`
+		// Limits abort the sync when the source grew too much
+		Limits LimitsDescriptor `yaml:"limits"`
+		// Direction is "push" (default) or "bidirectional"
+		Direction string `yaml:"direction"`
+		// Conflicts is "halt-and-report" (default), "source-wins" or
+		// "mirror-wins", only used in bidirectional mode
+		Conflicts string `yaml:"conflicts"`
+		// Archives are snapshots of the source tree of the selected refs
+		Archives *ArchivesDescriptor `yaml:"archives"`
+		// Depth only fetches this number of commits from the tip of each
+		// ref, ShallowSince the commits made after a date ("2024-01-31") or
+		// in a period before each sync ("90d")
+		Depth        int    `yaml:"depth"`
+		ShallowSince string `yaml:"shallow_since"`
+		// Retry tries the sync again after a transient failure
+		Retry RetryDescriptor `yaml:"retry"`
+		// Overlap is "allow" (default), "skip" or "queue-one", what is done
+		// with a sync started while the previous one is still in progress
+		Overlap string `yaml:"overlap"`
+	}
+
+	RetryDescriptor struct {
+		// Attempts is the maximum number of attempts of a sync, the first
+		// one included, 0 or 1 never retries
+		Attempts int `yaml:"attempts"`
+		// Delay is the wait before the first retry (default "10s"), doubled
+		// after each attempt up to MaxDelay (default "5m")
+		Delay    string `yaml:"delay"`
+		MaxDelay string `yaml:"max_delay"`
+		// Jitter spreads each delay randomly by up to this fraction of it,
+		// between 0 and 1
+		Jitter float64 `yaml:"jitter"`
+	}
+
+	ArchivesDescriptor struct {
+		// Path is the directory of the archives, on the host of the daemon
+		Path string `yaml:"path"`
+		// Branches and Tags are globs of the archived refs (e.g. "main", "v*")
+		Branches []string `yaml:"branches"`
+		Tags     []string `yaml:"tags"`
+		// Format is "tar.gz" (default) or "zip"
+		Format string `yaml:"format"`
+		// Retention is how long the branch snapshots are kept (e.g. "720h" or "30d"), forever if empty
+		Retention string `yaml:"retention"`
+		// Interval is the minimum time between two snapshots of a branch
+		// (e.g. "1d"), a snapshot per commit if empty
+		Interval string `yaml:"interval"`
+	}
+
+	SubmodulesDescriptor struct {
+		Enabled bool `yaml:"enabled"`
+		// URL is the destination of each submodule, {host}, {path} and {name}
+		// are replaced with the parts of the submodule url
+		URL string `yaml:"url"`
+		// Authentication is the one of the destinations, the one of the first
+		// mirror is used if empty
+		Authentication AuthenticationDescriptor `yaml:"authentication"`
+	}
+
+	BackupDescriptor struct {
+		Enabled bool `yaml:"enabled"`
+		// Retention is how long the backups are kept (e.g. "720h" or "30d"), forever if empty
+		Retention string `yaml:"retention"`
+	}
+
+	RefsDescriptor struct {
+		Branches PatternsDescriptor `yaml:"branches"`
+		Tags     PatternsDescriptor `yaml:"tags"`
+		// Others applies to the refs outside of refs/heads and refs/tags, with full ref names
+		Others PatternsDescriptor `yaml:"others"`
+	}
+
+	// LimitsDescriptor are lowered to the limits of the daemon, 0 means
+	// unlimited
+	LimitsDescriptor struct {
+		MaxPackSizeMB int64 `yaml:"max_pack_size_mb"`
+		MaxObjects    int64 `yaml:"max_objects"`
+		MaxRefs       int64 `yaml:"max_refs"`
+	}
+
+	VerifyDescriptor struct {
+		// OpenPGPKeys is an armored keyring of the trusted public keys
+		OpenPGPKeys     string `yaml:"openpgp_keys"`
+		OpenPGPKeysPath string `yaml:"openpgp_keys_path"`
+		// AllowedSigners has the format of the ssh allowed signers files
+		AllowedSigners     string `yaml:"allowed_signers"`
+		AllowedSignersPath string `yaml:"allowed_signers_path"`
+	}
+
+	// MappingDescriptor renames a source ref, a '*' in From is replaced with
+	// the same characters in To (e.g. refs/tags/* -> refs/tags/upstream/*)
+	MappingDescriptor struct {
+		From string `yaml:"from"`
+		To   string `yaml:"to"`
+	}
+
+	PatternsDescriptor struct {
+		Include []string `yaml:"include"`
+		Exclude []string `yaml:"exclude"`
 	}
 
 	GitStorage struct {
 		Source StorageSettings `yaml:"source"`
-		Mirror StorageSettings `yaml:"mirror"`
+		// Mirror is a shorthand for a single destination named "mirror"
+		Mirror  StorageSettings    `yaml:"mirror"`
+		Mirrors []MirrorDescriptor `yaml:"mirrors"`
+	}
+
+	MirrorDescriptor struct {
+		Name            string `yaml:"name"`
+		StorageSettings `yaml:",inline"`
+		// Bundle writes the refs in bundle files instead of pushing them to
+		// the url
+		Bundle *BundleDescriptor `yaml:"bundle"`
+	}
+
+	BundleDescriptor struct {
+		// Path is the directory of the bundles, on the host of the daemon
+		Path string `yaml:"path"`
+		// Keep is the number of bundles kept, 5 if neither it nor the
+		// retention is set
+		Keep int `yaml:"keep"`
+		// Retention is how long the bundles are kept (e.g. "720h" or "30d"), forever if empty
+		Retention string `yaml:"retention"`
 	}
 
 	StorageSettings struct {
 		URL            string                   `yaml:"url"`
 		Authentication AuthenticationDescriptor `yaml:"authentication"`
+		TLS            TLSDescriptor            `yaml:"tls"`
+		Proxy          ProxyDescriptor          `yaml:"proxy"`
+		// PushOptions are sent with the pushes to a mirror (git push -o)
+		PushOptions []string `yaml:"push_options"`
+		// Atomic updates every ref of a mirror or none of them
+		Atomic bool `yaml:"atomic"`
+	}
+
+	TLSDescriptor struct {
+		// CABundle are PEM certificates trusted on top of the system ones
+		CABundle     string `yaml:"ca_bundle"`
+		CABundlePath string `yaml:"ca_bundle_path"`
+		// InsecureSkipVerify turns the verification off or, when false, back
+		// on over the default of the daemon
+		InsecureSkipVerify *bool `yaml:"insecure_skip_verify"`
+		// ClientCert and ClientKey are sent to the servers that require mTLS
+		ClientCert     string `yaml:"client_cert"`
+		ClientCertPath string `yaml:"client_cert_path"`
+		ClientKey      string `yaml:"client_key"`
+		ClientKeyPath  string `yaml:"client_key_path"`
+	}
+
+	ProxyDescriptor struct {
+		// URL is an http://, https:// or socks5:// url
+		URL string `yaml:"url"`
+		// NoProxy are the hosts reached directly (names, .domains, IPs,
+		// CIDR ranges or "*")
+		NoProxy []string `yaml:"no_proxy"`
 	}
 
 	AuthenticationDescriptor struct {
 		Basic BasicAuthenticationDescriptor `yaml:"basic"`
 		Token string                        `yaml:"token"`
+		SSH   SSHAuthenticationDescriptor   `yaml:"ssh"`
 	}
 
 	BasicAuthenticationDescriptor struct {
@@ -49,6 +221,16 @@ type (
 		Password string `yaml:"password"`
 	}
 
+	SSHAuthenticationDescriptor struct {
+		Username           string `yaml:"username"`
+		PrivateKey         string `yaml:"private_key"`
+		PrivateKeyPath     string `yaml:"private_key_path"`
+		Passphrase         string `yaml:"passphrase"`
+		KnownHosts         string `yaml:"known_hosts"`
+		KnownHostsPath     string `yaml:"known_hosts_path"`
+		HostKeyFingerprint string `yaml:"host_key_fingerprint"`
+	}
+
 	DefaultValues struct {
 		DaemonURL   string
 		ProjectName string
@@ -114,15 +296,104 @@ func decode(mainFile MainFile, defaultValues DefaultValues) (Project, error) {
 
 	for repoName, repo := range mainFile.Repositories {
 		r := Repository{
-			Name:        fmt.Sprintf("%s-%s", pr.Name, strings.ToLower(repoName)),
-			Source:      repo.Storage.Source.URL,
-			Destination: repo.Storage.Mirror.URL,
-			Schedule:    repo.Schedule,
+			Name:     fmt.Sprintf("%s-%s", pr.Name, strings.ToLower(repoName)),
+			Source:   repo.Storage.Source.URL,
+			Schedule: repo.Schedule,
+			Mode:     ModeForce,
+			Refs: RefFilters{
+				Branches: RefPatterns(repo.Refs.Branches),
+				Tags:     RefPatterns(repo.Refs.Tags),
+				Others:   RefPatterns(repo.Refs.Others),
+			},
+			Backup:       BackupSettings(repo.Backup),
+			Prune:        PruneNever,
+			Direction:    DirectionPush,
+			Conflicts:    ConflictHalt,
+			Overlap:      OverlapAllow,
+			Protected:    repo.Protected,
+			Limits:       LimitSettings(repo.Limits),
+			LFS:          repo.LFS,
+			Timeout:      repo.Timeout,
+			Depth:        repo.Depth,
+			ShallowSince: repo.ShallowSince,
+			Retry:        RetrySettings(repo.Retry),
+			Submodules: SubmoduleSettings{
+				Enabled: repo.Submodules.Enabled,
+				URL:     repo.Submodules.URL,
+			},
+		}
+
+		for _, m := range repo.Mappings {
+			r.Mappings = append(r.Mappings, RefMapping(m))
+		}
+		if len(repo.Mode) > 0 {
+			r.Mode = repo.Mode
+		}
+		if len(repo.Prune) > 0 {
+			r.Prune = repo.Prune
+		}
+		if len(repo.Direction) > 0 {
+			r.Direction = repo.Direction
+		}
+		if len(repo.Conflicts) > 0 {
+			r.Conflicts = repo.Conflicts
+		}
+		if len(repo.Overlap) > 0 {
+			r.Overlap = repo.Overlap
+		}
+		if repo.Archives != nil {
+			r.Archives = &ArchiveSettings{
+				Path:      repo.Archives.Path,
+				Branches:  repo.Archives.Branches,
+				Tags:      repo.Archives.Tags,
+				Format:    ArchiveTarGz,
+				Retention: repo.Archives.Retention,
+				Interval:  repo.Archives.Interval,
+			}
+			if len(repo.Archives.Format) > 0 {
+				r.Archives.Format = repo.Archives.Format
+			}
+		}
+
+		// the files are read here, the daemon may not run on the same machine
+		var err error
+		r.Verify.OpenPGPKeys, err = readInlineOrFile(repo.Verify.OpenPGPKeys, repo.Verify.OpenPGPKeysPath)
+		if err != nil {
+			return Project{}, fmt.Errorf("%w: failed to read openpgp keys: %s", ErrIO, err)
+		}
+		r.Verify.AllowedSigners, err = readInlineOrFile(repo.Verify.AllowedSigners, repo.Verify.AllowedSignersPath)
+		if err != nil {
+			return Project{}, fmt.Errorf("%w: failed to read allowed signers: %s", ErrIO, err)
 		}
 
 		r.Authentications = make(map[string]AuthenticationSettings)
-		setAuthentication(r.Authentications, "source", repo.Storage.Source.Authentication)
-		setAuthentication(r.Authentications, "mirror", repo.Storage.Mirror.Authentication)
+		r.Connections = make(map[string]ConnectionSettings)
+		if err := setAuthentication(r.Authentications, "source", repo.Storage.Source.Authentication); err != nil {
+			return Project{}, err
+		}
+		if err := setConnection(r.Connections, "source", repo.Storage.Source); err != nil {
+			return Project{}, err
+		}
+		for _, m := range mirrors(repo.Storage) {
+			r.Mirrors = append(r.Mirrors, Mirror{
+				Name:        m.Name,
+				URL:         m.URL,
+				Bundle:      (*BundleSettings)(m.Bundle),
+				PushOptions: m.PushOptions,
+				Atomic:      m.Atomic,
+			})
+			if err := setAuthentication(r.Authentications, m.Name, m.Authentication); err != nil {
+				return Project{}, err
+			}
+			if err := setConnection(r.Connections, m.Name, m.StorageSettings); err != nil {
+				return Project{}, err
+			}
+		}
+		if repo.Submodules.Enabled {
+			if err := setAuthentication(r.Authentications, "submodules", repo.Submodules.Authentication); err != nil {
+				return Project{}, err
+			}
+		}
 
 		pr.Repositories = append(pr.Repositories, r)
 	}
@@ -130,7 +401,44 @@ func decode(mainFile MainFile, defaultValues DefaultValues) (Project, error) {
 	return pr, nil
 }
 
-func setAuthentication(m map[string]AuthenticationSettings, key string, auth AuthenticationDescriptor) {
+// mirrors returns every destination of the repository, the single
+// `mirror` entry included.
+func mirrors(gs GitStorage) []MirrorDescriptor {
+	var res []MirrorDescriptor
+	if len(strings.TrimSpace(gs.Mirror.URL)) > 0 {
+		res = append(res, MirrorDescriptor{
+			Name:            "mirror",
+			StorageSettings: gs.Mirror,
+		})
+	}
+	return append(res, gs.Mirrors...)
+}
+
+// setConnection reads the certificates of the remote, nothing is set when
+// the remote has no TLS nor proxy settings.
+func setConnection(m map[string]ConnectionSettings, key string, ss StorageSettings) error {
+	var c ConnectionSettings
+	var err error
+	if c.CABundle, err = readInlineOrFile(ss.TLS.CABundle, ss.TLS.CABundlePath); err != nil {
+		return fmt.Errorf("%w: failed to read ca bundle: %s", ErrIO, err)
+	}
+	if c.ClientCert, err = readInlineOrFile(ss.TLS.ClientCert, ss.TLS.ClientCertPath); err != nil {
+		return fmt.Errorf("%w: failed to read client certificate: %s", ErrIO, err)
+	}
+	if c.ClientKey, err = readInlineOrFile(ss.TLS.ClientKey, ss.TLS.ClientKeyPath); err != nil {
+		return fmt.Errorf("%w: failed to read client key: %s", ErrIO, err)
+	}
+	c.InsecureSkipVerify = ss.TLS.InsecureSkipVerify
+	c.Proxy = ss.Proxy.URL
+	c.NoProxy = ss.Proxy.NoProxy
+
+	if len(c.CABundle) > 0 || len(c.ClientCert) > 0 || len(c.ClientKey) > 0 || c.InsecureSkipVerify != nil || len(c.Proxy) > 0 || len(c.NoProxy) > 0 {
+		m[key] = c
+	}
+	return nil
+}
+
+func setAuthentication(m map[string]AuthenticationSettings, key string, auth AuthenticationDescriptor) error {
 	if len(auth.Token) > 0 {
 		m[key] = AuthenticationSettings{
 			Token: auth.Token,
@@ -142,7 +450,49 @@ func setAuthentication(m map[string]AuthenticationSettings, key string, auth Aut
 				Password: auth.Basic.Password,
 			},
 		}
+	} else if len(auth.SSH.PrivateKey) > 0 || len(auth.SSH.PrivateKeyPath) > 0 {
+		privateKey, err := readInlineOrFile(auth.SSH.PrivateKey, auth.SSH.PrivateKeyPath)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read ssh private key: %s", ErrIO, err)
+		}
+		knownHosts, err := readInlineOrFile(auth.SSH.KnownHosts, auth.SSH.KnownHostsPath)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read known_hosts: %s", ErrIO, err)
+		}
+		m[key] = AuthenticationSettings{
+			SSH: &SSHAuthenticationSettings{
+				Username:           auth.SSH.Username,
+				PrivateKey:         privateKey,
+				Passphrase:         auth.SSH.Passphrase,
+				KnownHosts:         knownHosts,
+				HostKeyFingerprint: auth.SSH.HostKeyFingerprint,
+			},
+		}
 	}
+	return nil
+}
+
+// readInlineOrFile returns the inline value, or else the content of the file.
+// The files are read here, the daemon may not run on the same machine.
+func readInlineOrFile(inline, path string) (string, error) {
+	if len(inline) > 0 || len(path) == 0 {
+		return inline, nil
+	}
+
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
 }
 
 func checkConfig(mf MainFile) error {
@@ -153,10 +503,13 @@ func checkConfig(mf MainFile) error {
 		if err := checkAuthenticationConfig(r.Storage.Source); err != nil {
 			return err
 		}
-		if len(strings.TrimSpace(r.Storage.Mirror.URL)) == 0 {
-			return fmt.Errorf("mirror is empty")
+		if err := checkConnectionConfig(r.Storage.Source); err != nil {
+			return err
+		}
+		if len(r.Storage.Source.PushOptions) > 0 || r.Storage.Source.Atomic {
+			return fmt.Errorf("push options can only be set on the mirrors")
 		}
-		if err := checkAuthenticationConfig(r.Storage.Mirror); err != nil {
+		if err := checkMirrorsConfig(r.Storage); err != nil {
 			return err
 		}
 		if len(strings.TrimSpace(r.Schedule)) == 0 {
@@ -165,14 +518,326 @@ func checkConfig(mf MainFile) error {
 		if _, err := cron.ParseStandard(r.Schedule); err != nil {
 			return fmt.Errorf("failed to validate schedule: %w", err)
 		}
+		if err := checkRefsConfig(r.Refs); err != nil {
+			return err
+		}
+		if err := checkMappingsConfig(r.Mappings); err != nil {
+			return err
+		}
+		if len(r.Mode) > 0 && r.Mode != ModeForce && r.Mode != ModeSafe {
+			return fmt.Errorf("unknown mode '%s', expected '%s' or '%s'", r.Mode, ModeForce, ModeSafe)
+		}
+		if len(r.Prune) > 0 && r.Prune != PruneNever && r.Prune != PruneAlways && r.Prune != PruneMatching {
+			return fmt.Errorf("unknown prune policy '%s', expected '%s', '%s' or '%s'", r.Prune, PruneNever, PruneAlways, PruneMatching)
+		}
+		if len(r.Direction) > 0 && r.Direction != DirectionPush && r.Direction != DirectionBidirectional {
+			return fmt.Errorf("unknown direction '%s', expected '%s' or '%s'", r.Direction, DirectionPush, DirectionBidirectional)
+		}
+		if len(r.Conflicts) > 0 && r.Conflicts != ConflictHalt && r.Conflicts != ConflictSourceWins && r.Conflicts != ConflictMirrorWins {
+			return fmt.Errorf("unknown conflict policy '%s', expected '%s', '%s' or '%s'", r.Conflicts, ConflictHalt, ConflictSourceWins, ConflictMirrorWins)
+		}
+		if len(r.Overlap) > 0 && r.Overlap != OverlapAllow && r.Overlap != OverlapSkip && r.Overlap != OverlapQueueOne {
+			return fmt.Errorf("unknown overlap policy '%s', expected '%s', '%s' or '%s'", r.Overlap, OverlapAllow, OverlapSkip, OverlapQueueOne)
+		}
+		if r.Direction == DirectionBidirectional {
+			// a ref missing on one side is copied to the other one, it
+			// cannot be told apart from a deleted ref
+			if len(r.Prune) > 0 && r.Prune != PruneNever {
+				return fmt.Errorf("prune policy '%s' cannot be used with direction '%s'", r.Prune, DirectionBidirectional)
+			}
+			if len(r.Mode) > 0 {
+				return fmt.Errorf("mode cannot be used with direction '%s', use conflicts instead", DirectionBidirectional)
+			}
+		}
+		for _, pattern := range r.Protected {
+			if !strings.HasPrefix(pattern, "refs/") {
+				return fmt.Errorf("protected ref pattern must be a full ref name (refs/...): %s", pattern)
+			}
+		}
+		if r.Submodules.Enabled {
+			if len(strings.TrimSpace(r.Submodules.URL)) == 0 {
+				return fmt.Errorf("url of submodules is empty")
+			}
+			if err := checkAuthenticationConfig(StorageSettings{Authentication: r.Submodules.Authentication}); err != nil {
+				return err
+			}
+		}
+		if r.Limits.MaxPackSizeMB < 0 || r.Limits.MaxObjects < 0 || r.Limits.MaxRefs < 0 {
+			return fmt.Errorf("limits cannot be negative")
+		}
+		if len(r.Timeout) > 0 {
+			if _, err := ParseDuration(r.Timeout); err != nil {
+				return fmt.Errorf("failed to validate timeout: %w", err)
+			}
+		}
+		if len(r.Backup.Retention) > 0 {
+			if _, err := ParseDuration(r.Backup.Retention); err != nil {
+				return fmt.Errorf("failed to validate backup retention: %w", err)
+			}
+		}
+		if r.Archives != nil {
+			if err := checkArchivesConfig(*r.Archives); err != nil {
+				return err
+			}
+		}
+		if err := checkShallowConfig(r); err != nil {
+			return err
+		}
+		if err := checkRetryConfig(r.Retry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkRetryConfig(r RetryDescriptor) error {
+	if r.Attempts < 0 {
+		return fmt.Errorf("retry attempts cannot be negative")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+	var delay, max time.Duration
+	var err error
+	if len(r.Delay) > 0 {
+		if delay, err = ParseDuration(r.Delay); err != nil {
+			return fmt.Errorf("failed to validate retry delay: %w", err)
+		}
+	}
+	if len(r.MaxDelay) > 0 {
+		if max, err = ParseDuration(r.MaxDelay); err != nil {
+			return fmt.Errorf("failed to validate retry max delay: %w", err)
+		}
+	}
+	if delay > 0 && max > 0 && max < delay {
+		return fmt.Errorf("retry max delay cannot be shorter than the delay")
+	}
+	return nil
+}
+
+// checkShallowConfig refuses the settings that need the whole history of
+// the source along with a shallow one.
+func checkShallowConfig(r RepositoryDescriptor) error {
+	if r.Depth < 0 {
+		return fmt.Errorf("depth must be positive")
+	}
+	if len(r.ShallowSince) > 0 {
+		if r.Depth > 0 {
+			return fmt.Errorf("depth and shallow_since cannot be used together")
+		}
+		if _, err := ParseDuration(r.ShallowSince); err != nil {
+			if _, err := ParseDate(r.ShallowSince); err != nil {
+				return fmt.Errorf("invalid shallow_since '%s', expected a date or a duration", r.ShallowSince)
+			}
+		}
+	}
+	if r.Depth == 0 && len(r.ShallowSince) == 0 {
+		return nil
 	}
 
+	// the ancestry of the mirror refs cannot be checked in a truncated
+	// history
+	switch {
+	case r.Mode == ModeSafe:
+		return fmt.Errorf("a shallow history cannot be used in mode '%s'", ModeSafe)
+	case r.Direction == DirectionBidirectional:
+		return fmt.Errorf("a shallow history cannot be used with direction '%s'", DirectionBidirectional)
+	case r.Backup.Enabled:
+		return fmt.Errorf("a shallow history cannot be used with backups")
+	case len(r.Protected) > 0:
+		return fmt.Errorf("a shallow history cannot be used with protected refs")
+	}
+	for _, m := range mirrors(r.Storage) {
+		if m.Bundle != nil {
+			return fmt.Errorf("a shallow history cannot be written in the bundle of mirror '%s'", m.Name)
+		}
+	}
 	return nil
 }
 
+func checkArchivesConfig(a ArchivesDescriptor) error {
+	if !filepath.IsAbs(a.Path) {
+		return fmt.Errorf("archives path must be absolute")
+	}
+	if len(a.Branches)+len(a.Tags) == 0 {
+		return fmt.Errorf("archives select no branch nor tag")
+	}
+	for _, pattern := range append(slices.Clone(a.Branches), a.Tags...) {
+		if len(strings.TrimSpace(pattern)) == 0 {
+			return fmt.Errorf("archive ref pattern is empty")
+		}
+		if strings.HasPrefix(pattern, "refs/") {
+			return fmt.Errorf("archive ref pattern must be a short name (e.g. main or v*): %s", pattern)
+		}
+	}
+	if len(a.Format) > 0 && a.Format != ArchiveTarGz && a.Format != ArchiveZip {
+		return fmt.Errorf("unknown archive format '%s', expected '%s' or '%s'", a.Format, ArchiveTarGz, ArchiveZip)
+	}
+	if len(a.Retention) > 0 {
+		if _, err := ParseDuration(a.Retention); err != nil {
+			return fmt.Errorf("failed to validate archives retention: %w", err)
+		}
+	}
+	if len(a.Interval) > 0 {
+		if _, err := ParseDuration(a.Interval); err != nil {
+			return fmt.Errorf("failed to validate archives interval: %w", err)
+		}
+	}
+	return nil
+}
+
+func checkMirrorsConfig(gs GitStorage) error {
+	ms := mirrors(gs)
+	if len(ms) == 0 {
+		return fmt.Errorf("mirror is empty")
+	}
+
+	names := make(map[string]bool)
+	for _, m := range ms {
+		if len(strings.TrimSpace(m.Name)) == 0 {
+			return fmt.Errorf("mirror name is empty")
+		}
+		if m.Name == "source" || m.Name == "submodules" {
+			return fmt.Errorf("mirror name '%s' is reserved", m.Name)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("mirror name '%s' is used more than once", m.Name)
+		}
+		names[m.Name] = true
+
+		if m.Bundle != nil {
+			if err := checkBundleConfig(m); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(strings.TrimSpace(m.URL)) == 0 {
+			return fmt.Errorf("url of mirror '%s' is empty", m.Name)
+		}
+		if err := checkAuthenticationConfig(m.StorageSettings); err != nil {
+			return err
+		}
+		if err := checkConnectionConfig(m.StorageSettings); err != nil {
+			return err
+		}
+		for _, o := range m.PushOptions {
+			// the options are sent in pkt-lines, one per line
+			if len(o) == 0 || strings.ContainsAny(o, "\n\x00") {
+				return fmt.Errorf("invalid push option '%s' of mirror '%s'", o, m.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func checkBundleConfig(m MirrorDescriptor) error {
+	if len(strings.TrimSpace(m.URL)) > 0 {
+		return fmt.Errorf("mirror '%s' cannot have both an url and a bundle", m.Name)
+	}
+	if len(m.PushOptions) > 0 || m.Atomic {
+		return fmt.Errorf("push options cannot be used with the bundle of mirror '%s'", m.Name)
+	}
+	if !filepath.IsAbs(m.Bundle.Path) {
+		return fmt.Errorf("bundle path of mirror '%s' must be absolute", m.Name)
+	}
+	if m.Bundle.Keep < 0 {
+		return fmt.Errorf("bundle keep of mirror '%s' must be positive", m.Name)
+	}
+	if len(m.Bundle.Retention) > 0 {
+		if _, err := ParseDuration(m.Bundle.Retention); err != nil {
+			return fmt.Errorf("failed to validate bundle retention of mirror '%s': %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkRefsConfig(refs RefsDescriptor) error {
+	for _, p := range [][]string{refs.Branches.Include, refs.Branches.Exclude, refs.Tags.Include, refs.Tags.Exclude} {
+		for _, pattern := range p {
+			if len(strings.TrimSpace(pattern)) == 0 {
+				return fmt.Errorf("ref pattern is empty")
+			}
+			if strings.HasPrefix(pattern, "refs/") {
+				return fmt.Errorf("branch and tag patterns are relative to refs/heads/ and refs/tags/: %s", pattern)
+			}
+		}
+	}
+	for _, p := range [][]string{refs.Others.Include, refs.Others.Exclude} {
+		for _, pattern := range p {
+			if !strings.HasPrefix(pattern, "refs/") {
+				return fmt.Errorf("ref pattern must be a full ref name (refs/...): %s", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func checkMappingsConfig(mappings []MappingDescriptor) error {
+	for _, m := range mappings {
+		if !strings.HasPrefix(m.From, "refs/") || !strings.HasPrefix(m.To, "refs/") {
+			return fmt.Errorf("ref mapping must use full ref names (refs/...): %s -> %s", m.From, m.To)
+		}
+		if strings.Count(m.From, "*") > 1 || strings.Count(m.From, "*") != strings.Count(m.To, "*") {
+			return fmt.Errorf("ref mapping must have a single '*' on both sides or none: %s -> %s", m.From, m.To)
+		}
+		if strings.HasPrefix(m.To, "refs/mirror-sync/") {
+			return fmt.Errorf("ref mapping cannot target refs/mirror-sync/: %s -> %s", m.From, m.To)
+		}
+	}
+	return nil
+}
+
+func checkConnectionConfig(ss StorageSettings) error {
+	hasCert := len(ss.TLS.ClientCert) > 0 || len(ss.TLS.ClientCertPath) > 0
+	hasKey := len(ss.TLS.ClientKey) > 0 || len(ss.TLS.ClientKeyPath) > 0
+	if hasCert != hasKey {
+		return fmt.Errorf("client certificate and client key must be set together")
+	}
+	if len(ss.Proxy.URL) > 0 {
+		u, err := url.Parse(ss.Proxy.URL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" && u.Scheme != "socks5h" {
+			return fmt.Errorf("unsupported proxy scheme '%s', expected http, https or socks5", u.Scheme)
+		}
+		if isSSH(ss.URL) && !strings.HasPrefix(u.Scheme, "socks5") {
+			return fmt.Errorf("ssh remotes can only use a socks5 proxy, got '%s'", u.Scheme)
+		}
+	}
+	return nil
+}
+
+// isSSH tells if rawURL is an ssh url or a scp-like one (git@host:path).
+func isSSH(rawURL string) bool {
+	if u, err := url.Parse(rawURL); err == nil && len(u.Scheme) > 1 {
+		return u.Scheme == "ssh" || u.Scheme == "git+ssh" || u.Scheme == "ssh+git"
+	}
+	colon := strings.Index(rawURL, ":")
+	return colon > 0 && !strings.Contains(rawURL[:colon], "/")
+}
+
 func checkAuthenticationConfig(ss StorageSettings) error {
-	if len(ss.Authentication.Token) > 0 && (len(ss.Authentication.Basic.Username) > 0 || len(ss.Authentication.Basic.Password) > 0) {
-		return fmt.Errorf("cannot use token and basic authentication in the same repository")
+	auth := ss.Authentication
+	methods := 0
+	if len(auth.Token) > 0 {
+		methods++
+	}
+	if len(auth.Basic.Username) > 0 || len(auth.Basic.Password) > 0 {
+		methods++
+	}
+	if len(auth.SSH.PrivateKey) > 0 || len(auth.SSH.PrivateKeyPath) > 0 {
+		methods++
+	}
+	if methods > 1 {
+		return fmt.Errorf("cannot use more than one authentication method in the same repository")
+	}
+	if len(auth.SSH.PrivateKey) > 0 && len(auth.SSH.PrivateKeyPath) > 0 {
+		return fmt.Errorf("cannot use private_key and private_key_path at the same time")
+	}
+	if len(auth.SSH.KnownHosts) > 0 && len(auth.SSH.KnownHostsPath) > 0 {
+		return fmt.Errorf("cannot use known_hosts and known_hosts_path at the same time")
 	}
 	return nil
 }
@@ -1,11 +1,108 @@
 package project
 
+import "time"
+
+const (
+	// ModeForce overwrites the mirror refs
+	ModeForce string = "force"
+	// ModeSafe refuses to overwrite the mirror refs that diverged from the source
+	ModeSafe string = "safe"
+)
+
+const (
+	// FailureError is any failure that has no reason of its own
+	FailureError string = "error"
+	// FailureTimeout is a sync that did not finish in time
+	FailureTimeout string = "timeout"
+	// FailureDiverged is a mirror that has refs that cannot be fast-forwarded
+	FailureDiverged string = "diverged"
+	// FailureConflict is a ref that changed on both the source and the
+	// mirror in bidirectional mode
+	FailureConflict string = "conflict"
+	// FailureUnverified is a sync that skipped refs that are not signed by a
+	// trusted key
+	FailureUnverified string = "unverified"
+	// FailureLimit is a sync aborted because the source exceeds a limit
+	FailureLimit string = "limit"
+	// FailureMismatch is a push that succeeded but left refs of the mirror
+	// with another value than the pushed one
+	FailureMismatch string = "mismatch"
+	// FailureUnsupported is a mirror that does not support the push options
+	FailureUnsupported string = "unsupported"
+	// FailureShallow is a mirror that does not have the history below the
+	// shallow boundary of the cache
+	FailureShallow string = "shallow"
+	// FailureLFSMissing is a sync that skipped refs with LFS objects that
+	// the source does not have
+	FailureLFSMissing string = "lfs-missing"
+)
+
+const (
+	// PruneNever keeps the mirror refs that are deleted on the source
+	PruneNever string = "never"
+	// PruneAlways deletes the mirror refs that are not on the source
+	PruneAlways string = "always"
+	// PruneMatching only deletes the mirror refs selected by the ref filters
+	PruneMatching string = "only-matching-filters"
+)
+
+const (
+	// DirectionPush only updates the mirrors
+	DirectionPush string = "push"
+	// DirectionBidirectional updates the source with the commits pushed to
+	// the mirrors too
+	DirectionBidirectional string = "bidirectional"
+)
+
+const (
+	// OverlapAllow starts a sync even when the previous one of the
+	// repository is still in progress
+	OverlapAllow string = "allow"
+	// OverlapSkip drops a sync started while the previous one is in progress
+	OverlapSkip string = "skip"
+	// OverlapQueueOne keeps a single sync waiting for the one in progress,
+	// the others are dropped
+	OverlapQueueOne string = "queue-one"
+)
+
+const (
+	// ConflictSourceWins overwrites the mirror ref with the source one when
+	// both changed
+	ConflictSourceWins string = "source-wins"
+	// ConflictMirrorWins overwrites the source ref with the mirror one
+	ConflictMirrorWins string = "mirror-wins"
+	// ConflictHalt leaves both refs as they are and reports the conflict
+	ConflictHalt string = "halt-and-report"
+)
+
+const (
+	// TriggerCron is a sync started by the schedule of the repository
+	TriggerCron string = "cron"
+	// TriggerManual is a sync started with the run command
+	TriggerManual string = "manual"
+)
+
+const (
+	RunRunning string = "running"
+	RunSuccess string = "success"
+	RunFailed  string = "failed"
+	// RunSkipped is a sync dropped by the overlap policy of the repository
+	RunSkipped string = "skipped"
+)
+
+const (
+	ArchiveTarGz string = "tar.gz"
+	ArchiveZip   string = "zip"
+)
+
 type (
 	Project struct {
 		UUID         string       `json:"uuid"`
 		Name         string       `json:"name"`
 		Repositories []Repository `json:"repositories"`
 		ServerURL    string       `json:"-"`
+		// Paused stops the syncs of every repository, set by the daemon
+		Paused bool `json:"paused,omitempty"`
 	}
 
 	Repository struct {
@@ -13,17 +110,214 @@ type (
 		Name            string                            `json:"name"`
 		Schedule        string                            `json:"schedule"`
 		Source          string                            `json:"source"`
-		Destination     string                            `json:"destination"`
+		Mirrors         []Mirror                          `json:"mirrors"`
 		Authentications map[string]AuthenticationSettings `json:"authentications"`
+		// Connections are the TLS and proxy settings of the remotes, by
+		// name like the authentications
+		Connections map[string]ConnectionSettings `json:"connections,omitempty"`
+		Refs        RefFilters                    `json:"refs"`
+		Mappings    []RefMapping                  `json:"mappings,omitempty"`
+		Verify      VerifySettings                `json:"verify"`
+		Limits      LimitSettings                 `json:"limits"`
+		Mode        string                        `json:"mode"`
+		Backup      BackupSettings                `json:"backup"`
+		Prune       string                        `json:"prune"`
+		Protected   []string                      `json:"protected,omitempty"`
+		LFS         bool                          `json:"lfs"`
+		Submodules  SubmoduleSettings             `json:"submodules"`
+		// Timeout is a duration (e.g. "30m"), the default of the daemon is used if empty
+		Timeout   string `json:"timeout,omitempty"`
+		Direction string `json:"direction"`
+		// Conflicts is the conflict policy of the bidirectional mode
+		Conflicts string           `json:"conflicts"`
+		Archives  *ArchiveSettings `json:"archives,omitempty"`
+		// Depth and ShallowSince limit the history fetched from the source,
+		// ShallowSince is a date or a duration
+		Depth        int           `json:"depth,omitempty"`
+		ShallowSince string        `json:"shallow_since,omitempty"`
+		Retry        RetrySettings `json:"retry"`
+		// Overlap is the policy of the syncs started while the previous one
+		// is still in progress
+		Overlap string `json:"overlap"`
+		// Paused stops the syncs of the repository, set by the daemon
+		Paused bool `json:"paused,omitempty"`
+		// Parent is the UUID of the repository this one is a submodule of
+		Parent string `json:"parent,omitempty"`
+	}
+
+	// Mirror is a destination of the repository, its authentication is
+	// stored in Repository.Authentications under its name.
+	Mirror struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		// Bundle is set when the mirror is a directory of bundle files
+		Bundle      *BundleSettings `json:"bundle,omitempty"`
+		PushOptions []string        `json:"push_options,omitempty"`
+		Atomic      bool            `json:"atomic,omitempty"`
+		Status      *MirrorStatus   `json:"status,omitempty"`
+	}
+
+	// ArchiveSettings writes snapshots of the source tree of the selected
+	// refs after each successful sync
+	ArchiveSettings struct {
+		Path     string   `json:"path"`
+		Branches []string `json:"branches,omitempty"`
+		Tags     []string `json:"tags,omitempty"`
+		Format   string   `json:"format"`
+		// Retention is a duration (e.g. "30d"), empty keeps the snapshots forever
+		Retention string `json:"retention,omitempty"`
+		// Interval is a duration (e.g. "1d"), empty archives every commit
+		// of the branches
+		Interval string `json:"interval,omitempty"`
+	}
+
+	BundleSettings struct {
+		Path string `json:"path"`
+		// Keep is the number of bundles kept, 5 if neither it nor the
+		// retention is set
+		Keep int `json:"keep,omitempty"`
+		// Retention is a duration (e.g. "30d"), empty keeps the bundles forever
+		Retention string `json:"retention,omitempty"`
+	}
+
+	// MirrorStatus is the result of the last push to the mirror, filled by the daemon
+	MirrorStatus struct {
+		LastSync time.Time `json:"last_sync"`
+		Success  bool      `json:"success"`
+		Error    string    `json:"error,omitempty"`
+		// Reason is the kind of failure (FailureError, FailureTimeout...)
+		Reason string `json:"reason,omitempty"`
+		// Mismatches are the refs found with another value than the pushed
+		// one when the mirror was checked after the push
+		Mismatches []Mismatch `json:"mismatches,omitempty"`
+		// Checked is false when the push failed before the mirror could be
+		// checked
+		Checked bool `json:"checked"`
+	}
+
+	Mismatch struct {
+		// Mirror is only set in the runs, a status is the one of its mirror
+		Mirror   string `json:"mirror,omitempty"`
+		Ref      string `json:"ref"`
+		Expected string `json:"expected"`
+		// Actual is empty when the ref is missing on the mirror
+		Actual string `json:"actual,omitempty"`
+	}
+
+	// Run is a sync of a repository, recorded by the daemon
+	Run struct {
+		ID int64 `json:"id"`
+		// Repository is the UUID of the synced repository
+		Repository string `json:"repository"`
+		Trigger    string `json:"trigger"`
+		// Attempt is 1 for the first try of a sync, then 2 for its first retry...
+		Attempt   int       `json:"attempt"`
+		StartedAt time.Time `json:"started_at"`
+		// EndedAt is nil while the run is in progress
+		EndedAt *time.Time `json:"ended_at,omitempty"`
+		Status  string     `json:"status"`
+		Error   string     `json:"error,omitempty"`
+		// RefUpdates are the refs changed on the mirrors
+		RefUpdates []RefUpdate `json:"ref_updates,omitempty"`
+		// Mismatches are the refs of the mirrors that did not have the
+		// pushed value when they were checked after the push
+		Mismatches []Mismatch `json:"mismatches,omitempty"`
+	}
+
+	// RefUpdate is a mirror ref changed by a run, Old is empty for a created
+	// ref and New for a deleted one
+	RefUpdate struct {
+		Mirror string `json:"mirror"`
+		Ref    string `json:"ref"`
+		Old    string `json:"old,omitempty"`
+		New    string `json:"new,omitempty"`
+	}
+
+	// RetrySettings try a sync again after a transient failure, with an
+	// exponential backoff
+	RetrySettings struct {
+		Attempts int `json:"attempts,omitempty"`
+		// Delay and MaxDelay are durations (e.g. "10s"), 10s and 5m are
+		// used if empty
+		Delay    string  `json:"delay,omitempty"`
+		MaxDelay string  `json:"max_delay,omitempty"`
+		Jitter   float64 `json:"jitter,omitempty"`
+	}
+
+	// BackupSettings keeps the mirror refs that are overwritten in force mode
+	BackupSettings struct {
+		Enabled bool `json:"enabled"`
+		// Retention is a duration (e.g. "30d"), empty keeps the backups forever
+		Retention string `json:"retention,omitempty"`
+	}
+
+	// VerifySettings are the trusted keys, the refs are only mirrored when
+	// signed by one of them if any is set
+	VerifySettings struct {
+		OpenPGPKeys    string `json:"openpgp_keys,omitempty"`
+		AllowedSigners string `json:"allowed_signers,omitempty"`
+	}
+
+	// SubmoduleSettings mirrors the submodules of the repository, their
+	// destination authentication is stored in Repository.Authentications
+	// under "submodules"
+	SubmoduleSettings struct {
+		Enabled bool `json:"enabled"`
+		// URL is the destination template, see git.Submodule.Destination
+		URL string `json:"url,omitempty"`
+	}
+
+	// LimitSettings abort the sync when the source grew too much, 0 means
+	// unlimited
+	LimitSettings struct {
+		MaxPackSizeMB int64 `json:"max_pack_size_mb,omitempty"`
+		MaxObjects    int64 `json:"max_objects,omitempty"`
+		MaxRefs       int64 `json:"max_refs,omitempty"`
+	}
+
+	RefFilters struct {
+		Branches RefPatterns `json:"branches"`
+		Tags     RefPatterns `json:"tags"`
+		Others   RefPatterns `json:"others"`
+	}
+
+	// RefMapping renames the source refs matching From to To on the mirrors
+	RefMapping struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	RefPatterns struct {
+		Include []string `json:"include,omitempty"`
+		Exclude []string `json:"exclude,omitempty"`
+	}
+
+	ConnectionSettings struct {
+		CABundle string `json:"ca_bundle,omitempty"`
+		// InsecureSkipVerify is nil when the default of the daemon applies
+		InsecureSkipVerify *bool    `json:"insecure_skip_verify,omitempty"`
+		ClientCert         string   `json:"client_cert,omitempty"`
+		ClientKey          string   `json:"client_key,omitempty"`
+		Proxy              string   `json:"proxy,omitempty"`
+		NoProxy            []string `json:"no_proxy,omitempty"`
 	}
 
 	AuthenticationSettings struct {
 		Basic *BasicAuthenticationSettings `json:"basic,omitempty"`
 		Token string                       `json:"token,omitempty"`
+		SSH   *SSHAuthenticationSettings   `json:"ssh,omitempty"`
 	}
 
 	BasicAuthenticationSettings struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
+
+	SSHAuthenticationSettings struct {
+		Username           string `json:"username,omitempty"`
+		PrivateKey         string `json:"private_key"`
+		Passphrase         string `json:"passphrase,omitempty"`
+		KnownHosts         string `json:"known_hosts,omitempty"`
+		HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+	}
 )
@@ -1,6 +1,14 @@
 package obj
 
-import "time"
+import (
+	"mirror-sync/pkg/project"
+	"time"
+)
+
+const (
+	JobRunning string = "running"
+	JobQueued  string = "queued"
+)
 
 type (
 	HTTPCore struct {
@@ -27,4 +35,40 @@ type (
 		OSName         string `json:"os_name"`
 		OSArchitecture string `json:"os_architecture"`
 	}
+
+	// Backup is a mirror ref saved before being overwritten
+	Backup struct {
+		Ref      string    `json:"ref"`
+		Original string    `json:"original"`
+		Hash     string    `json:"hash"`
+		Time     time.Time `json:"time"`
+	}
+
+	// Verification is the check of the mirror refs after the last push
+	Verification struct {
+		Mirror   string    `json:"mirror"`
+		LastSync time.Time `json:"last_sync"`
+		// Verified is false when refs do not have the pushed value, or
+		// when the mirror has not been checked
+		Verified bool `json:"verified"`
+		// Reason tells why the mirror is not verified
+		Reason     string             `json:"reason,omitempty"`
+		Mismatches []project.Mismatch `json:"mismatches"`
+	}
+
+	// Job is a sync attempt running or waiting for a worker of the daemon
+	Job struct {
+		Repository string   `json:"repository"`
+		Trigger    string   `json:"trigger"`
+		Attempt    int      `json:"attempt"`
+		Hosts      []string `json:"hosts"`
+		// Status is "running" or "queued"
+		Status    string     `json:"status"`
+		QueuedAt  time.Time  `json:"queued_at"`
+		StartedAt *time.Time `json:"started_at,omitempty"`
+	}
+
+	RestoreRequest struct {
+		Ref string `json:"ref"`
+	}
 )